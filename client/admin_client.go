@@ -0,0 +1,87 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Dostonlv/pcbook/pb"
+	"google.golang.org/grpc"
+)
+
+type AdminClient struct {
+	service pb.AdminServiceClient
+}
+
+func NewAdminClient(cc *grpc.ClientConn) *AdminClient {
+	service := pb.NewAdminServiceClient(cc)
+	return &AdminClient{service: service}
+}
+
+func (adminClient *AdminClient) AddUser(username, password, role string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	req := &pb.AddUserRequest{
+		Username: username,
+		Password: password,
+		Role:     role,
+	}
+	_, err := adminClient.service.AddUser(ctx, req)
+	if err != nil {
+		return fmt.Errorf("cannot add user: %v", err)
+	}
+	return nil
+}
+
+func (adminClient *AdminClient) RemoveUser(username string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := adminClient.service.RemoveUser(ctx, &pb.RemoveUserRequest{Username: username})
+	if err != nil {
+		return fmt.Errorf("cannot remove user: %v", err)
+	}
+	return nil
+}
+
+func (adminClient *AdminClient) ListUsers() ([]*pb.User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	res, err := adminClient.service.ListUsers(ctx, &pb.ListUsersRequest{})
+	if err != nil {
+		return nil, fmt.Errorf("cannot list users: %v", err)
+	}
+	return res.GetUsers(), nil
+}
+
+func (adminClient *AdminClient) ResetPassword(username, password string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	req := &pb.ResetPasswordRequest{
+		Username: username,
+		Password: password,
+	}
+	_, err := adminClient.service.ResetPassword(ctx, req)
+	if err != nil {
+		return fmt.Errorf("cannot reset password: %v", err)
+	}
+	return nil
+}
+
+func (adminClient *AdminClient) ChangeRole(username, role string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	req := &pb.ChangeRoleRequest{
+		Username: username,
+		Role:     role,
+	}
+	_, err := adminClient.service.ChangeRole(ctx, req)
+	if err != nil {
+		return fmt.Errorf("cannot change role: %v", err)
+	}
+	return nil
+}
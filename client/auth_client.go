@@ -10,14 +10,16 @@ import (
 
 type AuthClient struct {
 	service  pb.AuthServiceClient
+	tenant   string
 	username string
 	password string
 }
 
-func NewAuthClient(cc *grpc.ClientConn, username, password string) *AuthClient {
+func NewAuthClient(cc *grpc.ClientConn, tenant, username, password string) *AuthClient {
 	service := pb.NewAuthServiceClient(cc)
 	return &AuthClient{
 		service:  service,
+		tenant:   tenant,
 		username: username,
 		password: password,
 	}
@@ -30,6 +32,7 @@ func (client *AuthClient) Login() (string, error) {
 	req := &pb.LoginRequest{
 		Username: client.username,
 		Password: client.password,
+		Tenant:   client.tenant,
 	}
 
 	res, err := client.service.Login(ctx, req)
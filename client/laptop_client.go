@@ -3,11 +3,14 @@ package client
 import (
 	"bufio"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"log"
 	"os"
 	"path/filepath"
+	"strconv"
 	"time"
 
 	"github.com/Dostonlv/pcbook/pb"
@@ -49,6 +52,20 @@ func (laptopClient *LaptopClient) CreateLaptop(laptop *pb.Laptop) {
 
 }
 
+func (laptopClient *LaptopClient) DeleteLaptop(laptopID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	req := &pb.DeleteLaptopRequest{Id: laptopID}
+	_, err := laptopClient.service.DeleteLaptop(ctx, req)
+	if err != nil {
+		return fmt.Errorf("cannot delete laptop: %v", err)
+	}
+
+	log.Printf("deleted laptop with id: %s", laptopID)
+	return nil
+}
+
 func (laptopClient *LaptopClient) SearchLaptop(filter *pb.Filter) {
 	log.Print("search filter: ", filter)
 
@@ -83,38 +100,119 @@ func (laptopClient *LaptopClient) SearchLaptop(filter *pb.Filter) {
 	}
 }
 
-func (laptopClient *LaptopClient) UploadImage(laptopID string, imagePath string) {
+const (
+	uploadChunkSize    = 1024
+	maxUploadAttempts  = 5
+	uploadRetryBackoff = 200 * time.Millisecond
+)
+
+// UploadImage uploads the image through a resumable upload session.
+// If the stream breaks, the upload resumes from the offset the server has committed.
+func (laptopClient *LaptopClient) UploadImage(laptopID string, imagePath string) (*pb.UploadImageResponse, error) {
 	file, err := os.Open(imagePath)
 	if err != nil {
-		log.Fatal("cannot open image file: ", err)
+		return nil, fmt.Errorf("cannot open image file: %w", err)
 	}
 	defer file.Close()
 
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read image file: %w", err)
+	}
+
+	info := &pb.ImageInfo{
+		LaptopId:  laptopID,
+		ImageType: filepath.Ext(imagePath),
+		Digest:    hex.EncodeToString(hash.Sum(nil)),
+	}
+
+	// try to reuse the content if the server already has it
+	res, err := laptopClient.reuseImage(info)
+	if status.Code(err) == codes.NotFound {
+		res, err = laptopClient.uploadResumable(info, file, size)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot upload image: %w", err)
+	}
+
+	log.Printf("image uploaded with id: %s, size: %d, digest: %s", res.GetId(), res.GetSize(), res.GetDigest())
+	return res, nil
+}
+
+func (laptopClient *LaptopClient) uploadResumable(info *pb.ImageInfo, file io.ReadSeeker, size int64) (*pb.UploadImageResponse, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	stream, err := laptopClient.service.UploadImage(ctx)
+	req := &pb.StartImageUploadRequest{
+		Info: info,
+		Size: uint64(size),
+	}
+	session, err := laptopClient.service.StartImageUpload(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	sessionID := session.GetSessionId()
 
+	var offset int64
+	for attempt := 1; ; attempt++ {
+		res, sendErr := laptopClient.sendChunks(sessionID, file, offset)
+		if sendErr == nil {
+			return res, nil
+		}
+		if attempt >= maxUploadAttempts || !isRetryable(sendErr) {
+			return nil, sendErr
+		}
+
+		time.Sleep(time.Duration(attempt) * uploadRetryBackoff)
+
+		offset, err = laptopClient.uploadStatus(sessionID)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("resume upload session %s at offset %d after: %v", sessionID, offset, sendErr)
+	}
+}
+
+func (laptopClient *LaptopClient) uploadStatus(sessionID string) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	res, err := laptopClient.service.QueryUploadStatus(ctx, &pb.QueryUploadStatusRequest{SessionId: sessionID})
 	if err != nil {
-		log.Fatal("cannot upload image: ", err)
+		return 0, err
+	}
+	return int64(res.GetCommittedSize()), nil
+}
+
+// sendChunks streams the content of the file from the offset to the upload session.
+func (laptopClient *LaptopClient) sendChunks(sessionID string, file io.ReadSeeker, offset int64) (*pb.UploadImageResponse, error) {
+	_, err := file.Seek(offset, io.SeekStart)
+	if err != nil {
+		return nil, fmt.Errorf("cannot seek image file: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream, err := laptopClient.service.UploadImage(ctx)
+	if err != nil {
+		return nil, err
 	}
 
 	req := &pb.UploadImageRequest{
-		Data: &pb.UploadImageRequest_Info{
-			Info: &pb.ImageInfo{
-				LaptopId:  laptopID,
-				ImageType: filepath.Ext(imagePath),
-			},
+		Data: &pb.UploadImageRequest_SessionId{
+			SessionId: sessionID,
 		},
 	}
 
 	err = stream.Send(req)
 	if err != nil {
-		log.Fatal("cannot send image info: ", err, stream.RecvMsg(nil))
+		return nil, streamError(stream, err)
 	}
 
 	reader := bufio.NewReader(file)
-	buffer := make([]byte, 1024)
+	buffer := make([]byte, uploadChunkSize)
 
 	for {
 		n, err := reader.Read(buffer)
@@ -122,29 +220,110 @@ func (laptopClient *LaptopClient) UploadImage(laptopID string, imagePath string)
 			break
 		}
 		if err != nil {
-			log.Fatal("cannot read chunk to buffer: ", err)
+			return nil, fmt.Errorf("cannot read chunk to buffer: %w", err)
 		}
 
 		req := &pb.UploadImageRequest{
-			Data: &pb.UploadImageRequest_ChunkData{
-				ChunkData: buffer[:n],
+			Data: &pb.UploadImageRequest_Chunk{
+				Chunk: &pb.ImageChunk{
+					Offset: uint64(offset),
+					Data:   buffer[:n],
+				},
 			},
 		}
 
 		err = stream.Send(req)
-
 		if err != nil {
-			log.Fatal("cannot send chunk to server: ", err, stream.RecvMsg(nil))
+			return nil, streamError(stream, err)
 		}
+		offset += int64(n)
 	}
 
-	res, err := stream.CloseAndRecv()
+	return stream.CloseAndRecv()
+}
+
+// streamError returns the status the server closed the stream with, since Send only reports io.EOF.
+func streamError(stream grpc.ClientStream, err error) error {
+	if recvErr := stream.RecvMsg(nil); recvErr != nil && recvErr != io.EOF {
+		return recvErr
+	}
+	return err
+}
+
+// isRetryable reports whether an upload that failed with err can be resumed.
+func isRetryable(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.Unknown, codes.DeadlineExceeded, codes.Aborted:
+		return true
+	}
+	return false
+}
+
+// reuseImage asks the server to create the image from content with the digest it already has.
+func (laptopClient *LaptopClient) reuseImage(info *pb.ImageInfo) (*pb.UploadImageResponse, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream, err := laptopClient.service.UploadImage(ctx)
 	if err != nil {
-		log.Fatal("cannot receive response: ", err)
+		return nil, err
 	}
 
-	log.Printf("image uploaded with id: %s, size: %d ", res.GetId(), res.GetSize())
+	req := &pb.UploadImageRequest{
+		Data: &pb.UploadImageRequest_Info{
+			Info: info,
+		},
+	}
 
+	err = stream.Send(req)
+	if err != nil {
+		return nil, streamError(stream, err)
+	}
+	return stream.CloseAndRecv()
+}
+
+// DownloadImage writes the rendition of the image with the size to writer,
+// size 0 downloads the full-size image.
+func (laptopClient *LaptopClient) DownloadImage(imageID string, size uint32, writer io.Writer) (*pb.RenditionInfo, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	req := &pb.GetImageRenditionRequest{
+		ImageId: imageID,
+		Size:    size,
+	}
+
+	stream, err := laptopClient.service.GetImageRendition(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("cannot download image: %v", err)
+	}
+
+	var info *pb.RenditionInfo
+	for {
+		res, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("cannot receive image: %v", err)
+		}
+
+		if res.GetInfo() != nil {
+			info = res.GetInfo()
+			continue
+		}
+
+		_, err = writer.Write(res.GetChunkData())
+		if err != nil {
+			return nil, fmt.Errorf("cannot write image: %v", err)
+		}
+	}
+
+	if info == nil {
+		return nil, fmt.Errorf("server sent no rendition info")
+	}
+	log.Printf("downloaded image %s with size %d: %dx%d", imageID, size, info.GetWidth(), info.GetHeight())
+	return info, nil
 }
 
 func (laptopClient *LaptopClient) RateLaptop(laptopIDs []string, scores []float64) error {
@@ -171,14 +350,23 @@ func (laptopClient *LaptopClient) RateLaptop(laptopIDs []string, scores []float6
 				return
 			}
 
+			if res.GetStatus().GetCode() != uint32(codes.OK) {
+				log.Printf("rating %s rejected: %s", res.GetRequestId(), res.GetStatus().GetMessage())
+				continue
+			}
+			if res.GetQuarantined() {
+				log.Printf("rating %s is held for review", res.GetRequestId())
+				continue
+			}
 			log.Print("received response: ", res)
 		}
 	}()
 
 	for i, laptopID := range laptopIDs {
 		req := &pb.RateLaptopRequest{
-			LaptopId: laptopID,
-			Score:    scores[i],
+			LaptopId:  laptopID,
+			Score:     scores[i],
+			RequestId: strconv.Itoa(i + 1),
 		}
 
 		err := stream.Send(req)
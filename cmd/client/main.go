@@ -20,7 +20,10 @@ import (
 func testUploadImage(laptopClient *client.LaptopClient) {
 	laptop := sample.NewLaptop()
 	laptopClient.CreateLaptop(laptop)
-	laptopClient.UploadImage(laptop.GetId(), "tmp/laptop.jpg")
+	_, err := laptopClient.UploadImage(laptop.GetId(), "tmp/laptop.jpg")
+	if err != nil {
+		log.Fatal("cannot upload image: ", err)
+	}
 
 }
 
@@ -33,9 +36,13 @@ const (
 func authMethods() map[string]bool {
 	const laptopServicePath = "/pcbook.LaptopService/"
 	return map[string]bool{
-		laptopServicePath + "CreateLaptop": true,
-		laptopServicePath + "UploadImage":  true,
-		laptopServicePath + "RateLaptop":   true,
+		laptopServicePath + "CreateLaptop":      true,
+		laptopServicePath + "SearchLaptop":      true,
+		laptopServicePath + "UploadImage":       true,
+		laptopServicePath + "StartImageUpload":  true,
+		laptopServicePath + "QueryUploadStatus": true,
+		laptopServicePath + "RateLaptop":        true,
+		laptopServicePath + "DeleteLaptop":      true,
 	}
 }
 
@@ -61,6 +68,7 @@ func loadTLSCredientals() (credentials.TransportCredentials, error) {
 
 func main() {
 	serverAddress := flag.String("address", "", "the server address")
+	tenant := flag.String("tenant", "", "the tenant to log in to, empty for the default tenant")
 	flag.Parse()
 	log.Printf("dial server %s", *serverAddress)
 
@@ -75,7 +83,7 @@ func main() {
 		return
 	}
 
-	authClient := client.NewAuthClient(cc1, username, password)
+	authClient := client.NewAuthClient(cc1, *tenant, username, password)
 	interceptor, err := client.NewAuthInterceptor(authClient, authMethods(), refreshDuration)
 	if err != nil {
 		log.Fatal("cannot create auth interceptor: ", err)
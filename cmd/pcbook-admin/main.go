@@ -0,0 +1,259 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/Dostonlv/pcbook/client"
+	"github.com/Dostonlv/pcbook/pb"
+	"github.com/Dostonlv/pcbook/service"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+const usage = `usage: pcbook-admin [flags] <command> [arguments]
+
+commands:
+  add <username> <password> <role>
+  remove <username>
+  list
+  passwd <username> <password>
+  role <username> <role>
+
+With -users, the users file is edited directly and the server must be offline.
+With -address, the users are managed through the admin RPCs of the running server.
+
+flags:
+`
+
+const refreshDuration = 30 * time.Second
+
+type userManager interface {
+	AddUser(username, password, role string) error
+	RemoveUser(username string) error
+	ListUsers() ([]*pb.User, error)
+	ResetPassword(username, password string) error
+	ChangeRole(username, role string) error
+}
+
+// storeUserManager edits the users of a tenant directly in the user store.
+type storeUserManager struct {
+	store  service.UserStore
+	tenant string
+}
+
+func (manager *storeUserManager) AddUser(username, password, role string) error {
+	user, err := service.NewUser(manager.tenant, username, password, role)
+	if err != nil {
+		return err
+	}
+	return manager.store.Save(user)
+}
+
+func (manager *storeUserManager) RemoveUser(username string) error {
+	return manager.store.Delete(manager.tenant, username)
+}
+
+func (manager *storeUserManager) ListUsers() ([]*pb.User, error) {
+	users, err := manager.store.List(manager.tenant)
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]*pb.User, len(users))
+	for i, user := range users {
+		list[i] = &pb.User{Username: user.Username, Role: user.Role}
+	}
+	return list, nil
+}
+
+func (manager *storeUserManager) ResetPassword(username, password string) error {
+	return manager.update(username, func(user *service.User) error {
+		return user.SetPassword(password)
+	})
+}
+
+func (manager *storeUserManager) ChangeRole(username, role string) error {
+	err := service.ValidateRole(role)
+	if err != nil {
+		return err
+	}
+
+	return manager.update(username, func(user *service.User) error {
+		user.Role = role
+		return nil
+	})
+}
+
+func (manager *storeUserManager) update(username string, update func(user *service.User) error) error {
+	user, err := manager.store.Find(manager.tenant, username)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return fmt.Errorf("user %s is not found", username)
+	}
+
+	err = update(user)
+	if err != nil {
+		return err
+	}
+	return manager.store.Update(user)
+}
+
+func loadTLSCredientals() (credentials.TransportCredentials, error) {
+	pemServerCA, err := os.ReadFile("cert/ca-cert.pem")
+	if err != nil {
+		return nil, err
+	}
+	certPool := x509.NewCertPool()
+	if !certPool.AppendCertsFromPEM(pemServerCA) {
+		return nil, fmt.Errorf("failed to add server CA's certificate")
+	}
+	clientCert, err := tls.LoadX509KeyPair("cert/client-cert.pem", "cert/client-key.pem")
+	if err != nil {
+		return nil, err
+	}
+	config := &tls.Config{
+		Certificates: []tls.Certificate{clientCert},
+		RootCAs:      certPool,
+	}
+	return credentials.NewTLS(config), nil
+}
+
+func dialAdminClient(address, tenant, username, password string) (*client.AdminClient, error) {
+	tlsCredientals, err := loadTLSCredientals()
+	if err != nil {
+		return nil, fmt.Errorf("cannot load TLS credientals: %w", err)
+	}
+
+	cc1, err := grpc.Dial(address, grpc.WithTransportCredentials(tlsCredientals))
+	if err != nil {
+		return nil, fmt.Errorf("cannot dial server: %w", err)
+	}
+
+	const adminServicePath = "/pcbook.AdminService/"
+	authMethods := map[string]bool{
+		adminServicePath + "AddUser":       true,
+		adminServicePath + "RemoveUser":    true,
+		adminServicePath + "ListUsers":     true,
+		adminServicePath + "ResetPassword": true,
+		adminServicePath + "ChangeRole":    true,
+	}
+
+	authClient := client.NewAuthClient(cc1, tenant, username, password)
+	interceptor, err := client.NewAuthInterceptor(authClient, authMethods, refreshDuration)
+	if err != nil {
+		return nil, fmt.Errorf("cannot log in: %w", err)
+	}
+
+	cc2, err := grpc.Dial(address, grpc.WithTransportCredentials(tlsCredientals),
+		grpc.WithUnaryInterceptor(interceptor.Unary()),
+		grpc.WithStreamInterceptor(interceptor.Stream()))
+	if err != nil {
+		return nil, fmt.Errorf("cannot dial server: %w", err)
+	}
+	return client.NewAdminClient(cc2), nil
+}
+
+func run(manager userManager, args []string) error {
+	if len(args) == 0 {
+		return errors.New("missing command")
+	}
+
+	command, args := args[0], args[1:]
+	expectArgs := func(names ...string) error {
+		if len(args) != len(names) {
+			return fmt.Errorf("%s expects %d arguments: %v", command, len(names), names)
+		}
+		return nil
+	}
+
+	switch command {
+	case "add":
+		if err := expectArgs("username", "password", "role"); err != nil {
+			return err
+		}
+		return manager.AddUser(args[0], args[1], args[2])
+	case "remove":
+		if err := expectArgs("username"); err != nil {
+			return err
+		}
+		return manager.RemoveUser(args[0])
+	case "list":
+		if err := expectArgs(); err != nil {
+			return err
+		}
+		users, err := manager.ListUsers()
+		if err != nil {
+			return err
+		}
+		for _, user := range users {
+			fmt.Printf("%s\t%s\n", user.GetUsername(), user.GetRole())
+		}
+		return nil
+	case "passwd":
+		if err := expectArgs("username", "password"); err != nil {
+			return err
+		}
+		return manager.ResetPassword(args[0], args[1])
+	case "role":
+		if err := expectArgs("username", "role"); err != nil {
+			return err
+		}
+		return manager.ChangeRole(args[0], args[1])
+	default:
+		return fmt.Errorf("unknown command %q", command)
+	}
+}
+
+func main() {
+	usersFile := flag.String("users", "", "the users file to edit while the server is offline")
+	tenant := flag.String("tenant", service.DefaultTenant, "the tenant of the users")
+	address := flag.String("address", "", "the address of a running server to manage the users through")
+	login := flag.String("login", "", "the admin username to log in to the server with")
+	password := flag.String("password", "", "the admin password to log in to the server with")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	var manager userManager
+	if *address != "" {
+		adminClient, err := dialAdminClient(*address, *tenant, *login, *password)
+		if err != nil {
+			log.Fatal(err)
+		}
+		manager = adminClient
+	} else if *usersFile != "" {
+		// the server refuses to start with a user of an invalid tenant
+		err := service.ValidateTenant(*tenant)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		userStore, err := service.NewFileUserStore(*usersFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		manager = &storeUserManager{store: userStore, tenant: *tenant}
+	} else {
+		fmt.Fprintln(flag.CommandLine.Output(), "either -users or -address is required")
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	err := run(manager, flag.Args())
+	if err != nil {
+		fmt.Fprintln(flag.CommandLine.Output(), err)
+		flag.Usage()
+		os.Exit(1)
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"flag"
@@ -9,6 +10,10 @@ import (
 	"log"
 	"log/slog"
 	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
 	"google.golang.org/grpc/credentials"
@@ -26,23 +31,126 @@ const (
 
 func accessibleRoles() map[string][]string {
 	const laptopServicePath = "/pcbook.LaptopService/"
+	const tenantServicePath = "/pcbook.TenantService/"
+	const adminServicePath = "/pcbook.AdminService/"
+	const reviewServicePath = "/pcbook.ReviewService/"
 	return map[string][]string{
-		laptopServicePath + "CreateLaptop": {"admin"},
-		laptopServicePath + "UploadImage":  {"admin"},
-		laptopServicePath + "RateLaptop":   {"admin", "user"},
+		laptopServicePath + "CreateLaptop":             {"admin"},
+		laptopServicePath + "UploadImage":              {"admin"},
+		laptopServicePath + "StartImageUpload":         {"admin"},
+		laptopServicePath + "QueryUploadStatus":        {"admin"},
+		laptopServicePath + "RateLaptop":               {"admin", "user"},
+		laptopServicePath + "DeleteLaptop":             {"admin"},
+		laptopServicePath + "DeleteImage":              {"admin"},
+		laptopServicePath + "ReorderImages":            {"admin"},
+		laptopServicePath + "SetPrimaryImage":          {"admin"},
+		laptopServicePath + "UpdateImage":              {"admin"},
+		laptopServicePath + "GetImageUsage":            {"admin"},
+		laptopServicePath + "CollectImageGarbage":      {"admin"},
+		laptopServicePath + "RebuildRatings":           {"admin"},
+		laptopServicePath + "ListQuarantinedRatings":   {"admin"},
+		laptopServicePath + "ApproveQuarantinedRating": {"admin"},
+		laptopServicePath + "RejectQuarantinedRating":  {"admin"},
+		reviewServicePath + "SubmitReview":             {"admin", "user"},
+		reviewServicePath + "ListPendingReviews":       {"admin"},
+		reviewServicePath + "ApproveReview":            {"admin"},
+		reviewServicePath + "RejectReview":             {"admin"},
+		tenantServicePath + "CreateTenant":             {"superadmin"},
+		tenantServicePath + "ListTenants":              {"superadmin"},
+		tenantServicePath + "DeleteTenant":             {"superadmin"},
+		adminServicePath + "AddUser":                   {"admin", "superadmin"},
+		adminServicePath + "RemoveUser":                {"admin", "superadmin"},
+		adminServicePath + "ListUsers":                 {"admin", "superadmin"},
+		adminServicePath + "ResetPassword":             {"admin", "superadmin"},
+		adminServicePath + "ChangeRole":                {"admin", "superadmin"},
 	}
 }
 
 func seedUsers(userStore service.UserStore) error {
-	err := createUser(userStore, "admin1", "secret", "admin")
+	err := createUser(userStore, "superadmin1", "secret", "superadmin")
+	if err != nil {
+		return err
+	}
+	err = createUser(userStore, "admin1", "secret", "admin")
 	if err != nil {
 		return err
 	}
 	return createUser(userStore, "user1", "secret", "user")
 }
 
+// newUserStore opens the users file if one is given, otherwise it keeps users in memory.
+// Only the users kept in memory are seeded with the sample users, those of a users file
+// are created with pcbook-admin.
+func newUserStore(usersFile string) (service.UserStore, error) {
+	if usersFile != "" {
+		return service.NewFileUserStore(usersFile)
+	}
+
+	userStore := service.NewInMemoryUserStore()
+	err := seedUsers(userStore)
+	if err != nil {
+		return nil, fmt.Errorf("cannot seed users: %w", err)
+	}
+	return userStore, nil
+}
+
+// newImageStore opens the image store of the tenant. On disk, the images of the default tenant
+// are kept in the img folder and those of other tenants in a sub-folder. In object storage,
+// the keys of other tenants start with the tenant name.
+func newImageStore(kind string, tenant string, s3Config service.S3Config) (service.ImageStore, error) {
+	if kind == "s3" {
+		if tenant != service.DefaultTenant {
+			s3Config.Prefix += tenant + "/"
+		}
+		return service.OpenS3ImageStore(s3Config)
+	}
+
+	imageFolder := "img"
+	if tenant != service.DefaultTenant {
+		imageFolder = filepath.Join("img", tenant)
+		err := os.MkdirAll(imageFolder, 0755)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	switch kind {
+	case "disk":
+		return service.OpenDiskImageStore(imageFolder)
+	case "content":
+		return service.NewContentAddressedImageStore(imageFolder)
+	default:
+		return nil, fmt.Errorf("unknown image store %q", kind)
+	}
+}
+
+// newRatingStore keeps the ratings in memory, or logs them in a file of the folder named after the tenant.
+func newRatingStore(folder string, tenant string, halfLife time.Duration) (service.RatingStore, error) {
+	if folder == "" {
+		return service.NewInMemoryRatingStore(service.WithRatingHalfLife(halfLife)), nil
+	}
+
+	err := os.MkdirAll(folder, 0755)
+	if err != nil {
+		return nil, err
+	}
+	return service.NewFileRatingStore(filepath.Join(folder, tenant+".jsonl"), service.WithRatingHalfLife(halfLife))
+}
+
+func newRenditioner(sizes string, workers int) (*service.Renditioner, error) {
+	var renditionSizes []int
+	for _, size := range strings.Split(sizes, ",") {
+		renditionSize, err := strconv.Atoi(strings.TrimSpace(size))
+		if err != nil {
+			return nil, fmt.Errorf("invalid rendition size %q", size)
+		}
+		renditionSizes = append(renditionSizes, renditionSize)
+	}
+	return service.NewRenditioner(renditionSizes, workers, 100*workers)
+}
+
 func createUser(userStore service.UserStore, username, password, role string) error {
-	user, err := service.NewUser(username, password, role)
+	user, err := service.NewUser(service.DefaultTenant, username, password, role)
 	if err != nil {
 		return err
 	}
@@ -74,21 +182,137 @@ func loadTLSCredientals() (credentials.TransportCredentials, error) {
 
 func main() {
 	port := flag.Int("port", 0, "the server port")
+	shards := flag.Int("shards", service.DefaultShardCount, "the number of laptop store shards")
+	imageStoreKind := flag.String("image-store", "disk", "the image store to use: disk, content (deduplicated by digest) or s3")
+	s3Endpoint := flag.String("s3-endpoint", "https://s3.amazonaws.com", "the URL of the S3-compatible object storage")
+	s3Bucket := flag.String("s3-bucket", "pcbook-images", "the bucket keeping the images in object storage")
+	s3Region := flag.String("s3-region", "us-east-1", "the region of the bucket")
+	imageTypes := flag.String("image-types", strings.Join(service.DefaultImageTypes, ","), "the comma separated image extensions or MIME types clients may upload")
+	maxImageWidth := flag.Int("max-image-width", service.DefaultMaxImageWidth, "the maximum width in pixels of uploaded images")
+	maxImageHeight := flag.Int("max-image-height", service.DefaultMaxImageHeight, "the maximum height in pixels of uploaded images")
+	maxImageSize := flag.Int64("max-image-size", service.DefaultMaxImageSize, "the maximum size in bytes of uploaded images")
+	maxImagesPerLaptop := flag.Int("max-images-per-laptop", 0, "the maximum number of images of a laptop, 0 for no limit")
+	maxUserImageBytes := flag.Int64("max-user-image-bytes", 0, "the maximum total size in bytes of the images a user uploads, 0 for no limit")
+	maxTotalImageBytes := flag.Int64("max-total-image-bytes", 0, "the maximum size in bytes of the image folder content, 0 for no limit")
+	renditionSizes := flag.String("rendition-sizes", "128,512", "the comma separated sizes in pixels of the resized versions of every image")
+	renditionWorkers := flag.Int("rendition-workers", 4, "the number of workers resizing uploaded images, 0 to only resize on demand")
+	gcInterval := flag.Duration("gc-interval", 0, "how often to remove orphan images and files, 0 to only collect on request")
+	gcGracePeriod := flag.Duration("gc-grace-period", service.DefaultGCGracePeriod, "how long to keep files no image refers to")
+	gcDryRun := flag.Bool("gc-dry-run", false, "only log what the periodic garbage collection would remove")
+	gcOrphanImages := flag.Bool("gc-orphan-images", false, "also remove the images of laptops that don't exist, only safe if the laptops outlive a restart")
+	scoreMin := flag.Float64("score-min", service.DefaultScoreRange.Min, "the lowest score users can rate a laptop with")
+	scoreMax := flag.Float64("score-max", service.DefaultScoreRange.Max, "the highest score users can rate a laptop with")
+	scoreStep := flag.Float64("score-step", service.DefaultScoreRange.Step, "the step between the scores, 0 to allow any score in the range")
+	priorMean := flag.Float64("rating-prior-mean", 0, "the mean of the Bayesian rating prior, 0 for the middle of the score range")
+	priorWeight := flag.Float64("rating-prior-weight", service.DefaultRatingPriorWeight, "how many ratings the Bayesian rating prior counts as")
+	bannedWords := flag.String("banned-words", "", "the comma separated words flagging the reviews containing them for the moderators")
+	ratingsFolder := flag.String("ratings", "", "the folder to log the rating events of every tenant in, empty to keep ratings in memory")
+	ratingHalfLife := flag.Duration("rating-half-life", service.DefaultRatingHalfLife, "how long it takes for a score to weigh half as much in the decayed rating averages, 0 to not decay")
+	maxRatingsPerUser := flag.Int("max-ratings-per-user", service.DefaultRatingLimits.MaxPerUser, "the maximum number of ratings a user can give within the rating window, 0 for no limit")
+	ratingWindow := flag.Duration("rating-window", service.DefaultRatingLimits.Window, "the window of the per-user rating limit")
+	ratingBurstSize := flag.Int("rating-burst-size", service.DefaultRatingLimits.BurstSize, "how many ratings of a laptop from new accounts within the burst window get quarantined, 0 to not detect bursts")
+	ratingBurstWindow := flag.Duration("rating-burst-window", service.DefaultRatingLimits.BurstWindow, "the window of the rating bursts")
+	newAccountAge := flag.Duration("new-account-age", service.DefaultRatingLimits.NewAccountAge, "how long an account counts as new for the rating burst detection")
+	usersFile := flag.String("users", "", "the file to keep users in, empty to keep them in memory")
+	cacheSize := flag.Int("cache-size", 1000, "the number of laptops and searches to cache, 0 to disable caching")
 	flag.Parse()
 	log.Printf("start server on port %d ", *port)
 
-	userStore := service.NewInMemoryUserStore()
-	err := seedUsers(userStore)
+	userStore, err := newUserStore(*usersFile)
 	if err != nil {
-		log.Fatal("cannot seed users")
+		log.Fatal("cannot create user store: ", err)
 	}
 	jwtManager := service.NewJWTManager(secretKey, tokenDuration)
 	authServer := service.NewAuthServer(userStore, jwtManager)
 
-	laptopStore := service.NewInMemoryLaptopStore()
-	imageStore := service.NewDiskImageStore("img")
-	ratingStore := service.NewInMemoryRatingStore()
-	laptopServer := service.NewLaptopServer(laptopStore, imageStore, ratingStore)
+	// the credentials of the object storage are taken from the environment, as the AWS tools do
+	s3Config := service.S3Config{
+		Endpoint: *s3Endpoint,
+		Bucket:   *s3Bucket,
+		Region:   *s3Region,
+		Credentials: service.S3Credentials{
+			AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		},
+	}
+
+	newCatalog := func(tenant string) (*service.Catalog, error) {
+		var laptopStore service.LaptopStore = service.NewShardedLaptopStore(*shards)
+		if *cacheSize > 0 {
+			laptopStore = service.NewCachingLaptopStore(laptopStore, *cacheSize, *cacheSize)
+		}
+
+		imageStore, err := newImageStore(*imageStoreKind, tenant, s3Config)
+		if err != nil {
+			return nil, err
+		}
+		ratingStore, err := newRatingStore(*ratingsFolder, tenant, *ratingHalfLife)
+		if err != nil {
+			return nil, err
+		}
+		return service.NewCatalog(laptopStore, imageStore, ratingStore), nil
+	}
+
+	defaultCatalog, err := newCatalog(service.DefaultTenant)
+	if err != nil {
+		log.Fatal("cannot create default catalog: ", err)
+	}
+	tenants := service.NewTenantCatalogs(defaultCatalog, newCatalog)
+	err = service.RestoreTenants(tenants, userStore)
+	if err != nil {
+		log.Fatal("cannot restore tenants: ", err)
+	}
+	allowedImageTypes, err := service.NewImageTypes(strings.Split(*imageTypes, ",")...)
+	if err != nil {
+		log.Fatal("cannot parse image types: ", err)
+	}
+	renditions, err := newRenditioner(*renditionSizes, *renditionWorkers)
+	if err != nil {
+		log.Fatal("cannot create renditioner: ", err)
+	}
+	defer renditions.Close()
+	scoreRange, err := service.NewScoreRange(*scoreMin, *scoreMax, *scoreStep)
+	if err != nil {
+		log.Fatal("cannot parse score range: ", err)
+	}
+	if *priorMean == 0 {
+		*priorMean = (scoreRange.Min + scoreRange.Max) / 2
+	}
+	ratingPrior, err := service.NewRatingPrior(*priorMean, *priorWeight)
+	if err != nil {
+		log.Fatal("cannot parse rating prior: ", err)
+	}
+	collector := service.NewImageCollector(tenants, *gcGracePeriod, *gcOrphanImages)
+	if *gcInterval > 0 {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go collector.Run(ctx, *gcInterval, *gcDryRun)
+	}
+	laptopServer := service.NewMultiTenantLaptopServer(
+		tenants,
+		service.WithImageTypes(allowedImageTypes),
+		service.WithImageLimits(service.ImageLimits{MaxWidth: *maxImageWidth, MaxHeight: *maxImageHeight}),
+		service.WithMaxImageSize(*maxImageSize),
+		service.WithRenditions(renditions),
+		service.WithImageCollector(collector),
+		service.WithImageQuotas(service.ImageQuotas{
+			MaxImagesPerLaptop: *maxImagesPerLaptop,
+			MaxBytesPerUser:    *maxUserImageBytes,
+			MaxTotalBytes:      *maxTotalImageBytes,
+		}),
+		service.WithScoreRange(scoreRange),
+		service.WithRatingPrior(ratingPrior),
+		service.WithRatingLimits(service.RatingLimits{
+			MaxPerUser:    *maxRatingsPerUser,
+			Window:        *ratingWindow,
+			BurstSize:     *ratingBurstSize,
+			BurstWindow:   *ratingBurstWindow,
+			NewAccountAge: *newAccountAge,
+		}),
+	)
+	tenantServer := service.NewTenantServer(tenants, userStore)
+	adminServer := service.NewAdminServer(userStore)
+	reviewServer := service.NewReviewServer(tenants, service.WithBannedWords(service.NewBannedWords(strings.Split(*bannedWords, ",")...)))
 
 	tlsCredientals, err := loadTLSCredientals()
 	if err != nil {
@@ -103,15 +327,18 @@ func main() {
 	)
 	pb.RegisterLaptopServiceServer(grpcServer, laptopServer)
 	pb.RegisterAuthServiceServer(grpcServer, authServer)
+	pb.RegisterTenantServiceServer(grpcServer, tenantServer)
+	pb.RegisterAdminServiceServer(grpcServer, adminServer)
+	pb.RegisterReviewServiceServer(grpcServer, reviewServer)
 	reflection.Register(grpcServer)
 
 	address := fmt.Sprintf("0.0.0.0:%d", *port)
 	listener, err := net.Listen("tcp", address)
 	if err != nil {
-		slog.Error("cannot start server: %w", err)
+		slog.Error("cannot start server", "err", err)
 	}
 	err = grpcServer.Serve(listener)
 	if err != nil {
-		slog.Error("cannot start server: %w", err)
+		slog.Error("cannot start server", "err", err)
 	}
 }
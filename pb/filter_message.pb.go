@@ -20,15 +20,75 @@ const (
 	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
 )
 
+type Filter_SortBy int32
+
+const (
+	Filter_UNSORTED       Filter_SortBy = 0
+	Filter_PRICE          Filter_SortBy = 1
+	Filter_CPU_GHZ        Filter_SortBy = 2
+	Filter_RELEASE_YEAR   Filter_SortBy = 3
+	Filter_RATING         Filter_SortBy = 4
+	Filter_DECAYED_RATING Filter_SortBy = 5
+)
+
+// Enum value maps for Filter_SortBy.
+var (
+	Filter_SortBy_name = map[int32]string{
+		0: "UNSORTED",
+		1: "PRICE",
+		2: "CPU_GHZ",
+		3: "RELEASE_YEAR",
+		4: "RATING",
+		5: "DECAYED_RATING",
+	}
+	Filter_SortBy_value = map[string]int32{
+		"UNSORTED":       0,
+		"PRICE":          1,
+		"CPU_GHZ":        2,
+		"RELEASE_YEAR":   3,
+		"RATING":         4,
+		"DECAYED_RATING": 5,
+	}
+)
+
+func (x Filter_SortBy) Enum() *Filter_SortBy {
+	p := new(Filter_SortBy)
+	*p = x
+	return p
+}
+
+func (x Filter_SortBy) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Filter_SortBy) Descriptor() protoreflect.EnumDescriptor {
+	return file_filter_message_proto_enumTypes[0].Descriptor()
+}
+
+func (Filter_SortBy) Type() protoreflect.EnumType {
+	return &file_filter_message_proto_enumTypes[0]
+}
+
+func (x Filter_SortBy) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use Filter_SortBy.Descriptor instead.
+func (Filter_SortBy) EnumDescriptor() ([]byte, []int) {
+	return file_filter_message_proto_rawDescGZIP(), []int{0, 0}
+}
+
 type Filter struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	MaxPriceUsd float64 `protobuf:"fixed64,1,opt,name=max_price_usd,json=maxPriceUsd,proto3" json:"max_price_usd,omitempty"`
-	MinCpuCores uint32  `protobuf:"varint,2,opt,name=min_cpu_cores,json=minCpuCores,proto3" json:"min_cpu_cores,omitempty"`
-	MinCpuGhz   float64 `protobuf:"fixed64,3,opt,name=min_cpu_ghz,json=minCpuGhz,proto3" json:"min_cpu_ghz,omitempty"`
-	MinRam      *Memory `protobuf:"bytes,4,opt,name=min_ram,json=minRam,proto3" json:"min_ram,omitempty"`
+	MaxPriceUsd float64       `protobuf:"fixed64,1,opt,name=max_price_usd,json=maxPriceUsd,proto3" json:"max_price_usd,omitempty"`
+	MinCpuCores uint32        `protobuf:"varint,2,opt,name=min_cpu_cores,json=minCpuCores,proto3" json:"min_cpu_cores,omitempty"`
+	MinCpuGhz   float64       `protobuf:"fixed64,3,opt,name=min_cpu_ghz,json=minCpuGhz,proto3" json:"min_cpu_ghz,omitempty"`
+	MinRam      *Memory       `protobuf:"bytes,4,opt,name=min_ram,json=minRam,proto3" json:"min_ram,omitempty"`
+	SortBy      Filter_SortBy `protobuf:"varint,5,opt,name=sort_by,json=sortBy,proto3,enum=pcbook.Filter_SortBy" json:"sort_by,omitempty"`
+	Descending  bool          `protobuf:"varint,6,opt,name=descending,proto3" json:"descending,omitempty"`
 }
 
 func (x *Filter) Reset() {
@@ -91,13 +151,27 @@ func (x *Filter) GetMinRam() *Memory {
 	return nil
 }
 
+func (x *Filter) GetSortBy() Filter_SortBy {
+	if x != nil {
+		return x.SortBy
+	}
+	return Filter_UNSORTED
+}
+
+func (x *Filter) GetDescending() bool {
+	if x != nil {
+		return x.Descending
+	}
+	return false
+}
+
 var File_filter_message_proto protoreflect.FileDescriptor
 
 var file_filter_message_proto_rawDesc = []byte{
 	0x0a, 0x14, 0x66, 0x69, 0x6c, 0x74, 0x65, 0x72, 0x5f, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65,
 	0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12, 0x06, 0x70, 0x63, 0x62, 0x6f, 0x6f, 0x6b, 0x1a, 0x14,
 	0x6d, 0x65, 0x6d, 0x6f, 0x72, 0x79, 0x5f, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x2e, 0x70,
-	0x72, 0x6f, 0x74, 0x6f, 0x22, 0x99, 0x01, 0x0a, 0x06, 0x46, 0x69, 0x6c, 0x74, 0x65, 0x72, 0x12,
+	0x72, 0x6f, 0x74, 0x6f, 0x22, 0xcb, 0x02, 0x0a, 0x06, 0x46, 0x69, 0x6c, 0x74, 0x65, 0x72, 0x12,
 	0x22, 0x0a, 0x0d, 0x6d, 0x61, 0x78, 0x5f, 0x70, 0x72, 0x69, 0x63, 0x65, 0x5f, 0x75, 0x73, 0x64,
 	0x18, 0x01, 0x20, 0x01, 0x28, 0x01, 0x52, 0x0b, 0x6d, 0x61, 0x78, 0x50, 0x72, 0x69, 0x63, 0x65,
 	0x55, 0x73, 0x64, 0x12, 0x22, 0x0a, 0x0d, 0x6d, 0x69, 0x6e, 0x5f, 0x63, 0x70, 0x75, 0x5f, 0x63,
@@ -107,7 +181,19 @@ var file_filter_message_proto_rawDesc = []byte{
 	0x6e, 0x43, 0x70, 0x75, 0x47, 0x68, 0x7a, 0x12, 0x27, 0x0a, 0x07, 0x6d, 0x69, 0x6e, 0x5f, 0x72,
 	0x61, 0x6d, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x0e, 0x2e, 0x70, 0x63, 0x62, 0x6f, 0x6f,
 	0x6b, 0x2e, 0x4d, 0x65, 0x6d, 0x6f, 0x72, 0x79, 0x52, 0x06, 0x6d, 0x69, 0x6e, 0x52, 0x61, 0x6d,
-	0x42, 0x06, 0x5a, 0x04, 0x2e, 0x3b, 0x70, 0x62, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+	0x12, 0x2e, 0x0a, 0x07, 0x73, 0x6f, 0x72, 0x74, 0x5f, 0x62, 0x79, 0x18, 0x05, 0x20, 0x01, 0x28,
+	0x0e, 0x32, 0x15, 0x2e, 0x70, 0x63, 0x62, 0x6f, 0x6f, 0x6b, 0x2e, 0x46, 0x69, 0x6c, 0x74, 0x65,
+	0x72, 0x2e, 0x53, 0x6f, 0x72, 0x74, 0x42, 0x79, 0x52, 0x06, 0x73, 0x6f, 0x72, 0x74, 0x42, 0x79,
+	0x12, 0x1e, 0x0a, 0x0a, 0x64, 0x65, 0x73, 0x63, 0x65, 0x6e, 0x64, 0x69, 0x6e, 0x67, 0x18, 0x06,
+	0x20, 0x01, 0x28, 0x08, 0x52, 0x0a, 0x64, 0x65, 0x73, 0x63, 0x65, 0x6e, 0x64, 0x69, 0x6e, 0x67,
+	0x22, 0x60, 0x0a, 0x06, 0x53, 0x6f, 0x72, 0x74, 0x42, 0x79, 0x12, 0x0c, 0x0a, 0x08, 0x55, 0x4e,
+	0x53, 0x4f, 0x52, 0x54, 0x45, 0x44, 0x10, 0x00, 0x12, 0x09, 0x0a, 0x05, 0x50, 0x52, 0x49, 0x43,
+	0x45, 0x10, 0x01, 0x12, 0x0b, 0x0a, 0x07, 0x43, 0x50, 0x55, 0x5f, 0x47, 0x48, 0x5a, 0x10, 0x02,
+	0x12, 0x10, 0x0a, 0x0c, 0x52, 0x45, 0x4c, 0x45, 0x41, 0x53, 0x45, 0x5f, 0x59, 0x45, 0x41, 0x52,
+	0x10, 0x03, 0x12, 0x0a, 0x0a, 0x06, 0x52, 0x41, 0x54, 0x49, 0x4e, 0x47, 0x10, 0x04, 0x12, 0x12,
+	0x0a, 0x0e, 0x44, 0x45, 0x43, 0x41, 0x59, 0x45, 0x44, 0x5f, 0x52, 0x41, 0x54, 0x49, 0x4e, 0x47,
+	0x10, 0x05, 0x42, 0x06, 0x5a, 0x04, 0x2e, 0x3b, 0x70, 0x62, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74,
+	0x6f, 0x33,
 }
 
 var (
@@ -122,18 +208,21 @@ func file_filter_message_proto_rawDescGZIP() []byte {
 	return file_filter_message_proto_rawDescData
 }
 
+var file_filter_message_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
 var file_filter_message_proto_msgTypes = make([]protoimpl.MessageInfo, 1)
 var file_filter_message_proto_goTypes = []any{
-	(*Filter)(nil), // 0: pcbook.Filter
-	(*Memory)(nil), // 1: pcbook.Memory
+	(Filter_SortBy)(0), // 0: pcbook.Filter.SortBy
+	(*Filter)(nil),     // 1: pcbook.Filter
+	(*Memory)(nil),     // 2: pcbook.Memory
 }
 var file_filter_message_proto_depIdxs = []int32{
-	1, // 0: pcbook.Filter.min_ram:type_name -> pcbook.Memory
-	1, // [1:1] is the sub-list for method output_type
-	1, // [1:1] is the sub-list for method input_type
-	1, // [1:1] is the sub-list for extension type_name
-	1, // [1:1] is the sub-list for extension extendee
-	0, // [0:1] is the sub-list for field type_name
+	2, // 0: pcbook.Filter.min_ram:type_name -> pcbook.Memory
+	0, // 1: pcbook.Filter.sort_by:type_name -> pcbook.Filter.SortBy
+	2, // [2:2] is the sub-list for method output_type
+	2, // [2:2] is the sub-list for method input_type
+	2, // [2:2] is the sub-list for extension type_name
+	2, // [2:2] is the sub-list for extension extendee
+	0, // [0:2] is the sub-list for field type_name
 }
 
 func init() { file_filter_message_proto_init() }
@@ -161,13 +250,14 @@ func file_filter_message_proto_init() {
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: file_filter_message_proto_rawDesc,
-			NumEnums:      0,
+			NumEnums:      1,
 			NumMessages:   1,
 			NumExtensions: 0,
 			NumServices:   0,
 		},
 		GoTypes:           file_filter_message_proto_goTypes,
 		DependencyIndexes: file_filter_message_proto_depIdxs,
+		EnumInfos:         file_filter_message_proto_enumTypes,
 		MessageInfos:      file_filter_message_proto_msgTypes,
 	}.Build()
 	File_filter_message_proto = out.File
@@ -19,10 +19,29 @@ import (
 const _ = grpc.SupportPackageIsVersion8
 
 const (
-	LaptopService_CreateLaptop_FullMethodName = "/pcbook.LaptopService/CreateLaptop"
-	LaptopService_SearchLaptop_FullMethodName = "/pcbook.LaptopService/SearchLaptop"
-	LaptopService_UploadImage_FullMethodName  = "/pcbook.LaptopService/UploadImage"
-	LaptopService_RateLaptop_FullMethodName   = "/pcbook.LaptopService/RateLaptop"
+	LaptopService_CreateLaptop_FullMethodName             = "/pcbook.LaptopService/CreateLaptop"
+	LaptopService_SearchLaptop_FullMethodName             = "/pcbook.LaptopService/SearchLaptop"
+	LaptopService_UploadImage_FullMethodName              = "/pcbook.LaptopService/UploadImage"
+	LaptopService_StartImageUpload_FullMethodName         = "/pcbook.LaptopService/StartImageUpload"
+	LaptopService_QueryUploadStatus_FullMethodName        = "/pcbook.LaptopService/QueryUploadStatus"
+	LaptopService_RateLaptop_FullMethodName               = "/pcbook.LaptopService/RateLaptop"
+	LaptopService_DeleteLaptop_FullMethodName             = "/pcbook.LaptopService/DeleteLaptop"
+	LaptopService_GetImageInfo_FullMethodName             = "/pcbook.LaptopService/GetImageInfo"
+	LaptopService_GetImageRendition_FullMethodName        = "/pcbook.LaptopService/GetImageRendition"
+	LaptopService_ListLaptopImages_FullMethodName         = "/pcbook.LaptopService/ListLaptopImages"
+	LaptopService_DeleteImage_FullMethodName              = "/pcbook.LaptopService/DeleteImage"
+	LaptopService_ReorderImages_FullMethodName            = "/pcbook.LaptopService/ReorderImages"
+	LaptopService_SetPrimaryImage_FullMethodName          = "/pcbook.LaptopService/SetPrimaryImage"
+	LaptopService_UpdateImage_FullMethodName              = "/pcbook.LaptopService/UpdateImage"
+	LaptopService_GetImageUsage_FullMethodName            = "/pcbook.LaptopService/GetImageUsage"
+	LaptopService_CollectImageGarbage_FullMethodName      = "/pcbook.LaptopService/CollectImageGarbage"
+	LaptopService_GetRatingSummary_FullMethodName         = "/pcbook.LaptopService/GetRatingSummary"
+	LaptopService_TopRatedLaptops_FullMethodName          = "/pcbook.LaptopService/TopRatedLaptops"
+	LaptopService_RebuildRatings_FullMethodName           = "/pcbook.LaptopService/RebuildRatings"
+	LaptopService_ListQuarantinedRatings_FullMethodName   = "/pcbook.LaptopService/ListQuarantinedRatings"
+	LaptopService_ApproveQuarantinedRating_FullMethodName = "/pcbook.LaptopService/ApproveQuarantinedRating"
+	LaptopService_RejectQuarantinedRating_FullMethodName  = "/pcbook.LaptopService/RejectQuarantinedRating"
+	LaptopService_WatchRatings_FullMethodName             = "/pcbook.LaptopService/WatchRatings"
 )
 
 // LaptopServiceClient is the client API for LaptopService service.
@@ -32,7 +51,26 @@ type LaptopServiceClient interface {
 	CreateLaptop(ctx context.Context, in *CreateLaptopRequest, opts ...grpc.CallOption) (*CreateLaptopResponse, error)
 	SearchLaptop(ctx context.Context, in *SearchLaptopRequest, opts ...grpc.CallOption) (LaptopService_SearchLaptopClient, error)
 	UploadImage(ctx context.Context, opts ...grpc.CallOption) (LaptopService_UploadImageClient, error)
+	StartImageUpload(ctx context.Context, in *StartImageUploadRequest, opts ...grpc.CallOption) (*StartImageUploadResponse, error)
+	QueryUploadStatus(ctx context.Context, in *QueryUploadStatusRequest, opts ...grpc.CallOption) (*QueryUploadStatusResponse, error)
 	RateLaptop(ctx context.Context, opts ...grpc.CallOption) (LaptopService_RateLaptopClient, error)
+	DeleteLaptop(ctx context.Context, in *DeleteLaptopRequest, opts ...grpc.CallOption) (*DeleteLaptopResponse, error)
+	GetImageInfo(ctx context.Context, in *GetImageInfoRequest, opts ...grpc.CallOption) (*GetImageInfoResponse, error)
+	GetImageRendition(ctx context.Context, in *GetImageRenditionRequest, opts ...grpc.CallOption) (LaptopService_GetImageRenditionClient, error)
+	ListLaptopImages(ctx context.Context, in *ListLaptopImagesRequest, opts ...grpc.CallOption) (*ListLaptopImagesResponse, error)
+	DeleteImage(ctx context.Context, in *DeleteImageRequest, opts ...grpc.CallOption) (*DeleteImageResponse, error)
+	ReorderImages(ctx context.Context, in *ReorderImagesRequest, opts ...grpc.CallOption) (*ReorderImagesResponse, error)
+	SetPrimaryImage(ctx context.Context, in *SetPrimaryImageRequest, opts ...grpc.CallOption) (*SetPrimaryImageResponse, error)
+	UpdateImage(ctx context.Context, in *UpdateImageRequest, opts ...grpc.CallOption) (*UpdateImageResponse, error)
+	GetImageUsage(ctx context.Context, in *GetImageUsageRequest, opts ...grpc.CallOption) (*GetImageUsageResponse, error)
+	CollectImageGarbage(ctx context.Context, in *CollectImageGarbageRequest, opts ...grpc.CallOption) (*CollectImageGarbageResponse, error)
+	GetRatingSummary(ctx context.Context, in *GetRatingSummaryRequest, opts ...grpc.CallOption) (*GetRatingSummaryResponse, error)
+	TopRatedLaptops(ctx context.Context, in *TopRatedLaptopsRequest, opts ...grpc.CallOption) (LaptopService_TopRatedLaptopsClient, error)
+	RebuildRatings(ctx context.Context, in *RebuildRatingsRequest, opts ...grpc.CallOption) (*RebuildRatingsResponse, error)
+	ListQuarantinedRatings(ctx context.Context, in *ListQuarantinedRatingsRequest, opts ...grpc.CallOption) (*ListQuarantinedRatingsResponse, error)
+	ApproveQuarantinedRating(ctx context.Context, in *ApproveQuarantinedRatingRequest, opts ...grpc.CallOption) (*ApproveQuarantinedRatingResponse, error)
+	RejectQuarantinedRating(ctx context.Context, in *RejectQuarantinedRatingRequest, opts ...grpc.CallOption) (*RejectQuarantinedRatingResponse, error)
+	WatchRatings(ctx context.Context, in *WatchRatingsRequest, opts ...grpc.CallOption) (LaptopService_WatchRatingsClient, error)
 }
 
 type laptopServiceClient struct {
@@ -121,6 +159,26 @@ func (x *laptopServiceUploadImageClient) CloseAndRecv() (*UploadImageResponse, e
 	return m, nil
 }
 
+func (c *laptopServiceClient) StartImageUpload(ctx context.Context, in *StartImageUploadRequest, opts ...grpc.CallOption) (*StartImageUploadResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(StartImageUploadResponse)
+	err := c.cc.Invoke(ctx, LaptopService_StartImageUpload_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *laptopServiceClient) QueryUploadStatus(ctx context.Context, in *QueryUploadStatusRequest, opts ...grpc.CallOption) (*QueryUploadStatusResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(QueryUploadStatusResponse)
+	err := c.cc.Invoke(ctx, LaptopService_QueryUploadStatus_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *laptopServiceClient) RateLaptop(ctx context.Context, opts ...grpc.CallOption) (LaptopService_RateLaptopClient, error) {
 	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
 	stream, err := c.cc.NewStream(ctx, &LaptopService_ServiceDesc.Streams[2], LaptopService_RateLaptop_FullMethodName, cOpts...)
@@ -153,6 +211,245 @@ func (x *laptopServiceRateLaptopClient) Recv() (*RateLaptopResponse, error) {
 	return m, nil
 }
 
+func (c *laptopServiceClient) DeleteLaptop(ctx context.Context, in *DeleteLaptopRequest, opts ...grpc.CallOption) (*DeleteLaptopResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DeleteLaptopResponse)
+	err := c.cc.Invoke(ctx, LaptopService_DeleteLaptop_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *laptopServiceClient) GetImageInfo(ctx context.Context, in *GetImageInfoRequest, opts ...grpc.CallOption) (*GetImageInfoResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetImageInfoResponse)
+	err := c.cc.Invoke(ctx, LaptopService_GetImageInfo_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *laptopServiceClient) GetImageRendition(ctx context.Context, in *GetImageRenditionRequest, opts ...grpc.CallOption) (LaptopService_GetImageRenditionClient, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &LaptopService_ServiceDesc.Streams[3], LaptopService_GetImageRendition_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &laptopServiceGetImageRenditionClient{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type LaptopService_GetImageRenditionClient interface {
+	Recv() (*GetImageRenditionResponse, error)
+	grpc.ClientStream
+}
+
+type laptopServiceGetImageRenditionClient struct {
+	grpc.ClientStream
+}
+
+func (x *laptopServiceGetImageRenditionClient) Recv() (*GetImageRenditionResponse, error) {
+	m := new(GetImageRenditionResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *laptopServiceClient) ListLaptopImages(ctx context.Context, in *ListLaptopImagesRequest, opts ...grpc.CallOption) (*ListLaptopImagesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListLaptopImagesResponse)
+	err := c.cc.Invoke(ctx, LaptopService_ListLaptopImages_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *laptopServiceClient) DeleteImage(ctx context.Context, in *DeleteImageRequest, opts ...grpc.CallOption) (*DeleteImageResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DeleteImageResponse)
+	err := c.cc.Invoke(ctx, LaptopService_DeleteImage_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *laptopServiceClient) ReorderImages(ctx context.Context, in *ReorderImagesRequest, opts ...grpc.CallOption) (*ReorderImagesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ReorderImagesResponse)
+	err := c.cc.Invoke(ctx, LaptopService_ReorderImages_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *laptopServiceClient) SetPrimaryImage(ctx context.Context, in *SetPrimaryImageRequest, opts ...grpc.CallOption) (*SetPrimaryImageResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SetPrimaryImageResponse)
+	err := c.cc.Invoke(ctx, LaptopService_SetPrimaryImage_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *laptopServiceClient) UpdateImage(ctx context.Context, in *UpdateImageRequest, opts ...grpc.CallOption) (*UpdateImageResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(UpdateImageResponse)
+	err := c.cc.Invoke(ctx, LaptopService_UpdateImage_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *laptopServiceClient) GetImageUsage(ctx context.Context, in *GetImageUsageRequest, opts ...grpc.CallOption) (*GetImageUsageResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetImageUsageResponse)
+	err := c.cc.Invoke(ctx, LaptopService_GetImageUsage_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *laptopServiceClient) CollectImageGarbage(ctx context.Context, in *CollectImageGarbageRequest, opts ...grpc.CallOption) (*CollectImageGarbageResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CollectImageGarbageResponse)
+	err := c.cc.Invoke(ctx, LaptopService_CollectImageGarbage_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *laptopServiceClient) GetRatingSummary(ctx context.Context, in *GetRatingSummaryRequest, opts ...grpc.CallOption) (*GetRatingSummaryResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetRatingSummaryResponse)
+	err := c.cc.Invoke(ctx, LaptopService_GetRatingSummary_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *laptopServiceClient) TopRatedLaptops(ctx context.Context, in *TopRatedLaptopsRequest, opts ...grpc.CallOption) (LaptopService_TopRatedLaptopsClient, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &LaptopService_ServiceDesc.Streams[4], LaptopService_TopRatedLaptops_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &laptopServiceTopRatedLaptopsClient{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type LaptopService_TopRatedLaptopsClient interface {
+	Recv() (*TopRatedLaptopsResponse, error)
+	grpc.ClientStream
+}
+
+type laptopServiceTopRatedLaptopsClient struct {
+	grpc.ClientStream
+}
+
+func (x *laptopServiceTopRatedLaptopsClient) Recv() (*TopRatedLaptopsResponse, error) {
+	m := new(TopRatedLaptopsResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *laptopServiceClient) RebuildRatings(ctx context.Context, in *RebuildRatingsRequest, opts ...grpc.CallOption) (*RebuildRatingsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(RebuildRatingsResponse)
+	err := c.cc.Invoke(ctx, LaptopService_RebuildRatings_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *laptopServiceClient) ListQuarantinedRatings(ctx context.Context, in *ListQuarantinedRatingsRequest, opts ...grpc.CallOption) (*ListQuarantinedRatingsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListQuarantinedRatingsResponse)
+	err := c.cc.Invoke(ctx, LaptopService_ListQuarantinedRatings_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *laptopServiceClient) ApproveQuarantinedRating(ctx context.Context, in *ApproveQuarantinedRatingRequest, opts ...grpc.CallOption) (*ApproveQuarantinedRatingResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ApproveQuarantinedRatingResponse)
+	err := c.cc.Invoke(ctx, LaptopService_ApproveQuarantinedRating_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *laptopServiceClient) RejectQuarantinedRating(ctx context.Context, in *RejectQuarantinedRatingRequest, opts ...grpc.CallOption) (*RejectQuarantinedRatingResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(RejectQuarantinedRatingResponse)
+	err := c.cc.Invoke(ctx, LaptopService_RejectQuarantinedRating_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *laptopServiceClient) WatchRatings(ctx context.Context, in *WatchRatingsRequest, opts ...grpc.CallOption) (LaptopService_WatchRatingsClient, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &LaptopService_ServiceDesc.Streams[5], LaptopService_WatchRatings_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &laptopServiceWatchRatingsClient{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type LaptopService_WatchRatingsClient interface {
+	Recv() (*WatchRatingsResponse, error)
+	grpc.ClientStream
+}
+
+type laptopServiceWatchRatingsClient struct {
+	grpc.ClientStream
+}
+
+func (x *laptopServiceWatchRatingsClient) Recv() (*WatchRatingsResponse, error) {
+	m := new(WatchRatingsResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // LaptopServiceServer is the server API for LaptopService service.
 // All implementations must embed UnimplementedLaptopServiceServer
 // for forward compatibility
@@ -160,7 +457,26 @@ type LaptopServiceServer interface {
 	CreateLaptop(context.Context, *CreateLaptopRequest) (*CreateLaptopResponse, error)
 	SearchLaptop(*SearchLaptopRequest, LaptopService_SearchLaptopServer) error
 	UploadImage(LaptopService_UploadImageServer) error
+	StartImageUpload(context.Context, *StartImageUploadRequest) (*StartImageUploadResponse, error)
+	QueryUploadStatus(context.Context, *QueryUploadStatusRequest) (*QueryUploadStatusResponse, error)
 	RateLaptop(LaptopService_RateLaptopServer) error
+	DeleteLaptop(context.Context, *DeleteLaptopRequest) (*DeleteLaptopResponse, error)
+	GetImageInfo(context.Context, *GetImageInfoRequest) (*GetImageInfoResponse, error)
+	GetImageRendition(*GetImageRenditionRequest, LaptopService_GetImageRenditionServer) error
+	ListLaptopImages(context.Context, *ListLaptopImagesRequest) (*ListLaptopImagesResponse, error)
+	DeleteImage(context.Context, *DeleteImageRequest) (*DeleteImageResponse, error)
+	ReorderImages(context.Context, *ReorderImagesRequest) (*ReorderImagesResponse, error)
+	SetPrimaryImage(context.Context, *SetPrimaryImageRequest) (*SetPrimaryImageResponse, error)
+	UpdateImage(context.Context, *UpdateImageRequest) (*UpdateImageResponse, error)
+	GetImageUsage(context.Context, *GetImageUsageRequest) (*GetImageUsageResponse, error)
+	CollectImageGarbage(context.Context, *CollectImageGarbageRequest) (*CollectImageGarbageResponse, error)
+	GetRatingSummary(context.Context, *GetRatingSummaryRequest) (*GetRatingSummaryResponse, error)
+	TopRatedLaptops(*TopRatedLaptopsRequest, LaptopService_TopRatedLaptopsServer) error
+	RebuildRatings(context.Context, *RebuildRatingsRequest) (*RebuildRatingsResponse, error)
+	ListQuarantinedRatings(context.Context, *ListQuarantinedRatingsRequest) (*ListQuarantinedRatingsResponse, error)
+	ApproveQuarantinedRating(context.Context, *ApproveQuarantinedRatingRequest) (*ApproveQuarantinedRatingResponse, error)
+	RejectQuarantinedRating(context.Context, *RejectQuarantinedRatingRequest) (*RejectQuarantinedRatingResponse, error)
+	WatchRatings(*WatchRatingsRequest, LaptopService_WatchRatingsServer) error
 	mustEmbedUnimplementedLaptopServiceServer()
 }
 
@@ -177,9 +493,66 @@ func (UnimplementedLaptopServiceServer) SearchLaptop(*SearchLaptopRequest, Lapto
 func (UnimplementedLaptopServiceServer) UploadImage(LaptopService_UploadImageServer) error {
 	return status.Errorf(codes.Unimplemented, "method UploadImage not implemented")
 }
+func (UnimplementedLaptopServiceServer) StartImageUpload(context.Context, *StartImageUploadRequest) (*StartImageUploadResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method StartImageUpload not implemented")
+}
+func (UnimplementedLaptopServiceServer) QueryUploadStatus(context.Context, *QueryUploadStatusRequest) (*QueryUploadStatusResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method QueryUploadStatus not implemented")
+}
 func (UnimplementedLaptopServiceServer) RateLaptop(LaptopService_RateLaptopServer) error {
 	return status.Errorf(codes.Unimplemented, "method RateLaptop not implemented")
 }
+func (UnimplementedLaptopServiceServer) DeleteLaptop(context.Context, *DeleteLaptopRequest) (*DeleteLaptopResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteLaptop not implemented")
+}
+func (UnimplementedLaptopServiceServer) GetImageInfo(context.Context, *GetImageInfoRequest) (*GetImageInfoResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetImageInfo not implemented")
+}
+func (UnimplementedLaptopServiceServer) GetImageRendition(*GetImageRenditionRequest, LaptopService_GetImageRenditionServer) error {
+	return status.Errorf(codes.Unimplemented, "method GetImageRendition not implemented")
+}
+func (UnimplementedLaptopServiceServer) ListLaptopImages(context.Context, *ListLaptopImagesRequest) (*ListLaptopImagesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListLaptopImages not implemented")
+}
+func (UnimplementedLaptopServiceServer) DeleteImage(context.Context, *DeleteImageRequest) (*DeleteImageResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteImage not implemented")
+}
+func (UnimplementedLaptopServiceServer) ReorderImages(context.Context, *ReorderImagesRequest) (*ReorderImagesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ReorderImages not implemented")
+}
+func (UnimplementedLaptopServiceServer) SetPrimaryImage(context.Context, *SetPrimaryImageRequest) (*SetPrimaryImageResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetPrimaryImage not implemented")
+}
+func (UnimplementedLaptopServiceServer) UpdateImage(context.Context, *UpdateImageRequest) (*UpdateImageResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateImage not implemented")
+}
+func (UnimplementedLaptopServiceServer) GetImageUsage(context.Context, *GetImageUsageRequest) (*GetImageUsageResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetImageUsage not implemented")
+}
+func (UnimplementedLaptopServiceServer) CollectImageGarbage(context.Context, *CollectImageGarbageRequest) (*CollectImageGarbageResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CollectImageGarbage not implemented")
+}
+func (UnimplementedLaptopServiceServer) GetRatingSummary(context.Context, *GetRatingSummaryRequest) (*GetRatingSummaryResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetRatingSummary not implemented")
+}
+func (UnimplementedLaptopServiceServer) TopRatedLaptops(*TopRatedLaptopsRequest, LaptopService_TopRatedLaptopsServer) error {
+	return status.Errorf(codes.Unimplemented, "method TopRatedLaptops not implemented")
+}
+func (UnimplementedLaptopServiceServer) RebuildRatings(context.Context, *RebuildRatingsRequest) (*RebuildRatingsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RebuildRatings not implemented")
+}
+func (UnimplementedLaptopServiceServer) ListQuarantinedRatings(context.Context, *ListQuarantinedRatingsRequest) (*ListQuarantinedRatingsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListQuarantinedRatings not implemented")
+}
+func (UnimplementedLaptopServiceServer) ApproveQuarantinedRating(context.Context, *ApproveQuarantinedRatingRequest) (*ApproveQuarantinedRatingResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ApproveQuarantinedRating not implemented")
+}
+func (UnimplementedLaptopServiceServer) RejectQuarantinedRating(context.Context, *RejectQuarantinedRatingRequest) (*RejectQuarantinedRatingResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RejectQuarantinedRating not implemented")
+}
+func (UnimplementedLaptopServiceServer) WatchRatings(*WatchRatingsRequest, LaptopService_WatchRatingsServer) error {
+	return status.Errorf(codes.Unimplemented, "method WatchRatings not implemented")
+}
 func (UnimplementedLaptopServiceServer) mustEmbedUnimplementedLaptopServiceServer() {}
 
 // UnsafeLaptopServiceServer may be embedded to opt out of forward compatibility for this service.
@@ -258,6 +631,42 @@ func (x *laptopServiceUploadImageServer) Recv() (*UploadImageRequest, error) {
 	return m, nil
 }
 
+func _LaptopService_StartImageUpload_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(StartImageUploadRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LaptopServiceServer).StartImageUpload(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: LaptopService_StartImageUpload_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LaptopServiceServer).StartImageUpload(ctx, req.(*StartImageUploadRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LaptopService_QueryUploadStatus_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(QueryUploadStatusRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LaptopServiceServer).QueryUploadStatus(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: LaptopService_QueryUploadStatus_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LaptopServiceServer).QueryUploadStatus(ctx, req.(*QueryUploadStatusRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 func _LaptopService_RateLaptop_Handler(srv interface{}, stream grpc.ServerStream) error {
 	return srv.(LaptopServiceServer).RateLaptop(&laptopServiceRateLaptopServer{ServerStream: stream})
 }
@@ -284,6 +693,321 @@ func (x *laptopServiceRateLaptopServer) Recv() (*RateLaptopRequest, error) {
 	return m, nil
 }
 
+func _LaptopService_DeleteLaptop_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteLaptopRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LaptopServiceServer).DeleteLaptop(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: LaptopService_DeleteLaptop_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LaptopServiceServer).DeleteLaptop(ctx, req.(*DeleteLaptopRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LaptopService_GetImageInfo_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetImageInfoRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LaptopServiceServer).GetImageInfo(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: LaptopService_GetImageInfo_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LaptopServiceServer).GetImageInfo(ctx, req.(*GetImageInfoRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LaptopService_GetImageRendition_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(GetImageRenditionRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(LaptopServiceServer).GetImageRendition(m, &laptopServiceGetImageRenditionServer{ServerStream: stream})
+}
+
+type LaptopService_GetImageRenditionServer interface {
+	Send(*GetImageRenditionResponse) error
+	grpc.ServerStream
+}
+
+type laptopServiceGetImageRenditionServer struct {
+	grpc.ServerStream
+}
+
+func (x *laptopServiceGetImageRenditionServer) Send(m *GetImageRenditionResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _LaptopService_ListLaptopImages_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListLaptopImagesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LaptopServiceServer).ListLaptopImages(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: LaptopService_ListLaptopImages_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LaptopServiceServer).ListLaptopImages(ctx, req.(*ListLaptopImagesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LaptopService_DeleteImage_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteImageRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LaptopServiceServer).DeleteImage(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: LaptopService_DeleteImage_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LaptopServiceServer).DeleteImage(ctx, req.(*DeleteImageRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LaptopService_ReorderImages_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReorderImagesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LaptopServiceServer).ReorderImages(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: LaptopService_ReorderImages_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LaptopServiceServer).ReorderImages(ctx, req.(*ReorderImagesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LaptopService_SetPrimaryImage_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetPrimaryImageRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LaptopServiceServer).SetPrimaryImage(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: LaptopService_SetPrimaryImage_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LaptopServiceServer).SetPrimaryImage(ctx, req.(*SetPrimaryImageRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LaptopService_UpdateImage_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateImageRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LaptopServiceServer).UpdateImage(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: LaptopService_UpdateImage_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LaptopServiceServer).UpdateImage(ctx, req.(*UpdateImageRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LaptopService_GetImageUsage_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetImageUsageRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LaptopServiceServer).GetImageUsage(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: LaptopService_GetImageUsage_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LaptopServiceServer).GetImageUsage(ctx, req.(*GetImageUsageRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LaptopService_CollectImageGarbage_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CollectImageGarbageRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LaptopServiceServer).CollectImageGarbage(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: LaptopService_CollectImageGarbage_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LaptopServiceServer).CollectImageGarbage(ctx, req.(*CollectImageGarbageRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LaptopService_GetRatingSummary_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetRatingSummaryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LaptopServiceServer).GetRatingSummary(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: LaptopService_GetRatingSummary_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LaptopServiceServer).GetRatingSummary(ctx, req.(*GetRatingSummaryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LaptopService_TopRatedLaptops_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(TopRatedLaptopsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(LaptopServiceServer).TopRatedLaptops(m, &laptopServiceTopRatedLaptopsServer{ServerStream: stream})
+}
+
+type LaptopService_TopRatedLaptopsServer interface {
+	Send(*TopRatedLaptopsResponse) error
+	grpc.ServerStream
+}
+
+type laptopServiceTopRatedLaptopsServer struct {
+	grpc.ServerStream
+}
+
+func (x *laptopServiceTopRatedLaptopsServer) Send(m *TopRatedLaptopsResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _LaptopService_RebuildRatings_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RebuildRatingsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LaptopServiceServer).RebuildRatings(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: LaptopService_RebuildRatings_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LaptopServiceServer).RebuildRatings(ctx, req.(*RebuildRatingsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LaptopService_ListQuarantinedRatings_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListQuarantinedRatingsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LaptopServiceServer).ListQuarantinedRatings(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: LaptopService_ListQuarantinedRatings_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LaptopServiceServer).ListQuarantinedRatings(ctx, req.(*ListQuarantinedRatingsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LaptopService_ApproveQuarantinedRating_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ApproveQuarantinedRatingRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LaptopServiceServer).ApproveQuarantinedRating(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: LaptopService_ApproveQuarantinedRating_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LaptopServiceServer).ApproveQuarantinedRating(ctx, req.(*ApproveQuarantinedRatingRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LaptopService_RejectQuarantinedRating_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RejectQuarantinedRatingRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LaptopServiceServer).RejectQuarantinedRating(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: LaptopService_RejectQuarantinedRating_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LaptopServiceServer).RejectQuarantinedRating(ctx, req.(*RejectQuarantinedRatingRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LaptopService_WatchRatings_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchRatingsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(LaptopServiceServer).WatchRatings(m, &laptopServiceWatchRatingsServer{ServerStream: stream})
+}
+
+type LaptopService_WatchRatingsServer interface {
+	Send(*WatchRatingsResponse) error
+	grpc.ServerStream
+}
+
+type laptopServiceWatchRatingsServer struct {
+	grpc.ServerStream
+}
+
+func (x *laptopServiceWatchRatingsServer) Send(m *WatchRatingsResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
 // LaptopService_ServiceDesc is the grpc.ServiceDesc for LaptopService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -295,6 +1019,70 @@ var LaptopService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "CreateLaptop",
 			Handler:    _LaptopService_CreateLaptop_Handler,
 		},
+		{
+			MethodName: "StartImageUpload",
+			Handler:    _LaptopService_StartImageUpload_Handler,
+		},
+		{
+			MethodName: "QueryUploadStatus",
+			Handler:    _LaptopService_QueryUploadStatus_Handler,
+		},
+		{
+			MethodName: "DeleteLaptop",
+			Handler:    _LaptopService_DeleteLaptop_Handler,
+		},
+		{
+			MethodName: "GetImageInfo",
+			Handler:    _LaptopService_GetImageInfo_Handler,
+		},
+		{
+			MethodName: "ListLaptopImages",
+			Handler:    _LaptopService_ListLaptopImages_Handler,
+		},
+		{
+			MethodName: "DeleteImage",
+			Handler:    _LaptopService_DeleteImage_Handler,
+		},
+		{
+			MethodName: "ReorderImages",
+			Handler:    _LaptopService_ReorderImages_Handler,
+		},
+		{
+			MethodName: "SetPrimaryImage",
+			Handler:    _LaptopService_SetPrimaryImage_Handler,
+		},
+		{
+			MethodName: "UpdateImage",
+			Handler:    _LaptopService_UpdateImage_Handler,
+		},
+		{
+			MethodName: "GetImageUsage",
+			Handler:    _LaptopService_GetImageUsage_Handler,
+		},
+		{
+			MethodName: "CollectImageGarbage",
+			Handler:    _LaptopService_CollectImageGarbage_Handler,
+		},
+		{
+			MethodName: "GetRatingSummary",
+			Handler:    _LaptopService_GetRatingSummary_Handler,
+		},
+		{
+			MethodName: "RebuildRatings",
+			Handler:    _LaptopService_RebuildRatings_Handler,
+		},
+		{
+			MethodName: "ListQuarantinedRatings",
+			Handler:    _LaptopService_ListQuarantinedRatings_Handler,
+		},
+		{
+			MethodName: "ApproveQuarantinedRating",
+			Handler:    _LaptopService_ApproveQuarantinedRating_Handler,
+		},
+		{
+			MethodName: "RejectQuarantinedRating",
+			Handler:    _LaptopService_RejectQuarantinedRating_Handler,
+		},
 	},
 	Streams: []grpc.StreamDesc{
 		{
@@ -313,6 +1101,21 @@ var LaptopService_ServiceDesc = grpc.ServiceDesc{
 			ServerStreams: true,
 			ClientStreams: true,
 		},
+		{
+			StreamName:    "GetImageRendition",
+			Handler:       _LaptopService_GetImageRendition_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "TopRatedLaptops",
+			Handler:       _LaptopService_TopRatedLaptops_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "WatchRatings",
+			Handler:       _LaptopService_WatchRatings_Handler,
+			ServerStreams: true,
+		},
 	},
 	Metadata: "laptop_service.proto",
 }
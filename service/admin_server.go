@@ -0,0 +1,172 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/Dostonlv/pcbook/pb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// AdminServer manages the users of the tenant of the calling admin.
+type AdminServer struct {
+	pb.UnimplementedAdminServiceServer
+	userStore UserStore
+}
+
+func NewAdminServer(userStore UserStore) *AdminServer {
+	return &AdminServer{
+		userStore: userStore,
+	}
+}
+
+func (server *AdminServer) AddUser(ctx context.Context, req *pb.AddUserRequest) (*pb.AddUserResponse, error) {
+	tenant := TenantFromContext(ctx)
+	log.Printf("receive an add-user request for %s in tenant %s", req.GetUsername(), tenant)
+
+	if req.GetUsername() == "" || req.GetPassword() == "" {
+		return nil, status.Error(codes.InvalidArgument, "username and password are required")
+	}
+	if err := checkGrantableRole(ctx, req.GetRole()); err != nil {
+		return nil, err
+	}
+
+	user, err := NewUser(tenant, req.GetUsername(), req.GetPassword(), req.GetRole())
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot create user: %v", err)
+	}
+
+	err = server.userStore.Save(user)
+	if err != nil {
+		return nil, errorLog(userStoreError(err, "cannot save user"))
+	}
+	return &pb.AddUserResponse{}, nil
+}
+
+func (server *AdminServer) RemoveUser(ctx context.Context, req *pb.RemoveUserRequest) (*pb.RemoveUserResponse, error) {
+	tenant := TenantFromContext(ctx)
+	log.Printf("receive a remove-user request for %s in tenant %s", req.GetUsername(), tenant)
+
+	_, err := server.findManagedUser(ctx, tenant, req.GetUsername())
+	if err != nil {
+		return nil, err
+	}
+
+	err = server.userStore.Delete(tenant, req.GetUsername())
+	if err != nil {
+		return nil, errorLog(userStoreError(err, "cannot remove user"))
+	}
+	return &pb.RemoveUserResponse{}, nil
+}
+
+func (server *AdminServer) ListUsers(ctx context.Context, req *pb.ListUsersRequest) (*pb.ListUsersResponse, error) {
+	users, err := server.userStore.List(TenantFromContext(ctx))
+	if err != nil {
+		return nil, errorLog(status.Errorf(codes.Internal, "cannot list users: %v", err))
+	}
+
+	res := &pb.ListUsersResponse{}
+	for _, user := range users {
+		res.Users = append(res.Users, &pb.User{
+			Username: user.Username,
+			Role:     user.Role,
+		})
+	}
+	return res, nil
+}
+
+func (server *AdminServer) ResetPassword(ctx context.Context, req *pb.ResetPasswordRequest) (*pb.ResetPasswordResponse, error) {
+	tenant := TenantFromContext(ctx)
+	log.Printf("receive a reset-password request for %s in tenant %s", req.GetUsername(), tenant)
+
+	if req.GetPassword() == "" {
+		return nil, status.Error(codes.InvalidArgument, "password is required")
+	}
+
+	err := server.updateUser(ctx, tenant, req.GetUsername(), func(user *User) error {
+		return user.SetPassword(req.GetPassword())
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &pb.ResetPasswordResponse{}, nil
+}
+
+func (server *AdminServer) ChangeRole(ctx context.Context, req *pb.ChangeRoleRequest) (*pb.ChangeRoleResponse, error) {
+	tenant := TenantFromContext(ctx)
+	log.Printf("receive a change-role request for %s in tenant %s", req.GetUsername(), tenant)
+
+	if err := checkGrantableRole(ctx, req.GetRole()); err != nil {
+		return nil, err
+	}
+
+	err := server.updateUser(ctx, tenant, req.GetUsername(), func(user *User) error {
+		user.Role = req.GetRole()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &pb.ChangeRoleResponse{}, nil
+}
+
+func (server *AdminServer) updateUser(ctx context.Context, tenant string, username string, update func(user *User) error) error {
+	user, err := server.findManagedUser(ctx, tenant, username)
+	if err != nil {
+		return err
+	}
+
+	err = update(user)
+	if err != nil {
+		return errorLog(status.Errorf(codes.Internal, "cannot update user: %v", err))
+	}
+
+	err = server.userStore.Update(user)
+	if err != nil {
+		return errorLog(userStoreError(err, "cannot update user"))
+	}
+	return nil
+}
+
+// findManagedUser returns the user if the caller may manage them, only a superadmin can manage a superadmin.
+func (server *AdminServer) findManagedUser(ctx context.Context, tenant string, username string) (*User, error) {
+	user, err := server.userStore.Find(tenant, username)
+	if err != nil {
+		return nil, errorLog(status.Errorf(codes.Internal, "cannot find user: %v", err))
+	}
+	if user == nil {
+		return nil, errorLog(status.Errorf(codes.NotFound, "user %s is not found", username))
+	}
+
+	claims := ClaimsFromContext(ctx)
+	if user.Role == "superadmin" && (claims == nil || claims.Role != "superadmin") {
+		return nil, errorLog(status.Errorf(codes.PermissionDenied, "only a superadmin can manage the superadmin %s", username))
+	}
+	return user, nil
+}
+
+// checkGrantableRole makes sure only a superadmin can hand out the superadmin role.
+func checkGrantableRole(ctx context.Context, role string) error {
+	if err := ValidateRole(role); err != nil {
+		return status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+
+	claims := ClaimsFromContext(ctx)
+	if role == "superadmin" && (claims == nil || claims.Role != "superadmin") {
+		return status.Error(codes.PermissionDenied, "only a superadmin can grant the superadmin role")
+	}
+	return nil
+}
+
+func userStoreError(err error, message string) error {
+	code := codes.Internal
+	switch {
+	case errors.Is(err, ErrAlreadyExists):
+		code = codes.AlreadyExists
+	case errors.Is(err, ErrNotFound):
+		code = codes.NotFound
+	}
+	return status.Errorf(code, "%s: %v", message, err)
+}
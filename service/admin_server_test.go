@@ -0,0 +1,96 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Dostonlv/pcbook/pb"
+	"github.com/Dostonlv/pcbook/service"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// newTestAdminServer returns a server managing admin1, user1 and superadmin1,
+// with the contexts of admin1 and superadmin1.
+func newTestAdminServer(t *testing.T) (*service.AdminServer, service.UserStore, context.Context, context.Context) {
+	userStore := service.NewInMemoryUserStore()
+	for username, role := range map[string]string{"admin1": "admin", "user1": "user", "superadmin1": "superadmin"} {
+		user, err := service.NewUser(service.DefaultTenant, username, "secret", role)
+		require.NoError(t, err)
+		require.NoError(t, userStore.Save(user))
+	}
+
+	adminCtx := service.ContextWithClaims(context.Background(), &service.UserClaims{Username: "admin1", Role: "admin", Tenant: service.DefaultTenant})
+	superadminCtx := service.ContextWithClaims(context.Background(), &service.UserClaims{Username: "superadmin1", Role: "superadmin", Tenant: service.DefaultTenant})
+	return service.NewAdminServer(userStore), userStore, adminCtx, superadminCtx
+}
+
+func TestAdminServerRemoveUser(t *testing.T) {
+	t.Parallel()
+
+	server, userStore, adminCtx, superadminCtx := newTestAdminServer(t)
+
+	_, err := server.RemoveUser(adminCtx, &pb.RemoveUserRequest{Username: "superadmin1"})
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+	user, err := userStore.Find(service.DefaultTenant, "superadmin1")
+	require.NoError(t, err)
+	require.NotNil(t, user)
+
+	_, err = server.RemoveUser(adminCtx, &pb.RemoveUserRequest{Username: "user1"})
+	require.NoError(t, err)
+	_, err = server.RemoveUser(adminCtx, &pb.RemoveUserRequest{Username: "user1"})
+	require.Equal(t, codes.NotFound, status.Code(err))
+
+	_, err = server.RemoveUser(superadminCtx, &pb.RemoveUserRequest{Username: "superadmin1"})
+	require.NoError(t, err)
+}
+
+func TestAdminServerResetPassword(t *testing.T) {
+	t.Parallel()
+
+	server, userStore, adminCtx, superadminCtx := newTestAdminServer(t)
+	requirePassword := func(username string, password string) {
+		user, err := userStore.Find(service.DefaultTenant, username)
+		require.NoError(t, err)
+		require.True(t, user.IsCorrectPassword(password))
+	}
+
+	_, err := server.ResetPassword(adminCtx, &pb.ResetPasswordRequest{Username: "superadmin1", Password: "hijacked"})
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+	requirePassword("superadmin1", "secret")
+
+	_, err = server.ResetPassword(adminCtx, &pb.ResetPasswordRequest{Username: "user1", Password: "changed"})
+	require.NoError(t, err)
+	requirePassword("user1", "changed")
+
+	_, err = server.ResetPassword(superadminCtx, &pb.ResetPasswordRequest{Username: "superadmin1", Password: "changed"})
+	require.NoError(t, err)
+	requirePassword("superadmin1", "changed")
+}
+
+func TestAdminServerChangeRole(t *testing.T) {
+	t.Parallel()
+
+	server, userStore, adminCtx, superadminCtx := newTestAdminServer(t)
+	requireRole := func(username string, role string) {
+		user, err := userStore.Find(service.DefaultTenant, username)
+		require.NoError(t, err)
+		require.Equal(t, role, user.Role)
+	}
+
+	_, err := server.ChangeRole(adminCtx, &pb.ChangeRoleRequest{Username: "superadmin1", Role: "user"})
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+	requireRole("superadmin1", "superadmin")
+
+	_, err = server.ChangeRole(adminCtx, &pb.ChangeRoleRequest{Username: "user1", Role: "superadmin"})
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	_, err = server.ChangeRole(adminCtx, &pb.ChangeRoleRequest{Username: "user1", Role: "admin"})
+	require.NoError(t, err)
+	requireRole("user1", "admin")
+
+	_, err = server.ChangeRole(superadminCtx, &pb.ChangeRoleRequest{Username: "superadmin1", Role: "admin"})
+	require.NoError(t, err)
+	requireRole("superadmin1", "admin")
+}
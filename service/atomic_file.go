@@ -0,0 +1,79 @@
+package service
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// writeFileAtomic writes data to a temporary file next to filename,
+// syncs it and renames it over filename, so readers never see a partial file.
+// Temporary files left behind by a crash contain ".tmp-" in their name.
+func writeFileAtomic(filename string, data []byte, perm os.FileMode) error {
+	file, err := createTempFile(filename)
+	if err != nil {
+		return err
+	}
+
+	_, err = file.Write(data)
+	if err != nil {
+		file.abort()
+		return fmt.Errorf("cannot write %s: %w", filename, err)
+	}
+	return file.commit(filename, perm)
+}
+
+// tempFile is written incrementally and renamed into place once it's complete.
+type tempFile struct {
+	*os.File
+}
+
+// createTempFile creates a temporary file in the folder of filename, named after it.
+func createTempFile(filename string) (*tempFile, error) {
+	file, err := os.CreateTemp(filepath.Dir(filename), filepath.Base(filename)+".tmp-*")
+	if err != nil {
+		return nil, fmt.Errorf("cannot create temp file: %w", err)
+	}
+	return &tempFile{File: file}, nil
+}
+
+// commit syncs the file and renames it to filename, the file is removed if that fails.
+func (file *tempFile) commit(filename string, perm os.FileMode) error {
+	tempName := file.Name()
+
+	err := file.Sync()
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tempName, perm)
+	}
+	if err == nil {
+		err = os.Rename(tempName, filename)
+	}
+	if err != nil {
+		os.Remove(tempName)
+		return fmt.Errorf("cannot write %s: %w", filename, err)
+	}
+	return syncDir(filepath.Dir(filename))
+}
+
+func (file *tempFile) abort() {
+	file.Close()
+	os.Remove(file.Name())
+}
+
+// syncDir makes a rename in the folder durable.
+func syncDir(folder string) error {
+	dir, err := os.Open(folder)
+	if err != nil {
+		return fmt.Errorf("cannot open folder %s: %w", folder, err)
+	}
+	defer dir.Close()
+
+	err = dir.Sync()
+	if err != nil {
+		return fmt.Errorf("cannot sync folder %s: %w", folder, err)
+	}
+	return nil
+}
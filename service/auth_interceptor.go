@@ -25,7 +25,7 @@ func NewAuthInterceptor(jwtManager *JWTManager, accessibleRole map[string][]stri
 func (interceptor *AuthInterceptor) Unary() grpc.UnaryServerInterceptor {
 	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
 		log.Println("--> unary unaryInterceptor: ", info.FullMethod)
-		err := interceptor.authorize(ctx, info.FullMethod)
+		ctx, err := interceptor.authorize(ctx, info.FullMethod)
 		if err != nil {
 			return nil, err
 		}
@@ -37,39 +37,66 @@ func (interceptor *AuthInterceptor) Unary() grpc.UnaryServerInterceptor {
 func (interceptor *AuthInterceptor) Stream() grpc.StreamServerInterceptor {
 	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
 		log.Println("--> stream interceptor: ", info.FullMethod)
-		err := interceptor.authorize(ss.Context(), info.FullMethod)
+		ctx, err := interceptor.authorize(ss.Context(), info.FullMethod)
 		if err != nil {
 			return err
 		}
-		return handler(srv, ss)
+		return handler(srv, &authorizedStream{ServerStream: ss, ctx: ctx})
 	}
 
 }
-func (interceptor *AuthInterceptor) authorize(ctx context.Context, method string) error {
+
+// authorize checks that the caller may access the method, and returns
+// a context carrying the claims of the caller if a token is provided.
+func (interceptor *AuthInterceptor) authorize(ctx context.Context, method string) (context.Context, error) {
 	accessibleRoles, ok := interceptor.accessibleRole[method]
-	if !ok {
-		// everone access
-		return nil
-	}
-	md, ok := metadata.FromIncomingContext(ctx)
-	if !ok {
-		return status.Error(codes.Unauthenticated, "metadata is not provided")
-	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
 	values := md["authorization"]
 	if len(values) == 0 {
-		return status.Error(codes.Unauthenticated, "authorization is not provided")
+		if !ok {
+			// everone access
+			return ctx, nil
+		}
+		return nil, status.Error(codes.Unauthenticated, "authorization is not provided")
 	}
 
 	accessToken := values[0]
 	claims, err := interceptor.jwtManager.Verify(accessToken)
 	if err != nil {
-		return status.Errorf(codes.Unauthenticated, "authorization is invalid: %v", err)
+		return nil, status.Errorf(codes.Unauthenticated, "authorization is invalid: %v", err)
+	}
+
+	ctx = ContextWithClaims(ctx, claims)
+	if !ok {
+		return ctx, nil
 	}
 
 	for _, role := range accessibleRoles {
 		if role == claims.Role {
-			return nil
+			return ctx, nil
 		}
 	}
-	return status.Error(codes.PermissionDenied, "no permission to not access this RPC")
+	return nil, status.Error(codes.PermissionDenied, "no permission to not access this RPC")
+}
+
+type authorizedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (stream *authorizedStream) Context() context.Context {
+	return stream.ctx
+}
+
+type claimsKey struct{}
+
+func ContextWithClaims(ctx context.Context, claims *UserClaims) context.Context {
+	return context.WithValue(ctx, claimsKey{}, claims)
+}
+
+// ClaimsFromContext returns the claims of the authenticated user, or nil for anonymous requests.
+func ClaimsFromContext(ctx context.Context) *UserClaims {
+	claims, _ := ctx.Value(claimsKey{}).(*UserClaims)
+	return claims
 }
@@ -22,7 +22,12 @@ func NewAuthServer(userStore UserStore, jwtManager *JWTManager) *AuthServer {
 }
 
 func (authserver *AuthServer) Login(ctx context.Context, req *pb.LoginRequest) (*pb.LoginResponse, error) {
-	user, err := authserver.userStore.Find(req.Username)
+	tenant := req.GetTenant()
+	if tenant == "" {
+		tenant = DefaultTenant
+	}
+
+	user, err := authserver.userStore.Find(tenant, req.GetUsername())
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "cannot find user: %v", err)
 	}
@@ -0,0 +1,52 @@
+package service
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// BannedWords flags the texts containing words users shouldn't write, whatever their case.
+// Only whole words match, so banning "ass" doesn't flag "class".
+type BannedWords struct {
+	words map[string]bool
+}
+
+func NewBannedWords(words ...string) *BannedWords {
+	banned := &BannedWords{
+		words: make(map[string]bool),
+	}
+	for _, word := range words {
+		word = strings.ToLower(strings.TrimSpace(word))
+		if word != "" {
+			banned.words[word] = true
+		}
+	}
+	return banned
+}
+
+// Find returns the banned words found in the texts, sorted and lower-cased.
+func (banned *BannedWords) Find(texts ...string) []string {
+	if banned == nil || len(banned.words) == 0 {
+		return nil
+	}
+
+	found := make(map[string]bool)
+	for _, text := range texts {
+		words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+		for _, word := range words {
+			if banned.words[word] {
+				found[word] = true
+			}
+		}
+	}
+
+	result := make([]string, 0, len(found))
+	for word := range found {
+		result = append(result, word)
+	}
+	sort.Strings(result)
+	return result
+}
@@ -0,0 +1,268 @@
+package service
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/Dostonlv/pcbook/pb"
+	"google.golang.org/protobuf/proto"
+)
+
+// CachingLaptopStore wraps another LaptopStore with an LRU cache for Find
+// and a result cache for Search. Saves and deletes must go through the decorator,
+// otherwise the cached entries can become stale.
+type CachingLaptopStore struct {
+	store LaptopStore
+
+	mutex      sync.Mutex
+	laptops    *lruCache[*pb.Laptop]
+	searches   *lruCache[*searchResult]
+	generation uint64
+
+	findHits     atomic.Uint64
+	findMisses   atomic.Uint64
+	searchHits   atomic.Uint64
+	searchMisses atomic.Uint64
+}
+
+type searchResult struct {
+	filter  *pb.Filter
+	laptops []*pb.Laptop
+}
+
+type CacheStats struct {
+	FindHits     uint64
+	FindMisses   uint64
+	SearchHits   uint64
+	SearchMisses uint64
+}
+
+func NewCachingLaptopStore(store LaptopStore, laptopCapacity int, searchCapacity int) *CachingLaptopStore {
+	return &CachingLaptopStore{
+		store:    store,
+		laptops:  newLRUCache[*pb.Laptop](laptopCapacity),
+		searches: newLRUCache[*searchResult](searchCapacity),
+	}
+}
+
+func (store *CachingLaptopStore) Stats() CacheStats {
+	return CacheStats{
+		FindHits:     store.findHits.Load(),
+		FindMisses:   store.findMisses.Load(),
+		SearchHits:   store.searchHits.Load(),
+		SearchMisses: store.searchMisses.Load(),
+	}
+}
+
+func (store *CachingLaptopStore) Save(laptop *pb.Laptop) error {
+	err := store.store.Save(laptop)
+	if err != nil {
+		return err
+	}
+
+	store.invalidate(laptop)
+	return nil
+}
+
+func (store *CachingLaptopStore) Delete(id string) error {
+	laptop, err := store.store.Find(id)
+	if err != nil {
+		return err
+	}
+
+	err = store.store.Delete(id)
+	if err != nil {
+		return err
+	}
+
+	if laptop != nil {
+		store.invalidate(laptop)
+	}
+	return nil
+}
+
+// invalidate drops the cached laptop with the same ID and every cached
+// search whose filter the laptop qualifies for.
+func (store *CachingLaptopStore) invalidate(laptop *pb.Laptop) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	store.generation++
+	store.laptops.remove(laptop.GetId())
+	store.searches.removeIf(func(result *searchResult) bool {
+		return isQualified(result.filter, laptop)
+	})
+}
+
+func (store *CachingLaptopStore) Find(id string) (*pb.Laptop, error) {
+	store.mutex.Lock()
+	laptop, ok := store.laptops.get(id)
+	generation := store.generation
+	store.mutex.Unlock()
+
+	if ok {
+		store.findHits.Add(1)
+		return deepCopy(laptop)
+	}
+	store.findMisses.Add(1)
+
+	laptop, err := store.store.Find(id)
+	if err != nil || laptop == nil {
+		return laptop, err
+	}
+
+	cached, err := deepCopy(laptop)
+	if err != nil {
+		return nil, err
+	}
+
+	store.mutex.Lock()
+	if store.generation == generation {
+		store.laptops.put(id, cached)
+	}
+	store.mutex.Unlock()
+
+	return laptop, nil
+}
+
+func (store *CachingLaptopStore) Search(
+	ctx context.Context,
+	filter *pb.Filter,
+	found func(laptop *pb.Laptop) error,
+) error {
+	key, err := filterKey(filter)
+	if err != nil {
+		return err
+	}
+
+	store.mutex.Lock()
+	result, ok := store.searches.get(key)
+	generation := store.generation
+	store.mutex.Unlock()
+
+	if ok {
+		store.searchHits.Add(1)
+		for _, laptop := range result.laptops {
+			if ctx.Err() != nil {
+				return fmt.Errorf("search cancelled: %w", ctx.Err())
+			}
+
+			other, err := deepCopy(laptop)
+			if err != nil {
+				return err
+			}
+
+			err = found(other)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	store.searchMisses.Add(1)
+
+	result = &searchResult{
+		filter: proto.Clone(filter).(*pb.Filter),
+	}
+	err = store.store.Search(ctx, filter, func(laptop *pb.Laptop) error {
+		other, err := deepCopy(laptop)
+		if err != nil {
+			return err
+		}
+		result.laptops = append(result.laptops, other)
+		return found(laptop)
+	})
+	if err != nil {
+		return err
+	}
+
+	store.mutex.Lock()
+	if store.generation == generation {
+		store.searches.put(key, result)
+	}
+	store.mutex.Unlock()
+
+	return nil
+}
+
+// filterKey encodes the filter deterministically, so that equal filters share a cache entry.
+func filterKey(filter *pb.Filter) (string, error) {
+	if filter == nil {
+		filter = &pb.Filter{}
+	}
+
+	data, err := proto.MarshalOptions{Deterministic: true}.Marshal(filter)
+	if err != nil {
+		return "", fmt.Errorf("cannot encode filter: %w", err)
+	}
+	return string(data), nil
+}
+
+type lruCache[V any] struct {
+	capacity int
+	order    *list.List
+	items    map[string]*list.Element
+}
+
+type lruEntry[V any] struct {
+	key   string
+	value V
+}
+
+func newLRUCache[V any](capacity int) *lruCache[V] {
+	return &lruCache[V]{
+		capacity: capacity,
+		order:    list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+func (cache *lruCache[V]) get(key string) (V, bool) {
+	element, ok := cache.items[key]
+	if !ok {
+		var zero V
+		return zero, false
+	}
+
+	cache.order.MoveToFront(element)
+	return element.Value.(*lruEntry[V]).value, true
+}
+
+func (cache *lruCache[V]) put(key string, value V) {
+	if cache.capacity <= 0 {
+		return
+	}
+
+	if element, ok := cache.items[key]; ok {
+		element.Value.(*lruEntry[V]).value = value
+		cache.order.MoveToFront(element)
+		return
+	}
+
+	cache.items[key] = cache.order.PushFront(&lruEntry[V]{key: key, value: value})
+	if cache.order.Len() > cache.capacity {
+		cache.remove(cache.order.Back().Value.(*lruEntry[V]).key)
+	}
+}
+
+func (cache *lruCache[V]) remove(key string) {
+	element, ok := cache.items[key]
+	if !ok {
+		return
+	}
+
+	cache.order.Remove(element)
+	delete(cache.items, key)
+}
+
+func (cache *lruCache[V]) removeIf(match func(value V) bool) {
+	for key, element := range cache.items {
+		if match(element.Value.(*lruEntry[V]).value) {
+			cache.order.Remove(element)
+			delete(cache.items, key)
+		}
+	}
+}
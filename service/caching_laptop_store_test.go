@@ -0,0 +1,59 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Dostonlv/pcbook/pb"
+	"github.com/Dostonlv/pcbook/sample"
+	"github.com/Dostonlv/pcbook/service"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCachingLaptopStore(t *testing.T) {
+	t.Parallel()
+
+	store := service.NewCachingLaptopStore(service.NewShardedLaptopStore(4), 10, 10)
+
+	laptop := sample.NewLaptop()
+	laptop.PriceUsd = 1500
+	err := store.Save(laptop)
+	require.NoError(t, err)
+
+	for i := 0; i < 2; i++ {
+		other, err := store.Find(laptop.Id)
+		require.NoError(t, err)
+		requireSameLaptop(t, laptop, other)
+	}
+	require.Equal(t, service.CacheStats{FindHits: 1, FindMisses: 1}, store.Stats())
+
+	cheap := &pb.Filter{MaxPriceUsd: 1000}
+	expensive := &pb.Filter{MaxPriceUsd: 2000}
+
+	count := func(filter *pb.Filter) int {
+		n := 0
+		err := store.Search(context.Background(), filter, func(laptop *pb.Laptop) error {
+			n++
+			return nil
+		})
+		require.NoError(t, err)
+		return n
+	}
+
+	require.Equal(t, 0, count(cheap))
+	require.Equal(t, 1, count(expensive))
+	require.Equal(t, 1, count(expensive))
+	require.EqualValues(t, 1, store.Stats().SearchHits)
+	require.EqualValues(t, 2, store.Stats().SearchMisses)
+
+	// only the search that the new laptop matches is invalidated
+	other := sample.NewLaptop()
+	other.PriceUsd = 1800
+	err = store.Save(other)
+	require.NoError(t, err)
+
+	require.Equal(t, 0, count(cheap))
+	require.Equal(t, 2, count(expensive))
+	require.EqualValues(t, 2, store.Stats().SearchHits)
+	require.EqualValues(t, 3, store.Stats().SearchMisses)
+}
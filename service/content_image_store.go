@@ -0,0 +1,433 @@
+package service
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var ErrInvalidDigest = errors.New("invalid image digest")
+
+var digestPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// DigestImageStore is implemented by image stores that can attach content
+// they already have to a new image, so clients don't need to upload it again.
+type DigestImageStore interface {
+	ImageStore
+	SaveDigest(info *ImageInfo, digest string) (string, error)
+}
+
+// ContentAddressedImageStore stores every distinct image content once,
+// in a blob named after its SHA-256 digest. A blob is deleted when
+// the last image referencing it is deleted.
+// The metadata of every image is kept in its own file, from which the index is rebuilt.
+type ContentAddressedImageStore struct {
+	mutex           sync.RWMutex
+	blobFolder      string
+	renditionFolder string
+	metadataFolder  string
+	images          map[string]*ImageInfo
+	references      map[string]map[string]int
+}
+
+// NewContentAddressedImageStore opens the store in the folder and rebuilds its index
+// from the image metadata. Metadata whose blob is missing is skipped.
+func NewContentAddressedImageStore(imageFolder string) (*ContentAddressedImageStore, error) {
+	store := &ContentAddressedImageStore{
+		blobFolder:      filepath.Join(imageFolder, "blobs"),
+		renditionFolder: filepath.Join(imageFolder, "renditions"),
+		metadataFolder:  filepath.Join(imageFolder, "images"),
+		images:          make(map[string]*ImageInfo),
+		references:      make(map[string]map[string]int),
+	}
+
+	for _, folder := range []string{store.blobFolder, store.renditionFolder, store.metadataFolder} {
+		err := os.MkdirAll(folder, 0755)
+		if err != nil {
+			return nil, fmt.Errorf("cannot create image folder: %w", err)
+		}
+	}
+
+	entries, err := os.ReadDir(store.metadataFolder)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read image metadata folder: %w", err)
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != metadataExt {
+			continue
+		}
+
+		image, err := store.loadMetadata(entry.Name())
+		if err != nil {
+			log.Printf("skip image metadata %s: %v", entry.Name(), err)
+			continue
+		}
+		store.addReference(image)
+	}
+
+	log.Printf("loaded %d images from %s", len(store.images), imageFolder)
+	return store, nil
+}
+
+func (store *ContentAddressedImageStore) loadMetadata(name string) (*ImageInfo, error) {
+	data, err := os.ReadFile(filepath.Join(store.metadataFolder, name))
+	if err != nil {
+		return nil, err
+	}
+
+	image := &ImageInfo{}
+	err = json.Unmarshal(data, image)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode metadata: %w", err)
+	}
+	if image.ID+metadataExt != name {
+		return nil, fmt.Errorf("metadata belongs to image %s", image.ID)
+	}
+
+	err = ValidateDigest(image.Digest)
+	if err != nil {
+		return nil, err
+	}
+	image.Path = filepath.Join(store.blobFolder, image.Digest)
+
+	info, err := os.Stat(image.Path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot find image blob: %w", err)
+	}
+	if info.Size() != image.Size {
+		return nil, fmt.Errorf("image blob size is %d, metadata says %d", info.Size(), image.Size)
+	}
+	return image, nil
+}
+
+func (store *ContentAddressedImageStore) metadataPath(imageID string) string {
+	return filepath.Join(store.metadataFolder, imageID+metadataExt)
+}
+
+func (store *ContentAddressedImageStore) writeMetadata(image *ImageInfo) error {
+	metadata, err := json.Marshal(image)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(store.metadataPath(image.ID), metadata, 0644)
+}
+
+func ImageDigest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func ValidateDigest(digest string) error {
+	if !digestPattern.MatchString(digest) {
+		return fmt.Errorf("%w: %q", ErrInvalidDigest, digest)
+	}
+	return nil
+}
+
+func (store *ContentAddressedImageStore) Save(info *ImageInfo, imageData bytes.Buffer) (string, error) {
+	return saveImage(store, info, imageData.Bytes())
+}
+
+// Create streams the content to a temporary file, which becomes the blob of the digest
+// on Commit unless the store already has the content.
+func (store *ContentAddressedImageStore) Create() (ImageWriter, error) {
+	file, err := createTempFile(filepath.Join(store.blobFolder, "upload"))
+	if err != nil {
+		return nil, err
+	}
+	return newFileImageWriter(file, store.commit), nil
+}
+
+func (store *ContentAddressedImageStore) commit(writer *fileImageWriter, info *ImageInfo) (string, error) {
+	digest := writer.Digest()
+	blobPath := filepath.Join(store.blobFolder, digest)
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	newBlob := store.references[digest] == nil
+	if newBlob {
+		err := writer.file.commit(blobPath, 0644)
+		if err != nil {
+			return "", fmt.Errorf("cannot write image blob: %w", err)
+		}
+	} else {
+		writer.file.abort()
+	}
+
+	image := info.Clone()
+	image.Size = writer.Size()
+	imageID, err := store.addImage(image, digest)
+	if err != nil && newBlob {
+		os.Remove(blobPath)
+	}
+	return imageID, err
+}
+
+// SaveDigest creates an image for content that is already stored,
+// it returns ErrNotFound if there is no blob with the digest.
+// The size and the decoded metadata are taken from the stored content.
+func (store *ContentAddressedImageStore) SaveDigest(info *ImageInfo, digest string) (string, error) {
+	err := ValidateDigest(digest)
+	if err != nil {
+		return "", err
+	}
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if store.references[digest] == nil {
+		return "", ErrNotFound
+	}
+
+	image := info.Clone()
+	for _, other := range store.images {
+		if other.Digest == digest {
+			image.Size = other.Size
+			image.Width = other.Width
+			image.Height = other.Height
+			image.Format = other.Format
+			break
+		}
+	}
+	return store.addImage(image, digest)
+}
+
+func (store *ContentAddressedImageStore) addImage(image *ImageInfo, digest string) (string, error) {
+	imageID, err := uuid.NewRandom()
+	if err != nil {
+		return "", fmt.Errorf("cannot generate image %w", err)
+	}
+
+	image.ID = imageID.String()
+	image.Path = filepath.Join(store.blobFolder, digest)
+	image.Digest = digest
+	image.CreatedAt = time.Now().UTC()
+
+	err = store.writeMetadata(image)
+	if err != nil {
+		return "", fmt.Errorf("cannot write image metadata: %w", err)
+	}
+
+	store.addReference(image)
+	return image.ID, nil
+}
+
+// addReference indexes the image and counts it as a reference to its blob.
+func (store *ContentAddressedImageStore) addReference(image *ImageInfo) {
+	store.images[image.ID] = image
+
+	laptops := store.references[image.Digest]
+	if laptops == nil {
+		laptops = make(map[string]int)
+		store.references[image.Digest] = laptops
+	}
+	laptops[image.LaptopID]++
+}
+
+func (store *ContentAddressedImageStore) Find(imageID string) (*ImageInfo, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	image := store.images[imageID]
+	if image == nil {
+		return nil, nil
+	}
+	return image.Clone(), nil
+}
+
+func (store *ContentAddressedImageStore) List(laptopID string) ([]*ImageInfo, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	return listImages(store.images, laptopID), nil
+}
+
+func (store *ContentAddressedImageStore) ListAll() ([]*ImageInfo, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	return allImages(store.images), nil
+}
+
+func (store *ContentAddressedImageStore) Update(image *ImageInfo) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	stored := store.images[image.ID]
+	if stored == nil {
+		return ErrNotFound
+	}
+
+	updated := stored.Clone()
+	updated.updateDetails(image)
+	err := store.writeMetadata(updated)
+	if err != nil {
+		return fmt.Errorf("cannot write image metadata: %w", err)
+	}
+
+	store.images[image.ID] = updated
+	return nil
+}
+
+func (store *ContentAddressedImageStore) Open(imageID string) (io.ReadCloser, error) {
+	image, err := store.Find(imageID)
+	if err != nil {
+		return nil, err
+	}
+	if image == nil {
+		return nil, ErrNotFound
+	}
+	return openImageFile(image.Path)
+}
+
+// SaveRendition stores the rendition once for all the images with the same content.
+func (store *ContentAddressedImageStore) SaveRendition(imageID string, size int, data bytes.Buffer) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	image := store.images[imageID]
+	if image == nil {
+		return ErrNotFound
+	}
+
+	renditionPath, err := store.renditionPath(image, size)
+	if err != nil {
+		return err
+	}
+
+	err = writeFileAtomic(renditionPath, data.Bytes(), 0644)
+	if err != nil {
+		return fmt.Errorf("cannot write rendition to file: %w", err)
+	}
+	return nil
+}
+
+func (store *ContentAddressedImageStore) OpenRendition(imageID string, size int) (io.ReadCloser, error) {
+	image, err := store.Find(imageID)
+	if err != nil {
+		return nil, err
+	}
+	if image == nil {
+		return nil, ErrNotFound
+	}
+
+	renditionPath, err := store.renditionPath(image, size)
+	if err != nil {
+		return nil, err
+	}
+	return openImageFile(renditionPath)
+}
+
+func (store *ContentAddressedImageStore) renditionPath(image *ImageInfo, size int) (string, error) {
+	return imageFilePath(store.renditionFolder, image.Digest+"_"+strconv.Itoa(size), RenditionType(image))
+}
+
+// RemoveAll deletes the image folder with the blobs, renditions and metadata in it.
+func (store *ContentAddressedImageStore) RemoveAll() error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	err := os.RemoveAll(filepath.Dir(store.blobFolder))
+	if err != nil {
+		return fmt.Errorf("cannot remove image folder: %w", err)
+	}
+	store.images = make(map[string]*ImageInfo)
+	store.references = make(map[string]map[string]int)
+	return nil
+}
+
+func (store *ContentAddressedImageStore) Delete(imageID string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	image := store.images[imageID]
+	if image == nil {
+		return ErrNotFound
+	}
+
+	// the metadata goes first, so that a crash in between leaves an orphan blob to collect
+	err := os.Remove(store.metadataPath(imageID))
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("cannot remove image metadata: %w", err)
+	}
+
+	laptops := store.references[image.Digest]
+	laptops[image.LaptopID]--
+	if laptops[image.LaptopID] <= 0 {
+		delete(laptops, image.LaptopID)
+	}
+
+	if len(laptops) == 0 {
+		// without its metadata the image is gone, a blob that can't be removed is left to the collector
+		err := os.Remove(image.Path)
+		if err != nil && !os.IsNotExist(err) {
+			log.Printf("cannot remove image blob %s: %v", image.Digest, err)
+		}
+		delete(store.references, image.Digest)
+
+		err = removeRenditions(store.renditionFolder, image.Digest)
+		if err != nil {
+			log.Printf("cannot remove renditions of blob %s: %v", image.Digest, err)
+		}
+	}
+
+	delete(store.images, imageID)
+	return nil
+}
+
+// RemoveOrphanFiles removes the blobs no image refers to, their renditions, the metadata
+// of unknown images and temporary files.
+func (store *ContentAddressedImageStore) RemoveOrphanFiles(before time.Time, dryRun bool) ([]OrphanFile, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	root := filepath.Dir(store.blobFolder)
+	orphans, err := removeOrphanFiles(root, store.blobFolder, func(name string) bool {
+		return store.references[name] != nil
+	}, before, dryRun)
+	if err != nil {
+		return orphans, err
+	}
+
+	orphanRenditions, err := removeOrphanFiles(root, store.renditionFolder, func(name string) bool {
+		match := renditionPattern.FindStringSubmatch(name)
+		return match != nil && store.references[match[1]] != nil
+	}, before, dryRun)
+	orphans = append(orphans, orphanRenditions...)
+	if err != nil {
+		return orphans, err
+	}
+
+	orphanMetadata, err := removeOrphanFiles(root, store.metadataFolder, func(name string) bool {
+		return store.images[strings.TrimSuffix(name, metadataExt)] != nil
+	}, before, dryRun)
+	return append(orphans, orphanMetadata...), err
+}
+
+// References returns the IDs of the laptops that have an image with the digest.
+func (store *ContentAddressedImageStore) References(digest string) []string {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	laptopIDs := make([]string, 0, len(store.references[digest]))
+	for laptopID := range store.references[digest] {
+		laptopIDs = append(laptopIDs, laptopID)
+	}
+	return laptopIDs
+}
@@ -0,0 +1,153 @@
+package service_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Dostonlv/pcbook/pb"
+	"github.com/Dostonlv/pcbook/sample"
+	"github.com/Dostonlv/pcbook/service"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestContentAddressedImageStore(t *testing.T) {
+	t.Parallel()
+
+	imageFolder := t.TempDir()
+	store, err := service.NewContentAddressedImageStore(imageFolder)
+	require.NoError(t, err)
+
+	content := []byte("the same product photo")
+	digest := service.ImageDigest(content)
+	blobPath := filepath.Join(imageFolder, "blobs", digest)
+
+	_, err = store.SaveDigest(&service.ImageInfo{LaptopID: "laptop-1", Type: ".jpg"}, digest)
+	require.ErrorIs(t, err, service.ErrNotFound)
+
+	_, err = store.SaveDigest(&service.ImageInfo{LaptopID: "laptop-1", Type: ".jpg"}, "../../etc/passwd")
+	require.ErrorIs(t, err, service.ErrInvalidDigest)
+
+	imageID1, err := store.Save(&service.ImageInfo{LaptopID: "laptop-1", Type: ".jpg"}, *bytes.NewBuffer(content))
+	require.NoError(t, err)
+	imageID2, err := store.Save(&service.ImageInfo{LaptopID: "laptop-2", Type: ".jpg"}, *bytes.NewBuffer(content))
+	require.NoError(t, err)
+	imageID3, err := store.SaveDigest(&service.ImageInfo{LaptopID: "laptop-3", Type: ".jpg"}, digest)
+	require.NoError(t, err)
+
+	blobs, err := os.ReadDir(filepath.Join(imageFolder, "blobs"))
+	require.NoError(t, err)
+	require.Len(t, blobs, 1)
+	require.ElementsMatch(t, []string{"laptop-1", "laptop-2", "laptop-3"}, store.References(digest))
+
+	require.NoError(t, store.Delete(imageID1))
+	require.NoError(t, store.Delete(imageID3))
+	require.FileExists(t, blobPath)
+	require.Equal(t, []string{"laptop-2"}, store.References(digest))
+
+	require.NoError(t, store.Delete(imageID2))
+	require.NoFileExists(t, blobPath)
+	require.ErrorIs(t, store.Delete(imageID2), service.ErrNotFound)
+}
+
+func TestClientUploadImageByDigest(t *testing.T) {
+	t.Parallel()
+
+	laptopStore := service.NewInMemoryLaptopStore()
+	imageStore, err := service.NewContentAddressedImageStore(t.TempDir())
+	require.NoError(t, err)
+
+	laptop := sample.NewLaptop()
+	require.NoError(t, laptopStore.Save(laptop))
+
+	serverAddress := startTestLaptopServer(t, laptopStore, imageStore, nil)
+	laptopClient := newTestLaptopClient(t, serverAddress)
+
+	content := newTestPNG(t, 64, 48)
+	digest := service.ImageDigest(content)
+
+	upload := func(digest string, chunks ...[]byte) (*pb.UploadImageResponse, error) {
+		stream, err := laptopClient.UploadImage(context.Background())
+		require.NoError(t, err)
+
+		err = stream.Send(&pb.UploadImageRequest{
+			Data: &pb.UploadImageRequest_Info{
+				Info: &pb.ImageInfo{LaptopId: laptop.GetId(), ImageType: ".png", Digest: digest},
+			},
+		})
+		require.NoError(t, err)
+
+		for _, chunk := range chunks {
+			err = stream.Send(&pb.UploadImageRequest{
+				Data: &pb.UploadImageRequest_ChunkData{ChunkData: chunk},
+			})
+			require.NoError(t, err)
+		}
+		return stream.CloseAndRecv()
+	}
+
+	_, err = upload(digest)
+	require.Equal(t, codes.NotFound, status.Code(err))
+
+	_, err = upload(digest, []byte("something else"))
+	require.Equal(t, codes.DataLoss, status.Code(err))
+
+	res, err := upload(digest, content)
+	require.NoError(t, err)
+	require.Equal(t, digest, res.GetDigest())
+	require.EqualValues(t, len(content), res.GetSize())
+
+	res, err = upload(digest)
+	require.NoError(t, err)
+	require.Equal(t, digest, res.GetDigest())
+	require.Zero(t, res.GetSize())
+	require.EqualValues(t, 64, res.GetWidth())
+	require.EqualValues(t, 48, res.GetHeight())
+	require.Equal(t, "png", res.GetFormat())
+}
+
+func TestContentAddressedImageStoreRebuildsIndex(t *testing.T) {
+	t.Parallel()
+
+	imageFolder := t.TempDir()
+	store, err := service.NewContentAddressedImageStore(imageFolder)
+	require.NoError(t, err)
+
+	content := []byte("the same product photo")
+	digest := service.ImageDigest(content)
+	imageID1, err := store.Save(&service.ImageInfo{LaptopID: "laptop-1", Type: ".jpg"}, *bytes.NewBuffer(content))
+	require.NoError(t, err)
+	imageID2, err := store.SaveDigest(&service.ImageInfo{LaptopID: "laptop-2", Type: ".jpg"}, digest)
+	require.NoError(t, err)
+	require.NoError(t, store.Update(&service.ImageInfo{ID: imageID2, Caption: "side view"}))
+
+	reopened, err := service.NewContentAddressedImageStore(imageFolder)
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"laptop-1", "laptop-2"}, reopened.References(digest))
+
+	image, err := reopened.Find(imageID2)
+	require.NoError(t, err)
+	require.Equal(t, "side view", image.Caption)
+	require.Equal(t, digest, image.Digest)
+	require.EqualValues(t, len(content), image.Size)
+
+	_, err = reopened.SaveDigest(&service.ImageInfo{LaptopID: "laptop-3", Type: ".jpg"}, digest)
+	require.NoError(t, err)
+
+	orphans, err := reopened.RemoveOrphanFiles(time.Now().Add(time.Hour), true)
+	require.NoError(t, err)
+	require.Empty(t, orphans)
+
+	require.NoError(t, reopened.Delete(imageID1))
+	reopened, err = service.NewContentAddressedImageStore(imageFolder)
+	require.NoError(t, err)
+	image, err = reopened.Find(imageID1)
+	require.NoError(t, err)
+	require.Nil(t, image)
+	require.ElementsMatch(t, []string{"laptop-2", "laptop-3"}, reopened.References(digest))
+}
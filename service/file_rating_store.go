@@ -0,0 +1,455 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+type RatingEventKind string
+
+const (
+	// RatingEventRate records the score of a user, replacing their previous one.
+	RatingEventRate RatingEventKind = "rate"
+	// RatingEventRemove forgets the score of a user.
+	RatingEventRemove RatingEventKind = "remove"
+	// RatingEventDelete forgets every score of a laptop.
+	RatingEventDelete RatingEventKind = "delete"
+	// RatingEventQuarantine holds the score of a user for review, replacing their previous quarantined one.
+	RatingEventQuarantine RatingEventKind = "quarantine"
+	// RatingEventRelease forgets a quarantined score, whether it was approved or rejected.
+	RatingEventRelease RatingEventKind = "release"
+)
+
+// RatingEvent is a change of the ratings, a FileRatingStore keeps every one of them.
+// The ID and reason are those of quarantined ratings.
+type RatingEvent struct {
+	Kind     RatingEventKind `json:"kind"`
+	ID       string          `json:"id,omitempty"`
+	LaptopID string          `json:"laptop_id"`
+	Username string          `json:"username,omitempty"`
+	Score    float64         `json:"score,omitempty"`
+	Time     time.Time       `json:"time"`
+	Reason   string          `json:"reason,omitempty"`
+}
+
+// RatingLogStats describes the aggregates recomputed from a rating log.
+type RatingLogStats struct {
+	Events  int
+	Laptops int
+	Ratings int
+}
+
+// RebuildableRatingStore is implemented by the rating stores keeping the rating events,
+// Rebuild recomputes the aggregates from the events.
+type RebuildableRatingStore interface {
+	RatingStore
+	Rebuild() (RatingLogStats, error)
+	// Summaries returns the rating of every laptop, without the scores of the users.
+	Summaries() map[string]*Rating
+}
+
+// FileRatingStore appends every rating event to a JSON lines file and keeps the aggregates in memory,
+// along with the quarantined ratings. They are recomputed from the file when the store is opened,
+// so the file can be repaired offline, e.g. to remove fraudulent ratings, and reloaded with Rebuild.
+type FileRatingStore struct {
+	mutex       sync.RWMutex
+	filename    string
+	config      ratingConfig
+	file        *os.File
+	rating      map[string]*Rating
+	quarantined map[string]*QuarantinedRating
+}
+
+// ratingLog is what the events of a rating log add up to.
+type ratingLog struct {
+	ratings     map[string]*Rating
+	quarantined map[string]*QuarantinedRating
+}
+
+func NewFileRatingStore(filename string, opts ...RatingStoreOption) (*FileRatingStore, error) {
+	store := &FileRatingStore{
+		filename: filename,
+		config:   newRatingConfig(opts),
+	}
+
+	_, err := store.Rebuild()
+	if err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// Rebuild reopens the file and recomputes the aggregates from its events.
+func (store *FileRatingStore) Rebuild() (RatingLogStats, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	state, stats, err := readRatingLog(store.filename, store.config)
+	if err != nil {
+		return stats, err
+	}
+
+	// the file may have been replaced, so it's opened again
+	file, err := os.OpenFile(store.filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return stats, fmt.Errorf("cannot open rating log: %w", err)
+	}
+	if store.file != nil {
+		store.file.Close()
+	}
+
+	store.file = file
+	store.rating = state.ratings
+	store.quarantined = state.quarantined
+	return stats, nil
+}
+
+// readRatingLog replays the events of the file. An incomplete last line, left by a crash
+// in the middle of a write, is truncated so that the next events start on a line of their own.
+func readRatingLog(filename string, config ratingConfig) (*ratingLog, RatingLogStats, error) {
+	state := &ratingLog{
+		ratings:     make(map[string]*Rating),
+		quarantined: make(map[string]*QuarantinedRating),
+	}
+	var stats RatingLogStats
+
+	data, err := os.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return state, stats, nil
+	}
+	if err != nil {
+		return nil, stats, fmt.Errorf("cannot read rating log: %w", err)
+	}
+
+	if end := bytes.LastIndexByte(data, '\n') + 1; end < len(data) {
+		log.Printf("truncating the incomplete last event of %s", filename)
+		err = os.Truncate(filename, int64(end))
+		if err != nil {
+			return nil, stats, fmt.Errorf("cannot truncate rating log: %w", err)
+		}
+		data = data[:end]
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, len(data)+1)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+
+		var event RatingEvent
+		err := json.Unmarshal(scanner.Bytes(), &event)
+		if err != nil {
+			return nil, stats, fmt.Errorf("cannot decode event at line %d of rating log: %w", line, err)
+		}
+		err = state.apply(&event, config)
+		if err != nil {
+			return nil, stats, fmt.Errorf("invalid event at line %d of rating log: %w", line, err)
+		}
+		stats.Events++
+	}
+
+	stats.Laptops = len(state.ratings)
+	for _, rating := range state.ratings {
+		stats.Ratings += int(rating.Count)
+	}
+	return state, stats, scanner.Err()
+}
+
+func (state *ratingLog) apply(event *RatingEvent, config ratingConfig) error {
+	if event.LaptopID == "" {
+		return errors.New("laptop ID is missing")
+	}
+
+	ratings := state.ratings
+	rating := ratings[event.LaptopID]
+	switch event.Kind {
+	case RatingEventRate:
+		if rating == nil {
+			rating = newRating(config.halfLife)
+			ratings[event.LaptopID] = rating
+		}
+		rating.set(event.Username, event.Score, event.Time)
+	case RatingEventRemove:
+		if rating != nil {
+			rating.remove(event.Username)
+			if rating.Count == 0 {
+				delete(ratings, event.LaptopID)
+			}
+		}
+	case RatingEventDelete:
+		delete(ratings, event.LaptopID)
+	case RatingEventQuarantine:
+		if event.ID == "" {
+			return errors.New("quarantined rating ID is missing")
+		}
+		for id, quarantined := range state.quarantined {
+			if quarantined.LaptopID == event.LaptopID && quarantined.Username == event.Username {
+				delete(state.quarantined, id)
+			}
+		}
+		state.quarantined[event.ID] = &QuarantinedRating{
+			ID:       event.ID,
+			LaptopID: event.LaptopID,
+			Username: event.Username,
+			Score:    event.Score,
+			RatedAt:  event.Time,
+			Reason:   event.Reason,
+		}
+	case RatingEventRelease:
+		delete(state.quarantined, event.ID)
+	default:
+		return fmt.Errorf("unknown event kind %q", event.Kind)
+	}
+	return nil
+}
+
+// append writes the events to the file and applies them once they are durable.
+func (store *FileRatingStore) append(events ...*RatingEvent) error {
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	for _, event := range events {
+		err := encoder.Encode(event)
+		if err != nil {
+			return fmt.Errorf("cannot encode rating event: %w", err)
+		}
+	}
+
+	// a partial write is truncated, so that it doesn't end up in the middle of the log
+	offset, err := store.file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return fmt.Errorf("cannot find the end of the rating log: %w", err)
+	}
+
+	_, err = store.file.Write(buffer.Bytes())
+	if err == nil {
+		err = store.file.Sync()
+	}
+	if err != nil {
+		truncateErr := store.file.Truncate(offset)
+		if truncateErr != nil {
+			return fmt.Errorf("cannot write rating log: %w (truncate failed: %v)", err, truncateErr)
+		}
+		return fmt.Errorf("cannot write rating log: %w", err)
+	}
+
+	state := &ratingLog{
+		ratings:     store.rating,
+		quarantined: store.quarantined,
+	}
+	for _, event := range events {
+		err := state.apply(event, store.config)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (store *FileRatingStore) Add(laptopID string, username string, score float64, ratedAt time.Time) (*Rating, bool, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	_, updated := store.rating[laptopID].scoreOf(username)
+	err := store.append(&RatingEvent{
+		Kind:     RatingEventRate,
+		LaptopID: laptopID,
+		Username: username,
+		Score:    score,
+		Time:     ratedAt.UTC(),
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return store.rating[laptopID].summary(), updated, nil
+}
+
+func (store *FileRatingStore) Find(laptopID string) (*Rating, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	rating := store.rating[laptopID]
+	if rating == nil {
+		return nil, nil
+	}
+	return rating.Clone(), nil
+}
+
+func (store *FileRatingStore) Summaries() map[string]*Rating {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	summaries := make(map[string]*Rating, len(store.rating))
+	for laptopID, rating := range store.rating {
+		summaries[laptopID] = rating.summary()
+	}
+	return summaries
+}
+
+func (store *FileRatingStore) FindAggregates(laptopID string) (*RatingAggregates, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	rating := store.rating[laptopID]
+	if rating == nil {
+		return nil, nil
+	}
+	return rating.Aggregates(), nil
+}
+
+func (store *FileRatingStore) FindScore(laptopID string, username string) (*UserScore, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	return store.rating[laptopID].userScore(username), nil
+}
+
+func (store *FileRatingStore) RemoveScore(laptopID string, username string) (*Rating, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if _, ok := store.rating[laptopID].scoreOf(username); !ok {
+		return store.rating[laptopID].summary(), nil
+	}
+	err := store.append(&RatingEvent{
+		Kind:     RatingEventRemove,
+		LaptopID: laptopID,
+		Username: username,
+		Time:     time.Now().UTC(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return store.rating[laptopID].summary(), nil
+}
+
+// Save logs the events turning the current rating of the laptop into the given one,
+// the scores keep the time they were given.
+func (store *FileRatingStore) Save(laptopID string, rating *Rating) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	now := time.Now().UTC()
+	var events []*RatingEvent
+	current := store.rating[laptopID]
+	if current != nil {
+		for _, username := range sortedUsernames(current.Scores) {
+			if _, ok := rating.Scores[username]; !ok {
+				events = append(events, &RatingEvent{Kind: RatingEventRemove, LaptopID: laptopID, Username: username, Time: now})
+			}
+		}
+	}
+	for _, username := range sortedUsernames(rating.Scores) {
+		score := rating.Scores[username]
+		ratedAt, ok := rating.RatedAt[username]
+		if !ok {
+			ratedAt = now
+		}
+		if previous, ok := current.scoreOf(username); !ok || previous != score || !current.RatedAt[username].Equal(ratedAt) {
+			events = append(events, &RatingEvent{Kind: RatingEventRate, LaptopID: laptopID, Username: username, Score: score, Time: ratedAt.UTC()})
+		}
+	}
+
+	if len(events) == 0 {
+		return nil
+	}
+	return store.append(events...)
+}
+
+func (store *FileRatingStore) Delete(laptopID string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if store.rating[laptopID] == nil {
+		return ErrNotFound
+	}
+	return store.append(&RatingEvent{
+		Kind:     RatingEventDelete,
+		LaptopID: laptopID,
+		Time:     time.Now().UTC(),
+	})
+}
+
+// QuarantinedRatings returns the ratings held for review.
+func (store *FileRatingStore) QuarantinedRatings() []*QuarantinedRating {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	ratings := make([]*QuarantinedRating, 0, len(store.quarantined))
+	for _, rating := range store.quarantined {
+		other := *rating
+		ratings = append(ratings, &other)
+	}
+	return ratings
+}
+
+func (store *FileRatingStore) Quarantine(rating *QuarantinedRating) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	return store.append(&RatingEvent{
+		Kind:     RatingEventQuarantine,
+		ID:       rating.ID,
+		LaptopID: rating.LaptopID,
+		Username: rating.Username,
+		Score:    rating.Score,
+		Time:     rating.RatedAt.UTC(),
+		Reason:   rating.Reason,
+	})
+}
+
+func (store *FileRatingStore) Release(ratings ...*QuarantinedRating) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	now := time.Now().UTC()
+	events := make([]*RatingEvent, 0, len(ratings))
+	for _, rating := range ratings {
+		events = append(events, &RatingEvent{Kind: RatingEventRelease, ID: rating.ID, LaptopID: rating.LaptopID, Time: now})
+	}
+	return store.append(events...)
+}
+
+func (store *FileRatingStore) Close() error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	return store.file.Close()
+}
+
+// RemoveAll closes the store and deletes its log.
+func (store *FileRatingStore) RemoveAll() error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	err := store.file.Close()
+	if err != nil && !errors.Is(err, os.ErrClosed) {
+		return fmt.Errorf("cannot close rating log: %w", err)
+	}
+
+	err = os.Remove(store.filename)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("cannot remove rating log: %w", err)
+	}
+	store.rating = make(map[string]*Rating)
+	store.quarantined = make(map[string]*QuarantinedRating)
+	return nil
+}
+
+func sortedUsernames(scores map[string]float64) []string {
+	usernames := make([]string, 0, len(scores))
+	for username := range scores {
+		usernames = append(usernames, username)
+	}
+	sort.Strings(usernames)
+	return usernames
+}
@@ -0,0 +1,155 @@
+package service_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Dostonlv/pcbook/pb"
+	"github.com/Dostonlv/pcbook/sample"
+	"github.com/Dostonlv/pcbook/service"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestFileRatingStore(t *testing.T) {
+	t.Parallel()
+
+	filename := filepath.Join(t.TempDir(), "ratings.jsonl")
+	store, err := service.NewFileRatingStore(filename)
+	require.NoError(t, err)
+
+	_, _, err = store.Add("laptop1", "alice", 8, time.Now())
+	require.NoError(t, err)
+	_, _, err = store.Add("laptop1", "bob", 6, time.Now())
+	require.NoError(t, err)
+	rating, updated, err := store.Add("laptop1", "alice", 10, time.Now())
+	require.NoError(t, err)
+	require.True(t, updated)
+	require.Equal(t, uint32(2), rating.Count)
+	require.Equal(t, 16.0, rating.Sum)
+
+	// restoring a previous state logs the differences
+	err = store.Save("laptop1", &service.Rating{Count: 1, Sum: 8, Scores: map[string]float64{"alice": 8}})
+	require.NoError(t, err)
+	_, _, err = store.Add("laptop2", "alice", 5, time.Now())
+	require.NoError(t, err)
+	require.NoError(t, store.Delete("laptop2"))
+	require.ErrorIs(t, store.Delete("laptop2"), service.ErrNotFound)
+	require.NoError(t, store.Close())
+
+	// a crash in the middle of a write leaves an incomplete last event
+	file, err := os.OpenFile(filename, os.O_APPEND|os.O_WRONLY, 0644)
+	require.NoError(t, err)
+	_, err = file.WriteString(`{"kind":"rate","laptop_id":"laptop1","user`)
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	reopened, err := service.NewFileRatingStore(filename)
+	require.NoError(t, err)
+	defer reopened.Close()
+
+	rating, err = reopened.Find("laptop1")
+	require.NoError(t, err)
+	requireRatingScores(t, rating, map[string]float64{"alice": 8})
+
+	rating, err = reopened.Find("laptop2")
+	require.NoError(t, err)
+	require.Nil(t, rating)
+
+	_, _, err = reopened.Add("laptop1", "carol", 4, time.Now())
+	require.NoError(t, err)
+	stats, err := reopened.Rebuild()
+	require.NoError(t, err)
+	require.Equal(t, service.RatingLogStats{Events: 8, Laptops: 1, Ratings: 2}, stats)
+}
+
+// removeRatingEvents rewrites the rating log without the events of the user.
+func removeRatingEvents(t *testing.T, filename string, username string) {
+	file, err := os.Open(filename)
+	require.NoError(t, err)
+	defer file.Close()
+
+	var kept strings.Builder
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var event service.RatingEvent
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &event))
+		require.False(t, event.Time.IsZero())
+		if event.Username != username {
+			kept.WriteString(scanner.Text() + "\n")
+		}
+	}
+	require.NoError(t, scanner.Err())
+
+	// the repaired log replaces the file, as an editor would do
+	repaired := filename + ".repaired"
+	require.NoError(t, os.WriteFile(repaired, []byte(kept.String()), 0644))
+	require.NoError(t, os.Rename(repaired, filename))
+}
+
+func TestClientRebuildRatings(t *testing.T) {
+	t.Parallel()
+
+	filename := filepath.Join(t.TempDir(), "ratings.jsonl")
+	ratingStore, err := service.NewFileRatingStore(filename)
+	require.NoError(t, err)
+	t.Cleanup(func() { ratingStore.Close() })
+
+	laptopStore := service.NewInMemoryLaptopStore()
+	laptop := sample.NewLaptop()
+	require.NoError(t, laptopStore.Save(laptop))
+
+	laptopServer := service.NewLaptopServer(laptopStore, nil, ratingStore)
+	jwtManager := service.NewJWTManager("secret", time.Minute)
+	serverAddress := startTestAuthLaptopServer(t, laptopServer, jwtManager)
+
+	rateTestLaptop(t, newTestUserClient(t, serverAddress, jwtManager, "alice"), laptop.GetId(), 8)
+	rateTestLaptop(t, newTestUserClient(t, serverAddress, jwtManager, "fraudster"), laptop.GetId(), 1)
+	admin := newTestUserClient(t, serverAddress, jwtManager, "admin1")
+
+	summary := func() *pb.RatingSummary {
+		res, err := admin.GetRatingSummary(context.Background(), &pb.GetRatingSummaryRequest{LaptopIds: []string{laptop.GetId()}})
+		require.NoError(t, err)
+		return res.GetSummaries()[0]
+	}
+	require.Equal(t, uint32(2), summary().GetRatedCount())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	watch, err := admin.WatchRatings(ctx, &pb.WatchRatingsRequest{LaptopIds: []string{laptop.GetId()}})
+	require.NoError(t, err)
+	_, err = watch.Header()
+	require.NoError(t, err)
+
+	removeRatingEvents(t, filename, "fraudster")
+	res, err := admin.RebuildRatings(context.Background(), &pb.RebuildRatingsRequest{})
+	require.NoError(t, err)
+	update, err := watch.Recv()
+	require.NoError(t, err)
+	require.Equal(t, uint32(1), update.GetRating().GetRatedCount())
+	require.Equal(t, uint64(1), res.GetEventCount())
+	require.Equal(t, uint32(1), res.GetLaptopCount())
+	require.Equal(t, uint32(1), res.GetRatingCount())
+	require.Equal(t, uint32(1), summary().GetRatedCount())
+	require.Equal(t, 8.0, summary().GetAverageScore())
+
+	// the store appends to the repaired file
+	rateTestLaptop(t, newTestUserClient(t, serverAddress, jwtManager, "bob"), laptop.GetId(), 6)
+	reopened, err := service.NewFileRatingStore(filename)
+	require.NoError(t, err)
+	defer reopened.Close()
+	rating, err := reopened.Find(laptop.GetId())
+	require.NoError(t, err)
+	require.Equal(t, map[string]float64{"alice": 8, "bob": 6}, rating.Scores)
+
+	memoryServer := service.NewLaptopServer(laptopStore, nil, service.NewInMemoryRatingStore())
+	_, err = newTestLaptopClient(t, startTestLaptopServerWith(t, memoryServer)).RebuildRatings(context.Background(), &pb.RebuildRatingsRequest{})
+	require.Equal(t, codes.FailedPrecondition, status.Code(err))
+}
@@ -0,0 +1,137 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// FileUserStore keeps users with their bcrypt password hashes in a JSON file.
+// The whole file is rewritten atomically on every change.
+type FileUserStore struct {
+	mutex    sync.RWMutex
+	filename string
+	users    map[string]*User
+}
+
+func NewFileUserStore(filename string) (*FileUserStore, error) {
+	store := &FileUserStore{
+		filename: filename,
+		users:    make(map[string]*User),
+	}
+
+	data, err := os.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read users file: %w", err)
+	}
+
+	var users []*User
+	err = json.Unmarshal(data, &users)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode users file: %w", err)
+	}
+
+	for _, user := range users {
+		store.users[userKey(user.Tenant, user.Username)] = user
+	}
+	return store, nil
+}
+
+func (store *FileUserStore) Save(user *User) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	key := userKey(user.Tenant, user.Username)
+	if store.users[key] != nil {
+		return ErrAlreadyExists
+	}
+
+	store.users[key] = user.Clone()
+	err := store.persist()
+	if err != nil {
+		delete(store.users, key)
+		return err
+	}
+	return nil
+}
+
+func (store *FileUserStore) Find(tenant string, username string) (*User, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	user := store.users[userKey(tenant, username)]
+	if user == nil {
+		return nil, nil
+	}
+	return user.Clone(), nil
+}
+
+func (store *FileUserStore) Update(user *User) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	key := userKey(user.Tenant, user.Username)
+	previous := store.users[key]
+	if previous == nil {
+		return ErrNotFound
+	}
+
+	store.users[key] = user.Clone()
+	err := store.persist()
+	if err != nil {
+		store.users[key] = previous
+		return err
+	}
+	return nil
+}
+
+func (store *FileUserStore) Delete(tenant string, username string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	key := userKey(tenant, username)
+	previous := store.users[key]
+	if previous == nil {
+		return ErrNotFound
+	}
+
+	delete(store.users, key)
+	err := store.persist()
+	if err != nil {
+		store.users[key] = previous
+		return err
+	}
+	return nil
+}
+
+func (store *FileUserStore) List(tenant string) ([]*User, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	return listUsers(store.users, tenant), nil
+}
+
+func (store *FileUserStore) Tenants() ([]string, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	return listTenants(store.users), nil
+}
+
+func (store *FileUserStore) persist() error {
+	users := make([]*User, 0, len(store.users))
+	for _, user := range store.users {
+		users = append(users, user)
+	}
+
+	data, err := json.MarshalIndent(users, "", "  ")
+	if err != nil {
+		return fmt.Errorf("cannot encode users: %w", err)
+	}
+
+	return writeFileAtomic(store.filename, data, 0600)
+}
@@ -0,0 +1,59 @@
+package service_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/Dostonlv/pcbook/service"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileUserStore(t *testing.T) {
+	t.Parallel()
+
+	filename := filepath.Join(t.TempDir(), "users.json")
+
+	store, err := service.NewFileUserStore(filename)
+	require.NoError(t, err)
+
+	user, err := service.NewUser(service.DefaultTenant, "admin1", "secret", "admin")
+	require.NoError(t, err)
+	require.NoError(t, store.Save(user))
+	require.ErrorIs(t, store.Save(user), service.ErrAlreadyExists)
+
+	other, err := service.NewUser("acme", "admin1", "secret", "user")
+	require.NoError(t, err)
+	require.NoError(t, store.Save(other))
+
+	// the tenant of a saved user must be one the server can restore
+	_, err = service.NewUser("Acme", "admin1", "secret", "user")
+	require.ErrorIs(t, err, service.ErrInvalidTenant)
+
+	require.NoError(t, user.SetPassword("new-secret"))
+	user.Role = "user"
+	require.NoError(t, store.Update(user))
+
+	reopened, err := service.NewFileUserStore(filename)
+	require.NoError(t, err)
+
+	found, err := reopened.Find(service.DefaultTenant, "admin1")
+	require.NoError(t, err)
+	require.NotNil(t, found)
+	require.Equal(t, "user", found.Role)
+	require.True(t, found.IsCorrectPassword("new-secret"))
+	require.False(t, found.IsCorrectPassword("secret"))
+
+	require.NoError(t, reopened.Delete("acme", "admin1"))
+	require.ErrorIs(t, reopened.Delete("acme", "admin1"), service.ErrNotFound)
+
+	reopened, err = service.NewFileUserStore(filename)
+	require.NoError(t, err)
+
+	users, err := reopened.List("acme")
+	require.NoError(t, err)
+	require.Empty(t, users)
+
+	users, err = reopened.List(service.DefaultTenant)
+	require.NoError(t, err)
+	require.Len(t, users, 1)
+}
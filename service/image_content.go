@@ -0,0 +1,59 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"net/http"
+)
+
+var ErrInvalidImageContent = errors.New("invalid image content")
+
+const (
+	DefaultMaxImageWidth  = 8192
+	DefaultMaxImageHeight = 8192
+)
+
+// ImageLimits are the largest pixel dimensions of an uploaded image, 0 means no limit.
+type ImageLimits struct {
+	MaxWidth  int
+	MaxHeight int
+}
+
+// inspectImage checks that the content is an image of the declared MIME type within the limits,
+// and returns its metadata decoded from the image header.
+func inspectImage(data []byte, mimeType string, limits ImageLimits) (*ImageInfo, error) {
+	sniffed := http.DetectContentType(data)
+	if sniffed != mimeType {
+		return nil, fmt.Errorf("%w: content is %s, declared %s", ErrInvalidImageContent, sniffed, mimeType)
+	}
+
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: cannot decode image header: %v", ErrInvalidImageContent, err)
+	}
+	if "image/"+format != mimeType {
+		return nil, fmt.Errorf("%w: content is %s, declared %s", ErrInvalidImageContent, format, mimeType)
+	}
+
+	if config.Width <= 0 || config.Height <= 0 {
+		return nil, fmt.Errorf("%w: image is empty", ErrInvalidImageContent)
+	}
+	if limits.MaxWidth > 0 && config.Width > limits.MaxWidth ||
+		limits.MaxHeight > 0 && config.Height > limits.MaxHeight {
+		return nil, fmt.Errorf(
+			"%w: image is %dx%d pixels, at most %dx%d are allowed",
+			ErrInvalidImageContent, config.Width, config.Height, limits.MaxWidth, limits.MaxHeight,
+		)
+	}
+
+	return &ImageInfo{
+		Width:  config.Width,
+		Height: config.Height,
+		Format: format,
+	}, nil
+}
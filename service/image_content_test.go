@@ -0,0 +1,103 @@
+package service_test
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"testing"
+
+	"github.com/Dostonlv/pcbook/pb"
+	"github.com/Dostonlv/pcbook/sample"
+	"github.com/Dostonlv/pcbook/service"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func newTestImage(width, height int) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 128, A: 255})
+		}
+	}
+	return img
+}
+
+func newTestPNG(t *testing.T, width, height int) []byte {
+	buffer := bytes.Buffer{}
+	require.NoError(t, png.Encode(&buffer, newTestImage(width, height)))
+	return buffer.Bytes()
+}
+
+func newTestGIF(t *testing.T, width, height int) []byte {
+	buffer := bytes.Buffer{}
+	require.NoError(t, gif.Encode(&buffer, newTestImage(width, height), nil))
+	return buffer.Bytes()
+}
+
+func TestClientUploadImageContentValidation(t *testing.T) {
+	t.Parallel()
+
+	laptopStore := service.NewInMemoryLaptopStore()
+	imageStore := service.NewDiskImageStore(t.TempDir())
+
+	laptop := sample.NewLaptop()
+	require.NoError(t, laptopStore.Save(laptop))
+
+	laptopServer := service.NewLaptopServer(laptopStore, imageStore, nil,
+		service.WithImageLimits(service.ImageLimits{MaxWidth: 100, MaxHeight: 100}),
+	)
+	serverAddress := startTestLaptopServerWith(t, laptopServer)
+	laptopClient := newTestLaptopClient(t, serverAddress)
+
+	upload := func(imageType string, content []byte) (*pb.UploadImageResponse, error) {
+		stream, err := laptopClient.UploadImage(context.Background())
+		require.NoError(t, err)
+
+		err = stream.Send(&pb.UploadImageRequest{
+			Data: &pb.UploadImageRequest_Info{
+				Info: &pb.ImageInfo{LaptopId: laptop.GetId(), ImageType: imageType},
+			},
+		})
+		require.NoError(t, err)
+
+		err = stream.Send(&pb.UploadImageRequest{
+			Data: &pb.UploadImageRequest_ChunkData{ChunkData: content},
+		})
+		require.NoError(t, err)
+		return stream.CloseAndRecv()
+	}
+
+	testCases := []struct {
+		name      string
+		imageType string
+		content   []byte
+		code      codes.Code
+	}{
+		{"png", ".png", newTestPNG(t, 80, 60), codes.OK},
+		{"gif_as_mime_type", "image/gif", newTestGIF(t, 20, 10), codes.OK},
+		{"png_declared_as_jpeg", ".jpg", newTestPNG(t, 80, 60), codes.InvalidArgument},
+		{"not_an_image", ".png", []byte("<html>hello</html>"), codes.InvalidArgument},
+		{"truncated_header", ".png", newTestPNG(t, 80, 60)[:20], codes.InvalidArgument},
+		{"too_wide", ".png", newTestPNG(t, 101, 10), codes.InvalidArgument},
+	}
+
+	for _, tc := range testCases {
+		res, err := upload(tc.imageType, tc.content)
+		require.Equal(t, tc.code, status.Code(err), tc.name)
+		if tc.code != codes.OK {
+			continue
+		}
+
+		stored, err := laptopServer.GetImageInfo(context.Background(), &pb.GetImageInfoRequest{ImageId: res.GetId()})
+		require.NoError(t, err)
+		require.Equal(t, res.GetWidth(), stored.GetImage().GetWidth())
+		require.Equal(t, res.GetHeight(), stored.GetImage().GetHeight())
+		require.Equal(t, res.GetFormat(), stored.GetImage().GetFormat())
+		require.Equal(t, laptop.GetId(), stored.GetImage().GetLaptopId())
+	}
+}
@@ -0,0 +1,269 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/Dostonlv/pcbook/pb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// DefaultGCGracePeriod is how long a file no image refers to is kept,
+// so that the collector doesn't remove the content of uploads in progress.
+const DefaultGCGracePeriod = time.Hour
+
+// OrphanFile is a file of an image store that no image refers to.
+// Its path is relative to the image folder.
+type OrphanFile struct {
+	Path    string
+	Size    int64
+	ModTime time.Time
+}
+
+// OrphanFileStore is implemented by image stores keeping their content in files.
+// RemoveOrphanFiles removes the files no image refers to that weren't modified since the cutoff,
+// in a dry run it only returns them.
+type OrphanFileStore interface {
+	ImageStore
+	RemoveOrphanFiles(before time.Time, dryRun bool) ([]OrphanFile, error)
+}
+
+// removeOrphanFiles removes the files of the folder that aren't known and weren't modified since the cutoff.
+// Sub-folders are left alone.
+func removeOrphanFiles(root string, folder string, known func(name string) bool, before time.Time, dryRun bool) ([]OrphanFile, error) {
+	entries, err := os.ReadDir(folder)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read image folder: %w", err)
+	}
+
+	var orphans []OrphanFile
+	for _, entry := range entries {
+		if entry.IsDir() || known(entry.Name()) {
+			continue
+		}
+
+		info, err := entry.Info()
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return orphans, fmt.Errorf("cannot stat %s: %w", entry.Name(), err)
+		}
+		if !info.ModTime().Before(before) {
+			continue
+		}
+
+		path := filepath.Join(folder, entry.Name())
+		relativePath, err := filepath.Rel(root, path)
+		if err != nil {
+			return orphans, err
+		}
+
+		if !dryRun {
+			err = os.Remove(path)
+			if err != nil && !os.IsNotExist(err) {
+				return orphans, fmt.Errorf("cannot remove %s: %w", relativePath, err)
+			}
+		}
+		orphans = append(orphans, OrphanFile{
+			Path:    relativePath,
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+		})
+	}
+	return orphans, nil
+}
+
+// GCReport lists what a garbage collection of a tenant removed, or would remove in a dry run.
+type GCReport struct {
+	Tenant       string
+	DryRun       bool
+	OrphanImages []*ImageInfo
+	OrphanFiles  []OrphanFile
+}
+
+// ImageCollector reconciles the image stores with the laptop stores of the tenants:
+// it removes the files no image refers to, and if removeOrphanImages is set,
+// the images of laptops that no longer exist. That is only safe when the laptops outlive
+// a restart of the server, otherwise every image would be an orphan afterwards.
+type ImageCollector struct {
+	mutex              sync.Mutex
+	tenants            *TenantCatalogs
+	gracePeriod        time.Duration
+	removeOrphanImages bool
+}
+
+func NewImageCollector(tenants *TenantCatalogs, gracePeriod time.Duration, removeOrphanImages bool) *ImageCollector {
+	return &ImageCollector{
+		tenants:            tenants,
+		gracePeriod:        gracePeriod,
+		removeOrphanImages: removeOrphanImages,
+	}
+}
+
+// Collect runs a garbage collection of the tenant, only one runs at a time.
+func (collector *ImageCollector) Collect(tenant string, dryRun bool) (*GCReport, error) {
+	collector.mutex.Lock()
+	defer collector.mutex.Unlock()
+
+	catalog := collector.tenants.Find(tenant)
+	if catalog == nil {
+		return nil, fmt.Errorf("tenant %s: %w", tenant, ErrNotFound)
+	}
+
+	report := &GCReport{
+		Tenant: tenant,
+		DryRun: dryRun,
+	}
+	if catalog.imageStore == nil {
+		return report, nil
+	}
+
+	// the files of the removed images go along with them,
+	// so they are removed first to not report their files as orphans
+	if collector.removeOrphanImages {
+		orphanImages, err := collectOrphanImages(catalog, dryRun)
+		report.OrphanImages = orphanImages
+		if err != nil {
+			return report, err
+		}
+	}
+
+	if store, ok := catalog.imageStore.(OrphanFileStore); ok {
+		orphanFiles, err := store.RemoveOrphanFiles(time.Now().Add(-collector.gracePeriod), dryRun)
+		report.OrphanFiles = orphanFiles
+		if !dryRun {
+			catalog.imageMeter.RemoveOrphanFiles(orphanFiles)
+		}
+		if err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
+
+// collectOrphanImages removes the images of laptops that don't exist.
+func collectOrphanImages(catalog *Catalog, dryRun bool) ([]*ImageInfo, error) {
+	images, err := catalog.imageStore.ListAll()
+	if err != nil {
+		return nil, fmt.Errorf("cannot list images: %w", err)
+	}
+
+	var orphans []*ImageInfo
+	for _, image := range images {
+		// the images migrated from before the metadata files don't belong to any laptop
+		if image.LaptopID == "" {
+			continue
+		}
+
+		removed := false
+		err := catalog.uow.Do(image.LaptopID, func(tx *Tx) error {
+			laptop, err := tx.FindLaptop(image.LaptopID)
+			if err != nil {
+				return fmt.Errorf("cannot find laptop: %w", err)
+			}
+			if laptop != nil {
+				return nil
+			}
+
+			if dryRun {
+				removed = true
+				return nil
+			}
+
+			// the image may have been deleted in the meantime
+			err = tx.DeleteImage(image.ID)
+			removed = err == nil
+			if errors.Is(err, ErrNotFound) {
+				return nil
+			}
+			return err
+		})
+		if err != nil {
+			return orphans, fmt.Errorf("cannot collect image %s: %w", image.ID, err)
+		}
+		if removed {
+			orphans = append(orphans, image)
+		}
+	}
+	return orphans, nil
+}
+
+// CollectAll runs a garbage collection of every tenant.
+func (collector *ImageCollector) CollectAll(dryRun bool) ([]*GCReport, error) {
+	var reports []*GCReport
+	for _, tenant := range collector.tenants.List() {
+		report, err := collector.Collect(tenant, dryRun)
+		if errors.Is(err, ErrNotFound) && report == nil {
+			// the tenant was deleted in the meantime
+			continue
+		}
+		if err != nil {
+			return reports, fmt.Errorf("cannot collect images of tenant %s: %w", tenant, err)
+		}
+		reports = append(reports, report)
+	}
+	return reports, nil
+}
+
+// Run collects the garbage of every tenant at every interval until the context is done.
+func (collector *ImageCollector) Run(ctx context.Context, interval time.Duration, dryRun bool) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		reports, err := collector.CollectAll(dryRun)
+		for _, report := range reports {
+			if len(report.OrphanImages) > 0 || len(report.OrphanFiles) > 0 {
+				log.Printf(
+					"image garbage collection of tenant %s (dry run: %t): %d orphan images, %d orphan files",
+					report.Tenant, report.DryRun, len(report.OrphanImages), len(report.OrphanFiles),
+				)
+			}
+		}
+		if err != nil {
+			log.Printf("image garbage collection failed: %v", err)
+		}
+	}
+}
+
+func (server *LaptopServer) CollectImageGarbage(ctx context.Context, req *pb.CollectImageGarbageRequest) (*pb.CollectImageGarbageResponse, error) {
+	tenant := TenantFromContext(ctx)
+	log.Printf("receive a collect-image-garbage request for tenant %s, dry run: %t", tenant, req.GetDryRun())
+
+	if _, err := server.catalog(ctx); err != nil {
+		return nil, err
+	}
+
+	report, err := server.collector.Collect(tenant, req.GetDryRun())
+	if err != nil {
+		return nil, errorLog(status.Errorf(codes.Internal, "cannot collect image garbage: %v", err))
+	}
+
+	res := &pb.CollectImageGarbageResponse{
+		DryRun:       report.DryRun,
+		OrphanImages: imagesToPB(report.OrphanImages),
+	}
+	for _, file := range report.OrphanFiles {
+		res.OrphanFiles = append(res.OrphanFiles, &pb.OrphanFile{
+			Path:       file.Path,
+			Size:       uint64(file.Size),
+			ModifiedAt: timestamppb.New(file.ModTime),
+		})
+	}
+	return res, nil
+}
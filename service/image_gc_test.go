@@ -0,0 +1,178 @@
+package service_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/Dostonlv/pcbook/pb"
+	"github.com/Dostonlv/pcbook/sample"
+	"github.com/Dostonlv/pcbook/service"
+	"github.com/stretchr/testify/require"
+)
+
+// writeTestFile writes a file last modified at the given age.
+func writeTestFile(t *testing.T, path string, age time.Duration) {
+	require.NoError(t, os.WriteFile(path, []byte("orphan"), 0644))
+	modTime := time.Now().Add(-age)
+	require.NoError(t, os.Chtimes(path, modTime, modTime))
+}
+
+func orphanFilePaths(files []*pb.OrphanFile) []string {
+	var paths []string
+	for _, file := range files {
+		paths = append(paths, file.GetPath())
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func TestClientCollectImageGarbage(t *testing.T) {
+	t.Parallel()
+
+	imageFolder := t.TempDir()
+	laptopStore := service.NewInMemoryLaptopStore()
+	imageStore := service.NewDiskImageStore(imageFolder)
+
+	laptop := sample.NewLaptop()
+	deletedLaptop := sample.NewLaptop()
+	require.NoError(t, laptopStore.Save(laptop))
+	require.NoError(t, laptopStore.Save(deletedLaptop))
+
+	tenants := service.NewTenantCatalogs(service.NewCatalog(laptopStore, imageStore, service.NewInMemoryRatingStore()), nil)
+	laptopServer := service.NewMultiTenantLaptopServer(
+		tenants,
+		service.WithImageCollector(service.NewImageCollector(tenants, service.DefaultGCGracePeriod, true)),
+	)
+	serverAddress := startTestLaptopServerWith(t, laptopServer)
+	laptopClient := newTestLaptopClient(t, serverAddress)
+
+	imageID := uploadTestImage(t, laptopClient, laptop.GetId(), ".png", newTestPNG(t, 10, 10))
+	orphanImageID := uploadTestImage(t, laptopClient, deletedLaptop.GetId(), ".png", newTestPNG(t, 12, 10))
+	// the laptop is gone without its images, as after a crash
+	require.NoError(t, laptopStore.Delete(deletedLaptop.GetId()))
+
+	writeTestFile(t, filepath.Join(imageFolder, "stray.png"), 2*time.Hour)
+	writeTestFile(t, filepath.Join(imageFolder, "e8a1ef5c-93a4-4a59-b5f2-1b0a6d0c1a9f.tmp-123"), 2*time.Hour)
+	writeTestFile(t, filepath.Join(imageFolder, "e8a1ef5c-93a4-4a59-b5f2-1b0a6d0c1a9f_128.png"), 2*time.Hour)
+	writeTestFile(t, filepath.Join(imageFolder, "upload.tmp-456"), time.Minute)
+	require.NoError(t, os.Mkdir(filepath.Join(imageFolder, "quarantine"), 0755))
+	writeTestFile(t, filepath.Join(imageFolder, "quarantine", "broken.png"), 2*time.Hour)
+
+	expectedFiles := []string{
+		"e8a1ef5c-93a4-4a59-b5f2-1b0a6d0c1a9f.tmp-123",
+		"e8a1ef5c-93a4-4a59-b5f2-1b0a6d0c1a9f_128.png",
+		"stray.png",
+	}
+
+	res, err := laptopClient.CollectImageGarbage(context.Background(), &pb.CollectImageGarbageRequest{DryRun: true})
+	require.NoError(t, err)
+	require.True(t, res.GetDryRun())
+	require.Len(t, res.GetOrphanImages(), 1)
+	require.Equal(t, orphanImageID, res.GetOrphanImages()[0].GetId())
+	require.Equal(t, expectedFiles, orphanFilePaths(res.GetOrphanFiles()))
+
+	image, err := imageStore.Find(orphanImageID)
+	require.NoError(t, err)
+	require.NotNil(t, image)
+	require.FileExists(t, filepath.Join(imageFolder, "stray.png"))
+
+	res, err = laptopClient.CollectImageGarbage(context.Background(), &pb.CollectImageGarbageRequest{})
+	require.NoError(t, err)
+	require.False(t, res.GetDryRun())
+	require.Len(t, res.GetOrphanImages(), 1)
+	require.Equal(t, expectedFiles, orphanFilePaths(res.GetOrphanFiles()))
+
+	image, err = imageStore.Find(orphanImageID)
+	require.NoError(t, err)
+	require.Nil(t, image)
+	require.NoFileExists(t, filepath.Join(imageFolder, orphanImageID+".png"))
+	for _, path := range expectedFiles {
+		require.NoFileExists(t, filepath.Join(imageFolder, path))
+	}
+
+	// recent files, the quarantine and the images of existing laptops are kept
+	require.FileExists(t, filepath.Join(imageFolder, "upload.tmp-456"))
+	require.FileExists(t, filepath.Join(imageFolder, "quarantine", "broken.png"))
+	require.FileExists(t, filepath.Join(imageFolder, imageID+".png"))
+	require.FileExists(t, filepath.Join(imageFolder, imageID+".meta"))
+
+	res, err = laptopClient.CollectImageGarbage(context.Background(), &pb.CollectImageGarbageRequest{})
+	require.NoError(t, err)
+	require.Empty(t, res.GetOrphanImages())
+	require.Empty(t, res.GetOrphanFiles())
+
+	reopened, err := service.OpenDiskImageStore(imageFolder)
+	require.NoError(t, err)
+	images, err := reopened.ListAll()
+	require.NoError(t, err)
+	require.Len(t, images, 1)
+}
+
+func TestImageCollectorKeepsImagesOfMissingLaptops(t *testing.T) {
+	t.Parallel()
+
+	imageFolder := t.TempDir()
+	imageStore := service.NewDiskImageStore(imageFolder)
+	imageID, err := imageStore.Save(&service.ImageInfo{LaptopID: "unknown-laptop", Type: ".png"}, *bytes.NewBuffer(newTestPNG(t, 10, 10)))
+	require.NoError(t, err)
+
+	// as after a restart with an in-memory laptop store
+	catalog := service.NewCatalog(service.NewInMemoryLaptopStore(), imageStore, service.NewInMemoryRatingStore())
+	collector := service.NewImageCollector(service.NewTenantCatalogs(catalog, nil), 0, false)
+
+	reports, err := collector.CollectAll(false)
+	require.NoError(t, err)
+	require.Len(t, reports, 1)
+	require.Empty(t, reports[0].OrphanImages)
+	require.Empty(t, reports[0].OrphanFiles)
+
+	image, err := imageStore.Find(imageID)
+	require.NoError(t, err)
+	require.NotNil(t, image)
+	require.FileExists(t, filepath.Join(imageFolder, imageID+".png"))
+}
+
+func TestImageCollectorContentAddressedStore(t *testing.T) {
+	t.Parallel()
+
+	imageFolder := t.TempDir()
+	laptopStore := service.NewInMemoryLaptopStore()
+	imageStore, err := service.NewContentAddressedImageStore(imageFolder)
+	require.NoError(t, err)
+
+	laptop := sample.NewLaptop()
+	require.NoError(t, laptopStore.Save(laptop))
+	content := newTestPNG(t, 10, 10)
+	_, err = imageStore.Save(&service.ImageInfo{LaptopID: laptop.GetId(), Type: ".png"}, *bytes.NewBuffer(content))
+	require.NoError(t, err)
+
+	orphanDigest := service.ImageDigest([]byte("orphan"))
+	writeTestFile(t, filepath.Join(imageFolder, "blobs", orphanDigest), 2*time.Hour)
+	writeTestFile(t, filepath.Join(imageFolder, "renditions", orphanDigest+"_128.png"), 2*time.Hour)
+	writeTestFile(t, filepath.Join(imageFolder, "renditions", service.ImageDigest(content)+"_128.png"), 2*time.Hour)
+
+	catalog := service.NewCatalog(laptopStore, imageStore, service.NewInMemoryRatingStore())
+	collector := service.NewImageCollector(service.NewTenantCatalogs(catalog, nil), time.Hour, true)
+
+	reports, err := collector.CollectAll(false)
+	require.NoError(t, err)
+	require.Len(t, reports, 1)
+	require.Empty(t, reports[0].OrphanImages)
+
+	var paths []string
+	for _, file := range reports[0].OrphanFiles {
+		paths = append(paths, file.Path)
+	}
+	require.ElementsMatch(t, []string{
+		filepath.Join("blobs", orphanDigest),
+		filepath.Join("renditions", orphanDigest+"_128.png"),
+	}, paths)
+
+	require.FileExists(t, filepath.Join(imageFolder, "blobs", service.ImageDigest(content)))
+	require.FileExists(t, filepath.Join(imageFolder, "renditions", service.ImageDigest(content)+"_128.png"))
+}
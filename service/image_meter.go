@@ -0,0 +1,361 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// ImageMeter keeps the running image usage of a catalog, so that quotas are checked without listing
+// every image. It is loaded from the image store on first use, then the unit of work and the renditions
+// update it as images are committed and deleted. The stored bytes count the content shared by images once,
+// their renditions, and the files no image refers to which the collector hasn't removed yet.
+type ImageMeter struct {
+	mutex   sync.Mutex
+	store   ImageStore
+	loaded  bool
+	images  map[string]*ImageInfo
+	users   map[string]UsageCount
+	laptops map[string]UsageCount
+	// digests counts the images of every digest, with the size of their content
+	digests  map[string]UsageCount
+	contents map[string]*meteredContent
+	// orphans are the sizes of the files no image refers to by path
+	orphans     map[string]int64
+	storedBytes int64
+	// reservations are the images being committed, which count for the quotas until they are metered
+	reservations map[*ImageReservation]bool
+}
+
+// meteredContent is a stored file shared by images, with the sizes of its renditions.
+type meteredContent struct {
+	size       int64
+	images     int
+	renditions map[int]int64
+}
+
+// ImageReservation is the room an image being committed takes in the quotas:
+// an image of the laptop, its bytes for the owner and the bytes it adds to the store.
+type ImageReservation struct {
+	LaptopID string
+	Owner    string
+	Bytes    int64
+	Stored   int64
+}
+
+func NewImageMeter(store ImageStore) *ImageMeter {
+	return &ImageMeter{
+		store:        store,
+		images:       make(map[string]*ImageInfo),
+		users:        make(map[string]UsageCount),
+		laptops:      make(map[string]UsageCount),
+		digests:      make(map[string]UsageCount),
+		contents:     make(map[string]*meteredContent),
+		orphans:      make(map[string]int64),
+		reservations: make(map[*ImageReservation]bool),
+	}
+}
+
+// load lists the images of the store and measures their renditions of the sizes,
+// along with the files no image refers to, the first time it's called.
+func (meter *ImageMeter) load(renditionSizes []int) error {
+	if meter.loaded || meter.store == nil {
+		meter.loaded = true
+		return nil
+	}
+
+	images, err := meter.store.ListAll()
+	if err != nil {
+		return fmt.Errorf("cannot list images: %w", err)
+	}
+	for _, image := range images {
+		shared := meter.contents[image.Path] != nil
+		meter.add(image)
+		if shared {
+			continue
+		}
+
+		content := meter.contents[image.Path]
+		for _, size := range renditionSizes {
+			renditionSize, err := measureRendition(meter.store, image.ID, size)
+			if errors.Is(err, ErrNotFound) {
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("cannot measure rendition of image %s: %w", image.ID, err)
+			}
+			content.renditions[size] = renditionSize
+			meter.storedBytes += renditionSize
+		}
+	}
+
+	// the files of the uploads in progress are left out until they are committed
+	if store, ok := meter.store.(OrphanFileStore); ok {
+		orphanFiles, err := store.RemoveOrphanFiles(time.Now().Add(-DefaultGCGracePeriod), true)
+		if err != nil {
+			return fmt.Errorf("cannot list orphan files: %w", err)
+		}
+		for _, file := range orphanFiles {
+			meter.orphans[file.Path] = file.Size
+			meter.storedBytes += file.Size
+		}
+	}
+
+	meter.loaded = true
+	return nil
+}
+
+func measureRendition(store ImageStore, imageID string, size int) (int64, error) {
+	rendition, err := store.OpenRendition(imageID, size)
+	if err != nil {
+		return 0, err
+	}
+	defer rendition.Close()
+
+	if file, ok := rendition.(*os.File); ok {
+		stat, err := file.Stat()
+		if err != nil {
+			return 0, err
+		}
+		return stat.Size(), nil
+	}
+	return io.Copy(io.Discard, rendition)
+}
+
+func (meter *ImageMeter) add(image *ImageInfo) {
+	if meter.images[image.ID] != nil {
+		return
+	}
+	meter.images[image.ID] = image.Clone()
+
+	if image.Owner != "" {
+		count := meter.users[image.Owner]
+		count.add(image)
+		meter.users[image.Owner] = count
+	}
+
+	count := meter.laptops[image.LaptopID]
+	count.add(image)
+	meter.laptops[image.LaptopID] = count
+
+	digest := meter.digests[image.Digest]
+	digest.Images++
+	digest.Bytes = image.Size
+	meter.digests[image.Digest] = digest
+
+	content := meter.contents[image.Path]
+	if content == nil {
+		content = &meteredContent{
+			size:       image.Size,
+			renditions: make(map[int]int64),
+		}
+		meter.contents[image.Path] = content
+		meter.storedBytes += image.Size
+	}
+	content.images++
+}
+
+func (meter *ImageMeter) remove(imageID string) {
+	image := meter.images[imageID]
+	if image == nil {
+		return
+	}
+	delete(meter.images, imageID)
+
+	if image.Owner != "" {
+		meter.users[image.Owner] = subtractUsage(meter.users[image.Owner], image.Size)
+		if meter.users[image.Owner].Images == 0 {
+			delete(meter.users, image.Owner)
+		}
+	}
+
+	meter.laptops[image.LaptopID] = subtractUsage(meter.laptops[image.LaptopID], image.Size)
+	if meter.laptops[image.LaptopID].Images == 0 {
+		delete(meter.laptops, image.LaptopID)
+	}
+
+	digest := meter.digests[image.Digest]
+	digest.Images--
+	meter.digests[image.Digest] = digest
+	if digest.Images <= 0 {
+		delete(meter.digests, image.Digest)
+	}
+
+	content := meter.contents[image.Path]
+	content.images--
+	if content.images > 0 {
+		return
+	}
+
+	// the renditions of the content are deleted along with it
+	meter.storedBytes -= content.size
+	for _, size := range content.renditions {
+		meter.storedBytes -= size
+	}
+	delete(meter.contents, image.Path)
+}
+
+func subtractUsage(count UsageCount, size int64) UsageCount {
+	count.Images--
+	count.Bytes -= size
+	return count
+}
+
+// Add meters the image the unit of work committed.
+func (meter *ImageMeter) Add(image *ImageInfo) {
+	if meter == nil {
+		return
+	}
+
+	meter.mutex.Lock()
+	defer meter.mutex.Unlock()
+
+	// the images committed before the meter is loaded are listed by the store
+	if meter.loaded {
+		meter.add(image)
+	}
+}
+
+// Remove stops metering the image the unit of work deleted.
+func (meter *ImageMeter) Remove(imageID string) {
+	if meter == nil {
+		return
+	}
+
+	meter.mutex.Lock()
+	defer meter.mutex.Unlock()
+
+	meter.remove(imageID)
+}
+
+// AddRendition meters a rendition of the image, replacing the previous one of the size.
+func (meter *ImageMeter) AddRendition(imageID string, size int, renditionSize int64) {
+	meter.mutex.Lock()
+	defer meter.mutex.Unlock()
+
+	image := meter.images[imageID]
+	if image == nil {
+		return
+	}
+
+	content := meter.contents[image.Path]
+	meter.storedBytes += renditionSize - content.renditions[size]
+	content.renditions[size] = renditionSize
+}
+
+// RemoveOrphanFiles stops metering the files the collector removed.
+func (meter *ImageMeter) RemoveOrphanFiles(files []OrphanFile) {
+	meter.mutex.Lock()
+	defer meter.mutex.Unlock()
+
+	for _, file := range files {
+		size, found := meter.orphans[file.Path]
+		if found {
+			meter.storedBytes -= size
+			delete(meter.orphans, file.Path)
+		}
+	}
+}
+
+// Usage returns the images of the store summed by user and by laptop.
+func (meter *ImageMeter) Usage(renditionSizes []int) (*ImageUsage, error) {
+	meter.mutex.Lock()
+	defer meter.mutex.Unlock()
+
+	err := meter.load(renditionSizes)
+	if err != nil {
+		return nil, err
+	}
+
+	usage := &ImageUsage{
+		Users:       make(map[string]UsageCount, len(meter.users)),
+		Laptops:     make(map[string]UsageCount, len(meter.laptops)),
+		StoredBytes: meter.storedBytes,
+	}
+	for username, count := range meter.users {
+		usage.Users[username] = count
+	}
+	for laptopID, count := range meter.laptops {
+		usage.Laptops[laptopID] = count
+	}
+	return usage, nil
+}
+
+// StoredBytes returns the bytes the store takes, including the ones reserved by the images being committed.
+func (meter *ImageMeter) StoredBytes(renditionSizes []int) (int64, error) {
+	meter.mutex.Lock()
+	defer meter.mutex.Unlock()
+
+	err := meter.load(renditionSizes)
+	if err != nil {
+		return 0, err
+	}
+
+	storedBytes := meter.storedBytes
+	for reservation := range meter.reservations {
+		storedBytes += reservation.Stored
+	}
+	return storedBytes, nil
+}
+
+// QuotaUsage returns the images of the laptop and the bytes of the owner, including the reserved ones,
+// and the size of the content of the digest if the store has it.
+func (meter *ImageMeter) QuotaUsage(renditionSizes []int, laptopID string, owner string, digest string) (int, int64, int64, bool, error) {
+	meter.mutex.Lock()
+	defer meter.mutex.Unlock()
+
+	err := meter.load(renditionSizes)
+	if err != nil {
+		return 0, 0, 0, false, err
+	}
+
+	laptopImages := meter.laptops[laptopID].Images
+	userBytes := meter.users[owner].Bytes
+	for reservation := range meter.reservations {
+		if reservation.LaptopID == laptopID {
+			laptopImages++
+		}
+		if reservation.Owner == owner {
+			userBytes += reservation.Bytes
+		}
+	}
+
+	content, found := meter.digests[digest]
+	return laptopImages, userBytes, content.Bytes, found, nil
+}
+
+// Reserve counts the image being committed for the quotas until the reservation is released.
+func (meter *ImageMeter) Reserve(reservation *ImageReservation) {
+	meter.mutex.Lock()
+	defer meter.mutex.Unlock()
+
+	meter.reservations[reservation] = true
+}
+
+func (meter *ImageMeter) Release(reservation *ImageReservation) {
+	meter.mutex.Lock()
+	defer meter.mutex.Unlock()
+
+	delete(meter.reservations, reservation)
+}
+
+// meteredRenditionStore meters the renditions saved to the image store.
+type meteredRenditionStore struct {
+	ImageStore
+	meter *ImageMeter
+}
+
+func (store *meteredRenditionStore) SaveRendition(imageID string, size int, data bytes.Buffer) error {
+	renditionSize := int64(data.Len())
+	err := store.ImageStore.SaveRendition(imageID, size, data)
+	if err != nil {
+		return err
+	}
+
+	store.meter.AddRendition(imageID, size, renditionSize)
+	return nil
+}
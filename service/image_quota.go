@@ -0,0 +1,209 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+
+	"github.com/Dostonlv/pcbook/pb"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ImageQuotas limits the images clients can upload, a zero limit means there is no limit.
+// The bytes of a user are the sizes of the images they uploaded in their tenant,
+// the total bytes are the content stored for all tenants, counting shared content once.
+type ImageQuotas struct {
+	MaxImagesPerLaptop int
+	MaxBytesPerUser    int64
+	MaxTotalBytes      int64
+}
+
+func (quotas ImageQuotas) enabled() bool {
+	return quotas != ImageQuotas{}
+}
+
+// UsageCount is the number of images and their total size.
+type UsageCount struct {
+	Images int
+	Bytes  int64
+}
+
+func (count *UsageCount) add(image *ImageInfo) {
+	count.Images++
+	count.Bytes += image.Size
+}
+
+// ImageUsage sums the images of a store by the user who uploaded them and by laptop.
+type ImageUsage struct {
+	Users       map[string]UsageCount
+	Laptops     map[string]UsageCount
+	StoredBytes int64
+}
+
+// totalImageBytes returns the bytes stored for all tenants, including the reserved ones.
+func (server *LaptopServer) totalImageBytes() (int64, error) {
+	var total int64
+	for _, tenant := range server.tenants.List() {
+		catalog := server.tenants.Find(tenant)
+		if catalog == nil {
+			continue
+		}
+
+		storedBytes, err := catalog.imageMeter.StoredBytes(server.renditions.Sizes())
+		if err != nil {
+			return 0, err
+		}
+		total += storedBytes
+	}
+	return total, nil
+}
+
+// checkQuotas returns a ResourceExhausted error with a QuotaFailure detail
+// if the user and the laptop have no room left for an image.
+func (server *LaptopServer) checkQuotas(catalog *Catalog, info *ImageInfo) error {
+	reservation, err := server.reserveQuotas(catalog, info, "", nil)
+	if err != nil {
+		return err
+	}
+	catalog.imageMeter.Release(reservation)
+	return nil
+}
+
+// reserveQuotas returns a ResourceExhausted error with a QuotaFailure detail if the image doesn't fit
+// in the quotas, otherwise it reserves room for the image until the reservation is released.
+// Content the store already shares by digest takes no more space on disk, but counts for the user adding the image.
+// Without an upload or a digest, it checks that the user and the laptop have room left for an image.
+func (server *LaptopServer) reserveQuotas(catalog *Catalog, info *ImageInfo, digest string, upload *imageUpload) (*ImageReservation, error) {
+	reservation := &ImageReservation{
+		LaptopID: info.LaptopID,
+		Owner:    info.Owner,
+	}
+	quotas := server.quotas
+	if !quotas.enabled() {
+		return reservation, nil
+	}
+
+	// the total bytes of all tenants must not change between the check and the reservation
+	server.quotaMutex.Lock()
+	defer server.quotaMutex.Unlock()
+
+	if upload != nil {
+		digest = upload.writer.Digest()
+	}
+	laptopImages, userBytes, digestSize, found, err := catalog.imageMeter.QuotaUsage(server.renditions.Sizes(), info.LaptopID, info.Owner, digest)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot compute image usage: %v", err)
+	}
+
+	size, stored := int64(1), int64(0)
+	if upload != nil {
+		size = upload.Size()
+		stored = size
+
+		// a store sharing content by digest doesn't keep the same content twice
+		_, shared := catalog.imageStore.(DigestImageStore)
+		if shared && found {
+			stored = 0
+		}
+	} else if digest != "" {
+		size = digestSize
+	}
+	reservation.Bytes = size
+	reservation.Stored = stored
+
+	var violations []*errdetails.QuotaFailure_Violation
+	exceeds := func(used int64, added int64, limit int64) bool {
+		return limit > 0 && used+added > limit
+	}
+
+	if exceeds(int64(laptopImages), 1, int64(quotas.MaxImagesPerLaptop)) {
+		violations = append(violations, &errdetails.QuotaFailure_Violation{
+			Subject:     "laptop:" + info.LaptopID,
+			Description: fmt.Sprintf("laptop has %d of %d images", laptopImages, quotas.MaxImagesPerLaptop),
+		})
+	}
+
+	if info.Owner != "" && exceeds(userBytes, size, quotas.MaxBytesPerUser) {
+		violations = append(violations, &errdetails.QuotaFailure_Violation{
+			Subject:     "user:" + info.Owner,
+			Description: fmt.Sprintf("user has %d of %d bytes of images, the image has %d bytes", userBytes, quotas.MaxBytesPerUser, size),
+		})
+	}
+
+	if quotas.MaxTotalBytes > 0 {
+		totalBytes, err := server.totalImageBytes()
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "cannot compute image usage: %v", err)
+		}
+		if exceeds(totalBytes, stored, quotas.MaxTotalBytes) {
+			violations = append(violations, &errdetails.QuotaFailure_Violation{
+				Subject:     "images",
+				Description: fmt.Sprintf("images take %d of %d bytes, the image has %d bytes", totalBytes, quotas.MaxTotalBytes, stored),
+			})
+		}
+	}
+
+	if len(violations) == 0 {
+		catalog.imageMeter.Reserve(reservation)
+		return reservation, nil
+	}
+
+	st, err := status.New(codes.ResourceExhausted, "image quota is exceeded").
+		WithDetails(&errdetails.QuotaFailure{Violations: violations})
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot attach quota failure: %v", err)
+	}
+	return nil, st.Err()
+}
+
+func usageToPB(count UsageCount) *pb.ImageUsage {
+	return &pb.ImageUsage{
+		ImageCount: uint32(count.Images),
+		Bytes:      uint64(count.Bytes),
+	}
+}
+
+func (server *LaptopServer) GetImageUsage(ctx context.Context, req *pb.GetImageUsageRequest) (*pb.GetImageUsageResponse, error) {
+	log.Printf("receive a get-image-usage request for tenant %s", TenantFromContext(ctx))
+
+	catalog, err := server.catalog(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	usage, err := catalog.imageMeter.Usage(server.renditions.Sizes())
+	if err != nil {
+		return nil, errorLog(status.Errorf(codes.Internal, "cannot compute image usage: %v", err))
+	}
+
+	totalBytes, err := server.totalImageBytes()
+	if err != nil {
+		return nil, errorLog(status.Errorf(codes.Internal, "cannot compute image usage: %v", err))
+	}
+
+	res := &pb.GetImageUsageResponse{
+		Quotas: &pb.ImageQuotas{
+			MaxImagesPerLaptop: uint32(server.quotas.MaxImagesPerLaptop),
+			MaxBytesPerUser:    uint64(server.quotas.MaxBytesPerUser),
+			MaxTotalBytes:      uint64(server.quotas.MaxTotalBytes),
+		},
+		TotalBytes: uint64(totalBytes),
+	}
+	for username, count := range usage.Users {
+		res.Users = append(res.Users, &pb.UserImageUsage{Username: username, Usage: usageToPB(count)})
+	}
+	for laptopID, count := range usage.Laptops {
+		res.Laptops = append(res.Laptops, &pb.LaptopImageUsage{LaptopId: laptopID, Usage: usageToPB(count)})
+	}
+
+	sort.Slice(res.Users, func(i, j int) bool {
+		return res.Users[i].Username < res.Users[j].Username
+	})
+	sort.Slice(res.Laptops, func(i, j int) bool {
+		return res.Laptops[i].LaptopId < res.Laptops[j].LaptopId
+	})
+	return res, nil
+}
@@ -0,0 +1,201 @@
+package service_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Dostonlv/pcbook/pb"
+	"github.com/Dostonlv/pcbook/sample"
+	"github.com/Dostonlv/pcbook/service"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func startTestAuthLaptopServer(t *testing.T, laptopServer *service.LaptopServer, jwtManager *service.JWTManager) string {
+	interceptor := service.NewAuthInterceptor(jwtManager, nil)
+	grpcServer := grpc.NewServer(
+		grpc.UnaryInterceptor(interceptor.Unary()),
+		grpc.StreamInterceptor(interceptor.Stream()),
+	)
+	pb.RegisterLaptopServiceServer(grpcServer, laptopServer)
+
+	listener, err := net.Listen("tcp", ":0")
+	require.NoError(t, err)
+	go grpcServer.Serve(listener)
+	t.Cleanup(grpcServer.Stop)
+
+	return listener.Addr().String()
+}
+
+// newTestUserClient returns a client sending the access token of the user with every request.
+func newTestUserClient(t *testing.T, serverAddress string, jwtManager *service.JWTManager, username string) pb.LaptopServiceClient {
+	return pb.NewLaptopServiceClient(newTestUserConn(t, serverAddress, jwtManager, username))
+}
+
+func newTestUserConn(t *testing.T, serverAddress string, jwtManager *service.JWTManager, username string) *grpc.ClientConn {
+	user, err := service.NewUser(service.DefaultTenant, username, "secret", "admin")
+	require.NoError(t, err)
+	token, err := jwtManager.Generate(user)
+	require.NoError(t, err)
+
+	conn, err := grpc.Dial(
+		serverAddress,
+		grpc.WithInsecure(),
+		grpc.WithUnaryInterceptor(func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+			return invoker(metadata.AppendToOutgoingContext(ctx, "authorization", token), method, req, reply, cc, opts...)
+		}),
+		grpc.WithStreamInterceptor(func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+			return streamer(metadata.AppendToOutgoingContext(ctx, "authorization", token), desc, cc, method, opts...)
+		}),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func requireQuotaFailure(t *testing.T, err error, subject string) {
+	require.Equal(t, codes.ResourceExhausted, status.Code(err), "%v", err)
+
+	var subjects []string
+	for _, detail := range status.Convert(err).Details() {
+		if failure, ok := detail.(*errdetails.QuotaFailure); ok {
+			for _, violation := range failure.GetViolations() {
+				subjects = append(subjects, violation.GetSubject())
+			}
+		}
+	}
+	require.Contains(t, subjects, subject)
+}
+
+func TestClientImageQuotas(t *testing.T) {
+	t.Parallel()
+
+	laptopStore := service.NewInMemoryLaptopStore()
+	imageStore := service.NewDiskImageStore(t.TempDir())
+	laptop1 := sample.NewLaptop()
+	laptop2 := sample.NewLaptop()
+	require.NoError(t, laptopStore.Save(laptop1))
+	require.NoError(t, laptopStore.Save(laptop2))
+
+	image1 := newTestPNG(t, 10, 10)
+	image2 := newTestPNG(t, 12, 10)
+
+	laptopServer := service.NewLaptopServer(laptopStore, imageStore, nil, service.WithImageQuotas(service.ImageQuotas{
+		MaxImagesPerLaptop: 2,
+		MaxBytesPerUser:    int64(len(image1) + len(image2)),
+	}))
+	jwtManager := service.NewJWTManager("secret", time.Minute)
+	serverAddress := startTestAuthLaptopServer(t, laptopServer, jwtManager)
+	alice := newTestUserClient(t, serverAddress, jwtManager, "alice")
+	bob := newTestUserClient(t, serverAddress, jwtManager, "bob")
+
+	upload := func(client pb.LaptopServiceClient, laptopID string, content []byte) error {
+		_, err := uploadTestImageInChunks(client, &pb.ImageInfo{LaptopId: laptopID, ImageType: ".png"}, content)
+		return err
+	}
+
+	require.NoError(t, upload(alice, laptop1.GetId(), image1))
+	require.NoError(t, upload(bob, laptop1.GetId(), image1))
+	requireQuotaFailure(t, upload(bob, laptop1.GetId(), image2), "laptop:"+laptop1.GetId())
+
+	// alice has room for image2 but not for a larger image
+	requireQuotaFailure(t, upload(alice, laptop2.GetId(), newTestNoisePNG(t, 20, 20)), "user:alice")
+	require.NoError(t, upload(alice, laptop2.GetId(), image2))
+	requireQuotaFailure(t, upload(alice, laptop2.GetId(), image1), "user:alice")
+
+	_, err := alice.StartImageUpload(context.Background(), &pb.StartImageUploadRequest{
+		Info: &pb.ImageInfo{LaptopId: laptop2.GetId(), ImageType: ".png"},
+	})
+	requireQuotaFailure(t, err, "user:alice")
+
+	res, err := alice.GetImageUsage(context.Background(), &pb.GetImageUsageRequest{})
+	require.NoError(t, err)
+	require.EqualValues(t, 2, res.GetQuotas().GetMaxImagesPerLaptop())
+	require.EqualValues(t, 2*len(image1)+len(image2), res.GetTotalBytes())
+
+	require.Len(t, res.GetUsers(), 2)
+	require.Equal(t, "alice", res.GetUsers()[0].GetUsername())
+	require.EqualValues(t, 2, res.GetUsers()[0].GetUsage().GetImageCount())
+	require.EqualValues(t, len(image1)+len(image2), res.GetUsers()[0].GetUsage().GetBytes())
+	require.Equal(t, "bob", res.GetUsers()[1].GetUsername())
+	require.EqualValues(t, len(image1), res.GetUsers()[1].GetUsage().GetBytes())
+
+	laptopImages := make(map[string]uint32)
+	for _, laptop := range res.GetLaptops() {
+		laptopImages[laptop.GetLaptopId()] = laptop.GetUsage().GetImageCount()
+	}
+	require.Equal(t, map[string]uint32{laptop1.GetId(): 2, laptop2.GetId(): 1}, laptopImages)
+}
+
+func TestClientImageTotalQuota(t *testing.T) {
+	t.Parallel()
+
+	laptopStore := service.NewInMemoryLaptopStore()
+	imageStore, err := service.NewContentAddressedImageStore(t.TempDir())
+	require.NoError(t, err)
+	laptop := sample.NewLaptop()
+	require.NoError(t, laptopStore.Save(laptop))
+
+	image1 := newTestPNG(t, 10, 10)
+	laptopServer := service.NewLaptopServer(laptopStore, imageStore, nil, service.WithImageQuotas(service.ImageQuotas{
+		MaxTotalBytes: int64(len(image1)),
+	}))
+	laptopClient := newTestLaptopClient(t, startTestLaptopServerWith(t, laptopServer))
+
+	info := &pb.ImageInfo{LaptopId: laptop.GetId(), ImageType: ".png"}
+	_, err = uploadTestImageInChunks(laptopClient, info, image1)
+	require.NoError(t, err)
+
+	_, err = uploadTestImageInChunks(laptopClient, info, newTestPNG(t, 12, 10))
+	requireQuotaFailure(t, err, "images")
+
+	// the content is stored once, so the same image can be uploaded again
+	res, err := uploadTestImageInChunks(laptopClient, info, image1)
+	require.NoError(t, err)
+	require.NotEmpty(t, res.GetId())
+}
+
+func TestClientImageUsageCountsRenditions(t *testing.T) {
+	t.Parallel()
+
+	laptopStore := service.NewInMemoryLaptopStore()
+	imageStore := service.NewDiskImageStore(t.TempDir())
+	laptop := sample.NewLaptop()
+	require.NoError(t, laptopStore.Save(laptop))
+
+	renditions, err := service.NewRenditioner([]int{16}, 0, 0)
+	require.NoError(t, err)
+	newClient := func() pb.LaptopServiceClient {
+		laptopServer := service.NewLaptopServer(laptopStore, imageStore, nil, service.WithRenditions(renditions))
+		return newTestLaptopClient(t, startTestLaptopServerWith(t, laptopServer))
+	}
+	totalBytes := func(laptopClient pb.LaptopServiceClient) uint64 {
+		res, err := laptopClient.GetImageUsage(context.Background(), &pb.GetImageUsageRequest{})
+		require.NoError(t, err)
+		return res.GetTotalBytes()
+	}
+
+	laptopClient := newClient()
+	require.Zero(t, totalBytes(laptopClient))
+
+	original := newTestPNG(t, 64, 48)
+	imageID := uploadTestImage(t, laptopClient, laptop.GetId(), ".png", original)
+	require.EqualValues(t, len(original), totalBytes(laptopClient))
+
+	_, rendition, err := downloadTestRendition(laptopClient, imageID, 16)
+	require.NoError(t, err)
+	require.EqualValues(t, len(original)+len(rendition), totalBytes(laptopClient))
+
+	// a new server measures the stored renditions
+	require.EqualValues(t, len(original)+len(rendition), totalBytes(newClient()))
+
+	_, err = laptopClient.DeleteImage(context.Background(), &pb.DeleteImageRequest{ImageId: imageID})
+	require.NoError(t, err)
+	require.Zero(t, totalBytes(laptopClient))
+}
@@ -2,15 +2,49 @@ package service
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"image"
+	"io"
+	"log"
 	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/google/uuid"
 )
 
+const (
+	metadataExt      = ".meta"
+	quarantineFolder = "quarantine"
+)
+
+// renditionPattern matches the file names of renditions: <image ID>_<size><extension>.
+var renditionPattern = regexp.MustCompile(`^(.+)_([0-9]+)(\.[a-z0-9]+)$`)
+
+// ImageStore saves image content along with its metadata.
+// The content of a new image is streamed through the ImageWriter returned by Create.
+// List returns the images of a laptop in gallery order, ListAll the images of every laptop.
+// Update changes the gallery details of an image: its caption, alt text, position and primary flag.
+// The renditions of an image are stored next to it and deleted along with it,
+// Open and OpenRendition return ErrNotFound if there is no such content.
 type ImageStore interface {
-	Save(LaptopID string, ImageType string, ImageData bytes.Buffer) (string, error)
+	Create() (ImageWriter, error)
+	Find(imageID string) (*ImageInfo, error)
+	List(laptopID string) ([]*ImageInfo, error)
+	ListAll() ([]*ImageInfo, error)
+	Update(image *ImageInfo) error
+	Open(imageID string) (io.ReadCloser, error)
+	SaveRendition(imageID string, size int, data bytes.Buffer) error
+	OpenRendition(imageID string, size int) (io.ReadCloser, error)
+	Delete(imageID string) error
 }
 
 type DiskImageStore struct {
@@ -20,9 +54,64 @@ type DiskImageStore struct {
 }
 
 type ImageInfo struct {
-	LaptopID string
-	Type     string
-	Path     string
+	ID        string    `json:"id"`
+	LaptopID  string    `json:"laptop_id"`
+	Type      string    `json:"type"`
+	Path      string    `json:"-"`
+	Size      int64     `json:"size"`
+	Digest    string    `json:"checksum"`
+	Width     int       `json:"width"`
+	Height    int       `json:"height"`
+	Format    string    `json:"format"`
+	CreatedAt time.Time `json:"created_at"`
+	Caption   string    `json:"caption,omitempty"`
+	AltText   string    `json:"alt_text,omitempty"`
+	Position  int       `json:"position"`
+	Primary   bool      `json:"primary,omitempty"`
+	Owner     string    `json:"owner,omitempty"`
+}
+
+func (image *ImageInfo) Clone() *ImageInfo {
+	other := *image
+	return &other
+}
+
+// updateDetails copies the gallery details of other to the image.
+func (image *ImageInfo) updateDetails(other *ImageInfo) {
+	image.Caption = other.Caption
+	image.AltText = other.AltText
+	image.Position = other.Position
+	image.Primary = other.Primary
+}
+
+// listImages returns copies of the images of the laptop, ordered by position.
+func listImages(images map[string]*ImageInfo, laptopID string) []*ImageInfo {
+	var result []*ImageInfo
+	for _, image := range images {
+		if image.LaptopID == laptopID {
+			result = append(result, image.Clone())
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Position != result[j].Position {
+			return result[i].Position < result[j].Position
+		}
+		if !result[i].CreatedAt.Equal(result[j].CreatedAt) {
+			return result[i].CreatedAt.Before(result[j].CreatedAt)
+		}
+		return result[i].ID < result[j].ID
+	})
+	return result
+}
+
+// allImages returns copies of all the images.
+func allImages(images map[string]*ImageInfo) []*ImageInfo {
+	result := make([]*ImageInfo, 0, len(images))
+	for _, image := range images {
+		result = append(result, image.Clone())
+	}
+	return result
 }
 
 func NewDiskImageStore(imageFolder string) *DiskImageStore {
@@ -32,31 +121,446 @@ func NewDiskImageStore(imageFolder string) *DiskImageStore {
 	}
 }
 
-func (store *DiskImageStore) Save(laptopID string, imageType string, imageData bytes.Buffer) (string, error) {
+// OpenDiskImageStore rebuilds the image index from the metadata files in the folder.
+// Partial writes, images that don't match their metadata and unknown files
+// are moved into the quarantine folder. A folder without any metadata file was written
+// before they existed, so its images are migrated instead.
+func OpenDiskImageStore(imageFolder string) (*DiskImageStore, error) {
+	store := NewDiskImageStore(imageFolder)
+
+	entries, err := os.ReadDir(imageFolder)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read image folder: %w", err)
+	}
+
+	known := make(map[string]bool)
+	hasMetadata := false
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != metadataExt {
+			continue
+		}
+		hasMetadata = true
+
+		image, err := store.loadMetadata(entry.Name())
+		if err != nil {
+			log.Printf("quarantine image metadata %s: %v", entry.Name(), err)
+			continue
+		}
+
+		store.images[image.ID] = image
+		known[entry.Name()] = true
+		known[filepath.Base(image.Path)] = true
+	}
+
+	if !hasMetadata {
+		err = store.migrate(entries, known)
+		if err != nil {
+			return nil, fmt.Errorf("cannot migrate images: %w", err)
+		}
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || known[entry.Name()] || store.isRendition(entry.Name()) {
+			continue
+		}
+
+		log.Printf("quarantine unknown image file %s", entry.Name())
+		err := store.quarantine(entry.Name())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	log.Printf("loaded %d images from %s", len(store.images), imageFolder)
+	return store, nil
+}
+
+// migrate writes the metadata of the images saved before the metadata files existed.
+// Their laptop isn't known, so they don't belong to any.
+func (store *DiskImageStore) migrate(entries []os.DirEntry, known map[string]bool) error {
+	for _, entry := range entries {
+		if entry.IsDir() || known[entry.Name()] {
+			continue
+		}
+
+		imageType := filepath.Ext(entry.Name())
+		imageID := strings.TrimSuffix(entry.Name(), imageType)
+		if _, err := uuid.Parse(imageID); err != nil || !extensionPattern.MatchString(imageType) {
+			continue
+		}
+
+		image, err := store.legacyImage(imageID, imageType)
+		if err != nil {
+			log.Printf("cannot migrate image file %s: %v", entry.Name(), err)
+			continue
+		}
+
+		err = store.writeMetadata(image)
+		if err != nil {
+			return fmt.Errorf("cannot write metadata of image %s: %w", imageID, err)
+		}
+
+		log.Printf("migrated image file %s", entry.Name())
+		store.images[image.ID] = image
+		known[entry.Name()] = true
+		known[image.ID+metadataExt] = true
+	}
+	return nil
+}
+
+func (store *DiskImageStore) legacyImage(imageID string, imageType string) (*ImageInfo, error) {
+	imagePath, err := imageFilePath(store.imageFolder, imageID, imageType)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(imagePath)
+	if err != nil {
+		return nil, err
+	}
+	fileInfo, err := os.Stat(imagePath)
+	if err != nil {
+		return nil, err
+	}
+
+	legacy := &ImageInfo{
+		ID:        imageID,
+		Type:      imageType,
+		Path:      imagePath,
+		Size:      int64(len(data)),
+		Digest:    ImageDigest(data),
+		CreatedAt: fileInfo.ModTime().UTC(),
+	}
+
+	// the content wasn't inspected on upload, so it may not be decodable
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err == nil {
+		legacy.Width = config.Width
+		legacy.Height = config.Height
+		legacy.Format = format
+	}
+	return legacy, nil
+}
+
+func (store *DiskImageStore) loadMetadata(name string) (*ImageInfo, error) {
+	data, err := os.ReadFile(filepath.Join(store.imageFolder, name))
+	if err != nil {
+		return nil, err
+	}
+
+	image := &ImageInfo{}
+	err = json.Unmarshal(data, image)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode metadata: %w", err)
+	}
+	if image.ID+metadataExt != name {
+		return nil, fmt.Errorf("metadata belongs to image %s", image.ID)
+	}
+
+	image.Path, err = imageFilePath(store.imageFolder, image.ID, image.Type)
+	if err != nil {
+		return nil, err
+	}
+
+	err = verifyImageFile(image)
+	if err != nil {
+		return nil, err
+	}
+	return image, nil
+}
+
+func verifyImageFile(image *ImageInfo) error {
+	file, err := os.Open(image.Path)
+	if err != nil {
+		return fmt.Errorf("cannot open image file: %w", err)
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return fmt.Errorf("cannot read image file: %w", err)
+	}
+
+	if size != image.Size {
+		return fmt.Errorf("image size is %d, metadata says %d", size, image.Size)
+	}
+	if digest := hex.EncodeToString(hash.Sum(nil)); digest != image.Digest {
+		return fmt.Errorf("image checksum is %s, metadata says %s", digest, image.Digest)
+	}
+	return nil
+}
+
+func (store *DiskImageStore) quarantine(name string) error {
+	folder := filepath.Join(store.imageFolder, quarantineFolder)
+	err := os.MkdirAll(folder, 0755)
+	if err != nil {
+		return fmt.Errorf("cannot create quarantine folder: %w", err)
+	}
+
+	err = os.Rename(filepath.Join(store.imageFolder, name), filepath.Join(folder, name))
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("cannot quarantine %s: %w", name, err)
+	}
+	return nil
+}
+
+func (store *DiskImageStore) metadataPath(imageID string) string {
+	return filepath.Join(store.imageFolder, imageID+metadataExt)
+}
+
+func (store *DiskImageStore) isRendition(name string) bool {
+	match := renditionPattern.FindStringSubmatch(name)
+	if match == nil {
+		return false
+	}
+
+	image := store.images[match[1]]
+	return image != nil && match[3] == RenditionType(image)
+}
+
+func (store *DiskImageStore) renditionPath(image *ImageInfo, size int) (string, error) {
+	return imageFilePath(store.imageFolder, image.ID+"_"+strconv.Itoa(size), RenditionType(image))
+}
+
+func (store *DiskImageStore) Save(info *ImageInfo, imageData bytes.Buffer) (string, error) {
+	return saveImage(store, info, imageData.Bytes())
+}
+
+func (store *DiskImageStore) Create() (ImageWriter, error) {
 	imageID, err := uuid.NewRandom()
 	if err != nil {
-		return "", fmt.Errorf("cannot generate image %w", err)
+		return nil, fmt.Errorf("cannot generate image %w", err)
+	}
+
+	file, err := createTempFile(filepath.Join(store.imageFolder, imageID.String()))
+	if err != nil {
+		return nil, err
 	}
 
-	imagePath := fmt.Sprintf("%s/%s%s", store.imageFolder, imageID, imageType)
+	return newFileImageWriter(file, func(writer *fileImageWriter, info *ImageInfo) (string, error) {
+		return store.commit(imageID.String(), writer, info)
+	}), nil
+}
 
-	file, err := os.Create(imagePath)
+func (store *DiskImageStore) commit(imageID string, writer *fileImageWriter, info *ImageInfo) (string, error) {
+	imagePath, err := imageFilePath(store.imageFolder, imageID, info.Type)
 	if err != nil {
-		return "", fmt.Errorf("cannot create image file: %w", err)
+		return "", err
 	}
 
-	_, err = imageData.WriteTo(file)
+	image := info.Clone()
+	image.ID = imageID
+	image.Path = imagePath
+	image.Size = writer.Size()
+	image.Digest = writer.Digest()
+	image.CreatedAt = time.Now().UTC()
+
+	err = writer.file.commit(image.Path, 0644)
 	if err != nil {
 		return "", fmt.Errorf("cannot write image to file: %w", err)
 	}
 
+	// the metadata is written last, an image without it is a partial write
+	err = store.writeMetadata(image)
+	if err != nil {
+		os.Remove(image.Path)
+		return "", fmt.Errorf("cannot write image metadata: %w", err)
+	}
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	store.images[image.ID] = image
+	return image.ID, nil
+}
+
+func (store *DiskImageStore) Find(imageID string) (*ImageInfo, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	image := store.images[imageID]
+	if image == nil {
+		return nil, nil
+	}
+	return image.Clone(), nil
+}
+
+func (store *DiskImageStore) writeMetadata(image *ImageInfo) error {
+	metadata, err := json.Marshal(image)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(store.metadataPath(image.ID), metadata, 0644)
+}
+
+func (store *DiskImageStore) List(laptopID string) ([]*ImageInfo, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	return listImages(store.images, laptopID), nil
+}
+
+func (store *DiskImageStore) ListAll() ([]*ImageInfo, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	return allImages(store.images), nil
+}
+
+func (store *DiskImageStore) Update(image *ImageInfo) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	stored := store.images[image.ID]
+	if stored == nil {
+		return ErrNotFound
+	}
+
+	updated := stored.Clone()
+	updated.updateDetails(image)
+	err := store.writeMetadata(updated)
+	if err != nil {
+		return fmt.Errorf("cannot write image metadata: %w", err)
+	}
+
+	store.images[image.ID] = updated
+	return nil
+}
+
+func (store *DiskImageStore) Open(imageID string) (io.ReadCloser, error) {
+	image, err := store.Find(imageID)
+	if err != nil {
+		return nil, err
+	}
+	if image == nil {
+		return nil, ErrNotFound
+	}
+	return openImageFile(image.Path)
+}
+
+func (store *DiskImageStore) SaveRendition(imageID string, size int, data bytes.Buffer) error {
+	// the lock is held while writing, so that a concurrent Delete doesn't leave the rendition behind
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	image := store.images[imageID]
+	if image == nil {
+		return ErrNotFound
+	}
+
+	renditionPath, err := store.renditionPath(image, size)
+	if err != nil {
+		return err
+	}
+
+	err = writeFileAtomic(renditionPath, data.Bytes(), 0644)
+	if err != nil {
+		return fmt.Errorf("cannot write rendition to file: %w", err)
+	}
+	return nil
+}
+
+func (store *DiskImageStore) OpenRendition(imageID string, size int) (io.ReadCloser, error) {
+	image, err := store.Find(imageID)
+	if err != nil {
+		return nil, err
+	}
+	if image == nil {
+		return nil, ErrNotFound
+	}
+
+	renditionPath, err := store.renditionPath(image, size)
+	if err != nil {
+		return nil, err
+	}
+	return openImageFile(renditionPath)
+}
+
+func openImageFile(path string) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot open image file: %w", err)
+	}
+	return file, nil
+}
+
+// removeRenditions removes the rendition files whose name starts with prefix.
+func removeRenditions(folder string, prefix string) error {
+	renditionPaths, err := filepath.Glob(filepath.Join(folder, prefix+"_*"))
+	if err != nil {
+		return err
+	}
+
+	for _, renditionPath := range renditionPaths {
+		err := os.Remove(renditionPath)
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("cannot remove rendition: %w", err)
+		}
+	}
+	return nil
+}
+
+// RemoveOrphanFiles removes the files of the image folder that don't belong to an image:
+// content and metadata without an image, renditions of deleted images and temporary files.
+// The quarantine folder is left alone.
+func (store *DiskImageStore) RemoveOrphanFiles(before time.Time, dryRun bool) ([]OrphanFile, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	known := func(name string) bool {
+		if store.isRendition(name) {
+			return true
+		}
+
+		imageID := strings.TrimSuffix(name, filepath.Ext(name))
+		image := store.images[imageID]
+		return image != nil && (name == imageID+metadataExt || name == filepath.Base(image.Path))
+	}
+	return removeOrphanFiles(store.imageFolder, store.imageFolder, known, before, dryRun)
+}
+
+// RemoveAll deletes the image folder with every image in it.
+func (store *DiskImageStore) RemoveAll() error {
 	store.mutex.Lock()
 	defer store.mutex.Unlock()
 
-	store.images[imageID.String()] = &ImageInfo{
-		LaptopID: laptopID,
-		Type:     imageType,
-		Path:     imagePath,
+	err := os.RemoveAll(store.imageFolder)
+	if err != nil {
+		return fmt.Errorf("cannot remove image folder: %w", err)
 	}
-	return imageID.String(), err
+	store.images = make(map[string]*ImageInfo)
+	return nil
+}
+
+func (store *DiskImageStore) Delete(imageID string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	image := store.images[imageID]
+	if image == nil {
+		return ErrNotFound
+	}
+
+	// the metadata goes first, so that a crash in between leaves an unknown file to quarantine
+	err := os.Remove(store.metadataPath(imageID))
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("cannot remove image metadata: %w", err)
+	}
+
+	err = os.Remove(image.Path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("cannot remove image file: %w", err)
+	}
+
+	err = removeRenditions(store.imageFolder, imageID)
+	if err != nil {
+		return err
+	}
+
+	delete(store.images, imageID)
+	return nil
 }
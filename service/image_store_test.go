@@ -0,0 +1,104 @@
+package service_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Dostonlv/pcbook/service"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenDiskImageStoreRebuildsIndex(t *testing.T) {
+	t.Parallel()
+
+	imageFolder := t.TempDir()
+	store, err := service.OpenDiskImageStore(imageFolder)
+	require.NoError(t, err)
+
+	goodID, err := store.Save(&service.ImageInfo{LaptopID: "laptop-1", Type: ".jpg"}, *bytes.NewBufferString("good image"))
+	require.NoError(t, err)
+	corruptID, err := store.Save(&service.ImageInfo{LaptopID: "laptop-1", Type: ".png"}, *bytes.NewBufferString("corrupt image"))
+	require.NoError(t, err)
+
+	good, err := store.Find(goodID)
+	require.NoError(t, err)
+	require.Equal(t, "laptop-1", good.LaptopID)
+	require.EqualValues(t, len("good image"), good.Size)
+	require.Equal(t, service.ImageDigest([]byte("good image")), good.Digest)
+
+	corruptPath := filepath.Join(imageFolder, corruptID+".png")
+	require.NoError(t, os.WriteFile(corruptPath, []byte("bit rot"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(imageFolder, "unknown.jpg"), []byte("?"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(imageFolder, "x.jpg.tmp-123"), []byte("partial"), 0644))
+
+	reopened, err := service.OpenDiskImageStore(imageFolder)
+	require.NoError(t, err)
+
+	found, err := reopened.Find(goodID)
+	require.NoError(t, err)
+	require.Equal(t, good, found)
+
+	found, err = reopened.Find(corruptID)
+	require.NoError(t, err)
+	require.Nil(t, found)
+
+	quarantined, err := os.ReadDir(filepath.Join(imageFolder, "quarantine"))
+	require.NoError(t, err)
+
+	names := []string{}
+	for _, entry := range quarantined {
+		names = append(names, entry.Name())
+	}
+	require.ElementsMatch(t, []string{
+		corruptID + ".png",
+		corruptID + ".meta",
+		"unknown.jpg",
+		"x.jpg.tmp-123",
+	}, names)
+}
+
+func TestOpenDiskImageStoreMigratesImages(t *testing.T) {
+	t.Parallel()
+
+	imageFolder := t.TempDir()
+	content := newTestPNG(t, 20, 10)
+	legacyID := uuid.New().String()
+	require.NoError(t, os.WriteFile(filepath.Join(imageFolder, legacyID+".png"), content, 0644))
+	undecodableID := uuid.New().String()
+	require.NoError(t, os.WriteFile(filepath.Join(imageFolder, undecodableID+".jpg"), []byte("not a jpeg"), 0644))
+
+	store, err := service.OpenDiskImageStore(imageFolder)
+	require.NoError(t, err)
+
+	image, err := store.Find(legacyID)
+	require.NoError(t, err)
+	require.NotNil(t, image)
+	require.Empty(t, image.LaptopID)
+	require.Equal(t, service.ImageDigest(content), image.Digest)
+	require.EqualValues(t, len(content), image.Size)
+	require.Equal(t, 20, image.Width)
+	require.Equal(t, "png", image.Format)
+	require.FileExists(t, filepath.Join(imageFolder, legacyID+".meta"))
+
+	image, err = store.Find(undecodableID)
+	require.NoError(t, err)
+	require.NotNil(t, image)
+	require.Zero(t, image.Width)
+
+	// once the folder has metadata, an image without it is a partial write
+	partialID := uuid.New().String()
+	require.NoError(t, os.WriteFile(filepath.Join(imageFolder, partialID+".png"), content, 0644))
+
+	reopened, err := service.OpenDiskImageStore(imageFolder)
+	require.NoError(t, err)
+	image, err = reopened.Find(legacyID)
+	require.NoError(t, err)
+	require.NotNil(t, image)
+	image, err = reopened.Find(partialID)
+	require.NoError(t, err)
+	require.Nil(t, image)
+	require.FileExists(t, filepath.Join(imageFolder, "quarantine", partialID+".png"))
+}
@@ -0,0 +1,115 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var ErrInvalidImageType = errors.New("invalid image type")
+var ErrInvalidImagePath = errors.New("image path escapes the image folder")
+
+var DefaultImageTypes = []string{".jpg", ".jpeg", ".png", ".gif"}
+
+var extensionPattern = regexp.MustCompile(`^\.[a-z0-9]{1,10}$`)
+
+// ImageTypes is the whitelist of image types clients may upload.
+// Clients can declare the type either as a file extension or as a MIME type.
+type ImageTypes struct {
+	extensions []string
+	mimeTypes  map[string]string
+}
+
+// NewImageTypes creates a whitelist from extensions like ".png" or MIME types like "image/png".
+func NewImageTypes(types ...string) (*ImageTypes, error) {
+	imageTypes := &ImageTypes{
+		mimeTypes: make(map[string]string),
+	}
+
+	for _, imageType := range types {
+		imageType = strings.ToLower(strings.TrimSpace(imageType))
+		if strings.Contains(imageType, "/") {
+			extensions, err := mime.ExtensionsByType(imageType)
+			if err != nil || len(extensions) == 0 {
+				return nil, fmt.Errorf("%w: unknown MIME type %q", ErrInvalidImageType, imageType)
+			}
+			for _, extension := range extensions {
+				imageTypes.add(extension, imageType)
+			}
+			continue
+		}
+
+		if !extensionPattern.MatchString(imageType) {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidImageType, imageType)
+		}
+		imageTypes.add(imageType, mediaType(mime.TypeByExtension(imageType)))
+	}
+	return imageTypes, nil
+}
+
+func (imageTypes *ImageTypes) add(extension string, mimeType string) {
+	if !extensionPattern.MatchString(extension) {
+		return
+	}
+	if _, ok := imageTypes.mimeTypes[extension]; ok {
+		return
+	}
+
+	imageTypes.extensions = append(imageTypes.extensions, extension)
+	imageTypes.mimeTypes[extension] = mimeType
+}
+
+// Normalize returns the whitelisted file extension for the declared image type,
+// or ErrInvalidImageType if the type isn't allowed.
+func (imageTypes *ImageTypes) Normalize(imageType string) (string, error) {
+	declared := strings.ToLower(imageType)
+
+	if _, ok := imageTypes.mimeTypes[declared]; ok {
+		return declared, nil
+	}
+
+	if strings.Contains(declared, "/") {
+		declared = mediaType(declared)
+		for _, extension := range imageTypes.extensions {
+			if declared != "" && imageTypes.mimeTypes[extension] == declared {
+				return extension, nil
+			}
+		}
+	}
+
+	return "", fmt.Errorf("%w: %q", ErrInvalidImageType, imageType)
+}
+
+// MIMEType returns the MIME type of a normalized image type.
+func (imageTypes *ImageTypes) MIMEType(extension string) string {
+	return imageTypes.mimeTypes[extension]
+}
+
+func mediaType(mimeType string) string {
+	mediaType, _, err := mime.ParseMediaType(mimeType)
+	if err != nil {
+		return ""
+	}
+	return mediaType
+}
+
+// imageFilePath returns the path of the image file and makes sure it's a direct child of the image folder.
+func imageFilePath(imageFolder string, imageID string, imageType string) (string, error) {
+	if !extensionPattern.MatchString(imageType) {
+		return "", fmt.Errorf("%w: %q", ErrInvalidImageType, imageType)
+	}
+
+	root, err := filepath.Abs(imageFolder)
+	if err != nil {
+		return "", fmt.Errorf("cannot resolve image folder: %w", err)
+	}
+
+	imagePath := filepath.Join(root, imageID+imageType)
+	if filepath.Dir(imagePath) != root {
+		return "", fmt.Errorf("%w: %q", ErrInvalidImagePath, imageID+imageType)
+	}
+	return filepath.Join(imageFolder, imageID+imageType), nil
+}
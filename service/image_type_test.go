@@ -0,0 +1,109 @@
+package service_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"testing"
+
+	"github.com/Dostonlv/pcbook/pb"
+	"github.com/Dostonlv/pcbook/sample"
+	"github.com/Dostonlv/pcbook/service"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// hostileImagePaths can't even be used as a file extension
+var hostileImagePaths = []string{
+	"",
+	".",
+	"/../../etc/x",
+	"../x",
+	".jpg/../../x",
+	"/.jpg",
+	".jpg\x00.png",
+	".j pg",
+	"..",
+}
+
+var hostileImageTypes = append([]string{
+	".exe",
+	"image/svg+xml",
+	"text/html",
+	"image/",
+}, hostileImagePaths...)
+
+func TestImageTypesNormalize(t *testing.T) {
+	t.Parallel()
+
+	imageTypes, err := service.NewImageTypes(".jpg", ".jpeg", "image/png")
+	require.NoError(t, err)
+
+	valid := map[string]string{
+		".jpg":                     ".jpg",
+		".JPG":                     ".jpg",
+		".jpeg":                    ".jpeg",
+		".png":                     ".png",
+		"image/jpeg":               ".jpg",
+		"IMAGE/PNG":                ".png",
+		"image/png; charset=utf-8": ".png",
+	}
+	for declared, expected := range valid {
+		normalized, err := imageTypes.Normalize(declared)
+		require.NoError(t, err, declared)
+		require.Equal(t, expected, normalized, declared)
+	}
+
+	for _, declared := range append(hostileImageTypes, ".gif", "image/gif") {
+		_, err := imageTypes.Normalize(declared)
+		require.ErrorIs(t, err, service.ErrInvalidImageType, "%q", declared)
+	}
+
+	_, err = service.NewImageTypes("../jpg")
+	require.ErrorIs(t, err, service.ErrInvalidImageType)
+}
+
+func TestDiskImageStoreRejectsHostileImageTypes(t *testing.T) {
+	t.Parallel()
+
+	imageFolder := t.TempDir()
+	store := service.NewDiskImageStore(imageFolder)
+
+	for _, imageType := range hostileImagePaths {
+		_, err := store.Save(&service.ImageInfo{LaptopID: "laptop-1", Type: imageType}, *bytes.NewBufferString("image"))
+		require.ErrorIs(t, err, service.ErrInvalidImageType, "%q", imageType)
+	}
+
+	files, err := os.ReadDir(imageFolder)
+	require.NoError(t, err)
+	require.Empty(t, files)
+}
+
+func TestClientUploadImageHostileType(t *testing.T) {
+	t.Parallel()
+
+	laptopStore := service.NewInMemoryLaptopStore()
+	imageStore := service.NewDiskImageStore(t.TempDir())
+
+	laptop := sample.NewLaptop()
+	require.NoError(t, laptopStore.Save(laptop))
+
+	serverAddress := startTestLaptopServer(t, laptopStore, imageStore, nil)
+	laptopClient := newTestLaptopClient(t, serverAddress)
+
+	for _, imageType := range hostileImageTypes {
+		stream, err := laptopClient.UploadImage(context.Background())
+		require.NoError(t, err)
+
+		err = stream.Send(&pb.UploadImageRequest{
+			Data: &pb.UploadImageRequest_Info{
+				Info: &pb.ImageInfo{LaptopId: laptop.GetId(), ImageType: imageType},
+			},
+		})
+		require.NoError(t, err)
+
+		_, err = stream.CloseAndRecv()
+		require.Equal(t, codes.InvalidArgument, status.Code(err), "%q", imageType)
+	}
+}
@@ -0,0 +1,53 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	DefaultMaxImageSize = 10 << 20
+
+	// imageHeaderSize is how much of the content is kept in memory to inspect the image.
+	imageHeaderSize = 256 << 10
+)
+
+var ErrImageTooLarge = errors.New("image is too large")
+
+// imageUpload streams the received content to the image store,
+// keeping only the header in memory to inspect the image before it's committed.
+type imageUpload struct {
+	writer  ImageWriter
+	header  []byte
+	maxSize int64
+	// committed is set once the content is committed, even if the commit fails, the writer is done then
+	committed bool
+}
+
+func newImageUpload(store ImageStore, maxSize int64) (*imageUpload, error) {
+	writer, err := store.Create()
+	if err != nil {
+		return nil, err
+	}
+
+	return &imageUpload{
+		writer:  writer,
+		maxSize: maxSize,
+	}, nil
+}
+
+func (upload *imageUpload) Write(chunk []byte) (int, error) {
+	if size := upload.writer.Size() + int64(len(chunk)); size > upload.maxSize {
+		return 0, fmt.Errorf("%w: %d > %d bytes", ErrImageTooLarge, size, upload.maxSize)
+	}
+
+	if len(upload.header) < imageHeaderSize {
+		n := min(imageHeaderSize-len(upload.header), len(chunk))
+		upload.header = append(upload.header, chunk[:n]...)
+	}
+	return upload.writer.Write(chunk)
+}
+
+func (upload *imageUpload) Size() int64 {
+	return upload.writer.Size()
+}
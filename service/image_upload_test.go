@@ -0,0 +1,187 @@
+package service_test
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/png"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Dostonlv/pcbook/pb"
+	"github.com/Dostonlv/pcbook/sample"
+	"github.com/Dostonlv/pcbook/service"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// newTestNoisePNG returns a PNG that doesn't compress, so it takes about 3 bytes per pixel.
+func newTestNoisePNG(t *testing.T, width, height int) []byte {
+	random := rand.New(rand.NewSource(1))
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			img.Set(x, y, color.RGBA{R: uint8(random.Intn(256)), G: uint8(random.Intn(256)), B: uint8(random.Intn(256)), A: 255})
+		}
+	}
+
+	buffer := bytes.Buffer{}
+	require.NoError(t, png.Encode(&buffer, img))
+	return buffer.Bytes()
+}
+
+func uploadTestImageInChunks(laptopClient pb.LaptopServiceClient, info *pb.ImageInfo, content []byte) (*pb.UploadImageResponse, error) {
+	stream, err := laptopClient.UploadImage(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	err = stream.Send(&pb.UploadImageRequest{
+		Data: &pb.UploadImageRequest_Info{Info: info},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for len(content) > 0 {
+		n := min(len(content), 32<<10)
+		err = stream.Send(&pb.UploadImageRequest{
+			Data: &pb.UploadImageRequest_ChunkData{ChunkData: content[:n]},
+		})
+		if err != nil {
+			break
+		}
+		content = content[n:]
+	}
+	return stream.CloseAndRecv()
+}
+
+func TestClientUploadLargeImage(t *testing.T) {
+	t.Parallel()
+
+	laptopStore := service.NewInMemoryLaptopStore()
+	imageFolder := t.TempDir()
+	imageStore := service.NewDiskImageStore(imageFolder)
+
+	laptop := sample.NewLaptop()
+	require.NoError(t, laptopStore.Save(laptop))
+
+	content := newTestNoisePNG(t, 800, 600)
+	require.Greater(t, len(content), 1<<20)
+
+	laptopServer := service.NewLaptopServer(laptopStore, imageStore, nil, service.WithMaxImageSize(2<<20))
+	laptopClient := newTestLaptopClient(t, startTestLaptopServerWith(t, laptopServer))
+
+	res, err := uploadTestImageInChunks(laptopClient, &pb.ImageInfo{
+		LaptopId:  laptop.GetId(),
+		ImageType: ".png",
+		Digest:    service.ImageDigest(content),
+	}, content)
+	require.NoError(t, err)
+	require.EqualValues(t, len(content), res.GetSize())
+	require.EqualValues(t, 800, res.GetWidth())
+	require.EqualValues(t, 600, res.GetHeight())
+
+	saved, err := os.ReadFile(filepath.Join(imageFolder, res.GetId()+".png"))
+	require.NoError(t, err)
+	require.Equal(t, content, saved)
+}
+
+func TestClientUploadImageRejected(t *testing.T) {
+	t.Parallel()
+
+	laptopStore := service.NewInMemoryLaptopStore()
+	imageFolder := t.TempDir()
+	imageStore := service.NewDiskImageStore(imageFolder)
+
+	laptop := sample.NewLaptop()
+	require.NoError(t, laptopStore.Save(laptop))
+
+	laptopServer := service.NewLaptopServer(laptopStore, imageStore, nil, service.WithMaxImageSize(64<<10))
+	laptopClient := newTestLaptopClient(t, startTestLaptopServerWith(t, laptopServer))
+
+	small := newTestPNG(t, 64, 48)
+	large := newTestNoisePNG(t, 200, 200)
+	require.Greater(t, len(large), 64<<10)
+
+	testCases := []struct {
+		name    string
+		digest  string
+		content []byte
+		code    codes.Code
+	}{
+		{"digest_mismatch", service.ImageDigest(large), small, codes.DataLoss},
+		{"too_large", "", large, codes.InvalidArgument},
+		{"no_content", "", nil, codes.InvalidArgument},
+	}
+
+	for _, tc := range testCases {
+		_, err := uploadTestImageInChunks(laptopClient, &pb.ImageInfo{
+			LaptopId:  laptop.GetId(),
+			ImageType: ".png",
+			Digest:    tc.digest,
+		}, tc.content)
+		require.Equal(t, tc.code, status.Code(err), tc.name)
+	}
+
+	// nothing is committed and the partial content is removed
+	require.Eventually(t, func() bool {
+		entries, err := os.ReadDir(imageFolder)
+		return err == nil && len(entries) == 0
+	}, time.Second, 10*time.Millisecond)
+
+	_, err := laptopClient.StartImageUpload(context.Background(), &pb.StartImageUploadRequest{
+		Info: &pb.ImageInfo{LaptopId: laptop.GetId(), ImageType: ".png"},
+		Size: uint64(len(large)),
+	})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestContentAddressedImageStoreWriter(t *testing.T) {
+	t.Parallel()
+
+	imageFolder := t.TempDir()
+	store, err := service.NewContentAddressedImageStore(imageFolder)
+	require.NoError(t, err)
+
+	content := []byte("streamed image content")
+	var imageIDs []string
+	for _, laptopID := range []string{"laptop-1", "laptop-2"} {
+		writer, err := store.Create()
+		require.NoError(t, err)
+
+		_, err = writer.Write(content[:8])
+		require.NoError(t, err)
+		_, err = writer.Write(content[8:])
+		require.NoError(t, err)
+		require.EqualValues(t, len(content), writer.Size())
+		require.Equal(t, service.ImageDigest(content), writer.Digest())
+
+		imageID, err := writer.Commit(&service.ImageInfo{LaptopID: laptopID, Type: ".jpg"})
+		require.NoError(t, err)
+		imageIDs = append(imageIDs, imageID)
+	}
+
+	aborted, err := store.Create()
+	require.NoError(t, err)
+	_, err = aborted.Write([]byte("never committed"))
+	require.NoError(t, err)
+	require.NoError(t, aborted.Abort())
+	_, err = aborted.Commit(&service.ImageInfo{LaptopID: "laptop-3", Type: ".jpg"})
+	require.Error(t, err)
+
+	blobs, err := os.ReadDir(filepath.Join(imageFolder, "blobs"))
+	require.NoError(t, err)
+	require.Len(t, blobs, 1)
+	require.Equal(t, service.ImageDigest(content), blobs[0].Name())
+
+	image, err := store.Find(imageIDs[1])
+	require.NoError(t, err)
+	require.EqualValues(t, len(content), image.Size)
+	require.ElementsMatch(t, []string{"laptop-1", "laptop-2"}, store.References(image.Digest))
+}
@@ -0,0 +1,98 @@
+package service
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+)
+
+var errImageWriterDone = errors.New("image writer is already committed or aborted")
+
+// ImageWriter receives the content of a new image. Nothing is visible in the store
+// until Commit, which uses the LaptopID, Type and the decoded Width, Height and Format of the info.
+// Abort discards the content written so far.
+type ImageWriter interface {
+	io.Writer
+	Size() int64
+	Digest() string
+	Commit(info *ImageInfo) (string, error)
+	Abort() error
+}
+
+// fileImageWriter writes the content to a temporary file, computing its size and digest on the way.
+type fileImageWriter struct {
+	file   *tempFile
+	hash   hash.Hash
+	size   int64
+	done   bool
+	commit func(writer *fileImageWriter, info *ImageInfo) (string, error)
+}
+
+func newFileImageWriter(file *tempFile, commit func(writer *fileImageWriter, info *ImageInfo) (string, error)) *fileImageWriter {
+	return &fileImageWriter{
+		file:   file,
+		hash:   sha256.New(),
+		commit: commit,
+	}
+}
+
+func (writer *fileImageWriter) Write(p []byte) (int, error) {
+	if writer.done {
+		return 0, errImageWriterDone
+	}
+
+	n, err := writer.file.Write(p)
+	writer.hash.Write(p[:n])
+	writer.size += int64(n)
+	return n, err
+}
+
+func (writer *fileImageWriter) Size() int64 {
+	return writer.size
+}
+
+func (writer *fileImageWriter) Digest() string {
+	return hex.EncodeToString(writer.hash.Sum(nil))
+}
+
+func (writer *fileImageWriter) Commit(info *ImageInfo) (string, error) {
+	if writer.done {
+		return "", errImageWriterDone
+	}
+	writer.done = true
+
+	imageID, err := writer.commit(writer, info)
+	if err != nil {
+		writer.file.abort()
+		return "", err
+	}
+	return imageID, nil
+}
+
+func (writer *fileImageWriter) Abort() error {
+	if writer.done {
+		return nil
+	}
+	writer.done = true
+
+	writer.file.abort()
+	return nil
+}
+
+// saveImage writes the whole content to a new image of the store.
+func saveImage(store ImageStore, info *ImageInfo, data []byte) (string, error) {
+	writer, err := store.Create()
+	if err != nil {
+		return "", err
+	}
+
+	_, err = io.Copy(writer, bytes.NewReader(data))
+	if err != nil {
+		writer.Abort()
+		return "", err
+	}
+	return writer.Commit(info)
+}
@@ -12,10 +12,14 @@ type JWTManager struct {
 	tokenDuration time.Duration
 }
 
+// UserClaims identify the user of a token. AccountCreatedAt is when the user was created,
+// it's unknown for the users created before it was recorded.
 type UserClaims struct {
 	jwt.RegisteredClaims
-	Username string `json:"username"`
-	Role     string `json:"role"`
+	Username         string           `json:"username"`
+	Role             string           `json:"role"`
+	Tenant           string           `json:"tenant"`
+	AccountCreatedAt *jwt.NumericDate `json:"account_created_at,omitempty"`
 }
 
 func NewJWTManager(secretKey string, tokenDuration time.Duration) *JWTManager {
@@ -32,6 +36,10 @@ func (manager *JWTManager) Generate(user *User) (string, error) {
 		},
 		Username: user.Username,
 		Role:     user.Role,
+		Tenant:   user.Tenant,
+	}
+	if !user.CreatedAt.IsZero() {
+		claims.AccountCreatedAt = jwt.NewNumericDate(user.CreatedAt)
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
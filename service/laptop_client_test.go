@@ -5,10 +5,12 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"math"
 	"os"
 	"path/filepath"
 
 	"testing"
+	"time"
 
 	"net"
 
@@ -18,6 +20,8 @@ import (
 	"github.com/Dostonlv/pcbook/service"
 	"github.com/stretchr/testify/require"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 func TestClientCreateLaptop(t *testing.T) {
@@ -112,7 +116,8 @@ func TestClientUploadImage(t *testing.T) {
 
 	savedImagePath := fmt.Sprintf("%s/%s%s", testImageFolder, res.GetId(), imageType)
 	require.FileExists(t, savedImagePath)
-	require.NoError(t, os.Remove(savedImagePath))
+	require.NoError(t, imageStore.Delete(res.GetId()))
+	require.NoFileExists(t, savedImagePath)
 }
 
 func TestClientSearchLaptop(t *testing.T) {
@@ -197,7 +202,10 @@ func TestClientSearchLaptop(t *testing.T) {
 
 func startTestLaptopServer(t *testing.T, laptopStore service.LaptopStore, imageStore service.ImageStore, ratingStore service.RatingStore) string {
 	laptopServer := service.NewLaptopServer(laptopStore, imageStore, ratingStore)
+	return startTestLaptopServerWith(t, laptopServer)
+}
 
+func startTestLaptopServerWith(t *testing.T, laptopServer *service.LaptopServer) string {
 	grpcServer := grpc.NewServer()
 	pb.RegisterLaptopServiceServer(grpcServer, laptopServer)
 
@@ -234,37 +242,143 @@ func TestClientRateLaptop(t *testing.T) {
 	err := laptopStore.Save(laptop)
 	require.NoError(t, err)
 
-	serverAdd := startTestLaptopServer(t, laptopStore, nil, ratingStore)
+	laptopServer := service.NewLaptopServer(laptopStore, nil, ratingStore)
+	jwtManager := service.NewJWTManager("secret", time.Minute)
+	serverAdd := startTestAuthLaptopServer(t, laptopServer, jwtManager)
 
-	laptopClient := newTestLaptopClient(t, serverAdd)
+	alice := newTestUserClient(t, serverAdd, jwtManager, "alice")
+	bob := newTestUserClient(t, serverAdd, jwtManager, "bob")
 
-	stream, err := laptopClient.RateLaptop(context.Background())
-	require.NoError(t, err)
-
-	scores := []float64{8, 7.5, 10}
-	average := []float64{8, 7.75, 8.5}
+	rate := func(laptopClient pb.LaptopServiceClient, scores ...float64) []*pb.RateLaptopResponse {
+		stream, err := laptopClient.RateLaptop(context.Background())
+		require.NoError(t, err)
 
-	n := len(scores)
-	for i := 0; i < n; i++ {
-		req := &pb.RateLaptopRequest{
-			LaptopId: laptop.GetId(),
-			Score:    scores[i],
+		for _, score := range scores {
+			err := stream.Send(&pb.RateLaptopRequest{
+				LaptopId: laptop.GetId(),
+				Score:    score,
+			})
+			require.NoError(t, err)
 		}
-		err := stream.Send(req)
+		err = stream.CloseSend()
 		require.NoError(t, err)
+
+		var responses []*pb.RateLaptopResponse
+		for {
+			res, err := stream.Recv()
+			if err == io.EOF {
+				return responses
+			}
+			require.NoError(t, err)
+			require.Equal(t, laptop.GetId(), res.GetLaptopId())
+			responses = append(responses, res)
+		}
 	}
-	err = stream.CloseSend()
+
+	// re-rating replaces the previous score of the user
+	responses := rate(alice, 8, 6)
+	require.Len(t, responses, 2)
+	require.False(t, responses[0].GetUpdated())
+	require.Equal(t, uint32(1), responses[0].GetRatedCount())
+	require.True(t, responses[1].GetUpdated())
+	require.Equal(t, uint32(1), responses[1].GetRatedCount())
+	require.Equal(t, 6.0, responses[1].GetAverageScore())
+
+	responses = rate(bob, 7.5)
+	require.Len(t, responses, 1)
+	require.False(t, responses[0].GetUpdated())
+	require.Equal(t, uint32(2), responses[0].GetRatedCount())
+	require.Equal(t, 6.75, responses[0].GetAverageScore())
+
+	responses = rate(alice, 10)
+	require.Len(t, responses, 1)
+	require.True(t, responses[0].GetUpdated())
+	require.Equal(t, uint32(2), responses[0].GetRatedCount())
+	require.Equal(t, 8.75, responses[0].GetAverageScore())
+
+	rating, err := ratingStore.Find(laptop.GetId())
+	require.NoError(t, err)
+	require.Equal(t, map[string]float64{"alice": 10, "bob": 7.5}, rating.Scores)
+
+	stream, err := newTestLaptopClient(t, serverAdd).RateLaptop(context.Background())
+	require.NoError(t, err)
+	err = stream.Send(&pb.RateLaptopRequest{LaptopId: laptop.GetId(), Score: 5})
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestClientRateLaptopRejections(t *testing.T) {
+	t.Parallel()
+
+	laptopStore := service.NewInMemoryLaptopStore()
+	laptop := sample.NewLaptop()
+	require.NoError(t, laptopStore.Save(laptop))
+
+	laptopServer := service.NewLaptopServer(laptopStore, nil, service.NewInMemoryRatingStore())
+	jwtManager := service.NewJWTManager("secret", time.Minute)
+	serverAdd := startTestAuthLaptopServer(t, laptopServer, jwtManager)
+
+	stream, err := newTestUserClient(t, serverAdd, jwtManager, "alice").RateLaptop(context.Background())
 	require.NoError(t, err)
-	for idx := 0; ; idx++ {
+
+	requests := []*pb.RateLaptopRequest{
+		{RequestId: "nan", LaptopId: laptop.GetId(), Score: math.NaN()},
+		{RequestId: "negative", LaptopId: laptop.GetId(), Score: -1},
+		{RequestId: "huge", LaptopId: laptop.GetId(), Score: 1e9},
+		{RequestId: "off-step", LaptopId: laptop.GetId(), Score: 7.25},
+		{RequestId: "unknown", LaptopId: "unknown-laptop", Score: 5},
+		{RequestId: "missing", Score: 5},
+		{RequestId: "valid", LaptopId: laptop.GetId(), Score: 9.5},
+	}
+	for _, req := range requests {
+		require.NoError(t, stream.Send(req))
+	}
+	require.NoError(t, stream.CloseSend())
+
+	expectedCodes := []codes.Code{
+		codes.InvalidArgument,
+		codes.InvalidArgument,
+		codes.InvalidArgument,
+		codes.InvalidArgument,
+		codes.NotFound,
+		codes.InvalidArgument,
+		codes.OK,
+	}
+	for i, req := range requests {
 		res, err := stream.Recv()
-		if err == io.EOF {
-			require.Equal(t, n, idx)
-			return
+		require.NoError(t, err)
+		require.Equal(t, req.GetRequestId(), res.GetRequestId())
+		require.Equal(t, expectedCodes[i], codes.Code(res.GetStatus().GetCode()), req.GetRequestId())
+		if expectedCodes[i] != codes.OK {
+			require.NotEmpty(t, res.GetStatus().GetMessage())
+			require.Zero(t, res.GetRatedCount())
 		}
+	}
 
-		require.NoError(t, err)
-		require.Equal(t, laptop.GetId(), res.GetLaptopId())
-		require.Equal(t, uint32(idx+1), res.GetRatedCount())
-		require.Equal(t, average[idx], res.GetAverageScore())
+	res, err := stream.Recv()
+	require.Equal(t, io.EOF, err)
+	require.Nil(t, res)
+}
+
+func TestScoreRange(t *testing.T) {
+	t.Parallel()
+
+	_, err := service.NewScoreRange(10, 1, 0.5)
+	require.Error(t, err)
+	_, err = service.NewScoreRange(1, 10, -1)
+	require.Error(t, err)
+
+	scoreRange, err := service.NewScoreRange(0, 1, 0.1)
+	require.NoError(t, err)
+	for _, score := range []float64{0, 0.3, 0.7, 1} {
+		require.NoError(t, scoreRange.Check(score), score)
+	}
+	for _, score := range []float64{-0.1, 0.35, 1.1, math.Inf(1), math.NaN()} {
+		require.ErrorIs(t, scoreRange.Check(score), service.ErrInvalidScore, score)
 	}
+
+	anyScore, err := service.NewScoreRange(1, 5, 0)
+	require.NoError(t, err)
+	require.NoError(t, anyScore.Check(3.14159))
 }
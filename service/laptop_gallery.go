@@ -0,0 +1,278 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"unicode/utf8"
+
+	"github.com/Dostonlv/pcbook/pb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	maxCaptionLength = 200
+	maxAltTextLength = 500
+)
+
+func validateImageDetails(caption string, altText string) error {
+	if utf8.RuneCountInString(caption) > maxCaptionLength {
+		return fmt.Errorf("caption is longer than %d characters", maxCaptionLength)
+	}
+	if utf8.RuneCountInString(altText) > maxAltTextLength {
+		return fmt.Errorf("alt text is longer than %d characters", maxAltTextLength)
+	}
+	return nil
+}
+
+func imagesToPB(images []*ImageInfo) []*pb.Image {
+	result := make([]*pb.Image, len(images))
+	for i, image := range images {
+		result[i] = imageToPB(image)
+	}
+	return result
+}
+
+func (server *LaptopServer) ListLaptopImages(ctx context.Context, req *pb.ListLaptopImagesRequest) (*pb.ListLaptopImagesResponse, error) {
+	laptopID := req.GetLaptopId()
+	log.Printf("receive a list-laptop-images request for laptop %s", laptopID)
+
+	catalog, err := server.catalog(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	laptop, err := catalog.laptopStore.Find(laptopID)
+	if err != nil {
+		return nil, errorLog(status.Errorf(codes.Internal, "cannot find laptop: %v", err))
+	}
+	if laptop == nil {
+		return nil, errorLog(status.Errorf(codes.NotFound, "laptop %s is not found", laptopID))
+	}
+
+	images, err := catalog.imageStore.List(laptopID)
+	if err != nil {
+		return nil, errorLog(status.Errorf(codes.Internal, "cannot list laptop images: %v", err))
+	}
+	return &pb.ListLaptopImagesResponse{Images: imagesToPB(images)}, nil
+}
+
+// DeleteImage deletes the image, if it was the primary image, the next one in the gallery takes its place.
+func (server *LaptopServer) DeleteImage(ctx context.Context, req *pb.DeleteImageRequest) (*pb.DeleteImageResponse, error) {
+	imageID := req.GetImageId()
+	log.Printf("receive a delete-image request with id: %s", imageID)
+
+	catalog, err := server.catalog(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	laptopID, err := imageLaptopID(catalog, imageID)
+	if err != nil {
+		return nil, errorLog(err)
+	}
+
+	err = catalog.uow.Do(laptopID, func(tx *Tx) error {
+		image, err := findImage(tx, imageID)
+		if err != nil {
+			return err
+		}
+
+		if image.Primary {
+			images, err := tx.ListImages(image.LaptopID)
+			if err != nil {
+				return status.Errorf(codes.Internal, "cannot list laptop images: %v", err)
+			}
+
+			for _, other := range images {
+				if other.ID == imageID {
+					continue
+				}
+
+				other.Primary = true
+				err = tx.UpdateImage(other)
+				if err != nil {
+					return status.Errorf(codes.Internal, "cannot update image: %v", err)
+				}
+				break
+			}
+		}
+
+		err = tx.DeleteImage(imageID)
+		if err != nil {
+			return status.Errorf(codes.Internal, "cannot delete image: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errorLog(err)
+	}
+
+	log.Printf("deleted image with id: %s", imageID)
+	return &pb.DeleteImageResponse{}, nil
+}
+
+func (server *LaptopServer) ReorderImages(ctx context.Context, req *pb.ReorderImagesRequest) (*pb.ReorderImagesResponse, error) {
+	laptopID := req.GetLaptopId()
+	log.Printf("receive a reorder-images request for laptop %s", laptopID)
+
+	catalog, err := server.catalog(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var images []*ImageInfo
+	err = catalog.uow.Do(laptopID, func(tx *Tx) error {
+		current, err := tx.ListImages(laptopID)
+		if err != nil {
+			return status.Errorf(codes.Internal, "cannot list laptop images: %v", err)
+		}
+
+		byID := make(map[string]*ImageInfo, len(current))
+		for _, image := range current {
+			byID[image.ID] = image
+		}
+		if len(req.GetImageIds()) != len(current) {
+			return status.Errorf(codes.InvalidArgument, "laptop %s has %d images, got %d", laptopID, len(current), len(req.GetImageIds()))
+		}
+
+		images = make([]*ImageInfo, 0, len(current))
+		for position, imageID := range req.GetImageIds() {
+			image := byID[imageID]
+			if image == nil {
+				return status.Errorf(codes.InvalidArgument, "image %s is not an image of laptop %s or is listed twice", imageID, laptopID)
+			}
+			delete(byID, imageID)
+
+			image.Position = position
+			err = tx.UpdateImage(image)
+			if err != nil {
+				return status.Errorf(codes.Internal, "cannot update image: %v", err)
+			}
+			images = append(images, image)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errorLog(err)
+	}
+
+	return &pb.ReorderImagesResponse{Images: imagesToPB(images)}, nil
+}
+
+func (server *LaptopServer) SetPrimaryImage(ctx context.Context, req *pb.SetPrimaryImageRequest) (*pb.SetPrimaryImageResponse, error) {
+	imageID := req.GetImageId()
+	log.Printf("receive a set-primary-image request with id: %s", imageID)
+
+	catalog, err := server.catalog(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	laptopID, err := imageLaptopID(catalog, imageID)
+	if err != nil {
+		return nil, errorLog(err)
+	}
+
+	var primary *ImageInfo
+	err = catalog.uow.Do(laptopID, func(tx *Tx) error {
+		image, err := findImage(tx, imageID)
+		if err != nil {
+			return err
+		}
+
+		images, err := tx.ListImages(image.LaptopID)
+		if err != nil {
+			return status.Errorf(codes.Internal, "cannot list laptop images: %v", err)
+		}
+
+		for _, other := range images {
+			if other.Primary == (other.ID == imageID) {
+				continue
+			}
+
+			other.Primary = other.ID == imageID
+			err = tx.UpdateImage(other)
+			if err != nil {
+				return status.Errorf(codes.Internal, "cannot update image: %v", err)
+			}
+		}
+
+		primary, err = tx.FindImage(imageID)
+		if err != nil {
+			return status.Errorf(codes.Internal, "cannot find image: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errorLog(err)
+	}
+
+	return &pb.SetPrimaryImageResponse{Image: imageToPB(primary)}, nil
+}
+
+func (server *LaptopServer) UpdateImage(ctx context.Context, req *pb.UpdateImageRequest) (*pb.UpdateImageResponse, error) {
+	imageID := req.GetImageId()
+	log.Printf("receive an update-image request with id: %s", imageID)
+
+	err := validateImageDetails(req.GetCaption(), req.GetAltText())
+	if err != nil {
+		return nil, errorLog(status.Errorf(codes.InvalidArgument, "%v", err))
+	}
+
+	catalog, err := server.catalog(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	laptopID, err := imageLaptopID(catalog, imageID)
+	if err != nil {
+		return nil, errorLog(err)
+	}
+
+	var image *ImageInfo
+	err = catalog.uow.Do(laptopID, func(tx *Tx) error {
+		image, err = findImage(tx, imageID)
+		if err != nil {
+			return err
+		}
+
+		image.Caption = req.GetCaption()
+		image.AltText = req.GetAltText()
+		err = tx.UpdateImage(image)
+		if err != nil {
+			return status.Errorf(codes.Internal, "cannot update image: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errorLog(err)
+	}
+
+	return &pb.UpdateImageResponse{Image: imageToPB(image)}, nil
+}
+
+// imageLaptopID returns the laptop of the image, which never changes, to run a transaction on it.
+func imageLaptopID(catalog *Catalog, imageID string) (string, error) {
+	image, err := catalog.imageStore.Find(imageID)
+	if err != nil {
+		return "", status.Errorf(codes.Internal, "cannot find image: %v", err)
+	}
+	if image == nil {
+		return "", status.Errorf(codes.NotFound, "image %s is not found", imageID)
+	}
+	return image.LaptopID, nil
+}
+
+// findImage returns the image or a NotFound status error.
+func findImage(tx *Tx, imageID string) (*ImageInfo, error) {
+	image, err := tx.FindImage(imageID)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot find image: %v", err)
+	}
+	if image == nil {
+		return nil, status.Errorf(codes.NotFound, "image %s is not found", imageID)
+	}
+	return image, nil
+}
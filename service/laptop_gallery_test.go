@@ -0,0 +1,121 @@
+package service_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/Dostonlv/pcbook/pb"
+	"github.com/Dostonlv/pcbook/sample"
+	"github.com/Dostonlv/pcbook/service"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestClientLaptopGallery(t *testing.T) {
+	t.Parallel()
+
+	laptopStore := service.NewInMemoryLaptopStore()
+	imageFolder := t.TempDir()
+	imageStore := service.NewDiskImageStore(imageFolder)
+
+	laptop := sample.NewLaptop()
+	require.NoError(t, laptopStore.Save(laptop))
+
+	serverAddress := startTestLaptopServer(t, laptopStore, imageStore, nil)
+	laptopClient := newTestLaptopClient(t, serverAddress)
+	ctx := context.Background()
+
+	var imageIDs []string
+	for i, caption := range []string{"front", "", "keyboard"} {
+		res, err := uploadTestImageInChunks(laptopClient, &pb.ImageInfo{
+			LaptopId:  laptop.GetId(),
+			ImageType: ".png",
+			Caption:   caption,
+			AltText:   strings.ToUpper(caption),
+		}, newTestPNG(t, 10+i, 10))
+		require.NoError(t, err)
+		imageIDs = append(imageIDs, res.GetId())
+	}
+
+	listImages := func() []*pb.Image {
+		res, err := laptopClient.ListLaptopImages(ctx, &pb.ListLaptopImagesRequest{LaptopId: laptop.GetId()})
+		require.NoError(t, err)
+		return res.GetImages()
+	}
+	requireGallery := func(ids []string, primaryID string) {
+		images := listImages()
+		require.Len(t, images, len(ids))
+		for i, image := range images {
+			require.Equal(t, ids[i], image.GetId())
+			require.Equal(t, image.GetId() == primaryID, image.GetPrimary(), image.GetId())
+		}
+	}
+
+	images := listImages()
+	requireGallery(imageIDs, imageIDs[0])
+	require.Equal(t, "front", images[0].GetCaption())
+	require.Equal(t, "FRONT", images[0].GetAltText())
+	require.Empty(t, images[1].GetCaption())
+
+	_, err := laptopClient.ListLaptopImages(ctx, &pb.ListLaptopImagesRequest{LaptopId: "unknown"})
+	require.Equal(t, codes.NotFound, status.Code(err))
+
+	reordered := []string{imageIDs[2], imageIDs[0], imageIDs[1]}
+	res, err := laptopClient.ReorderImages(ctx, &pb.ReorderImagesRequest{LaptopId: laptop.GetId(), ImageIds: reordered})
+	require.NoError(t, err)
+	require.Len(t, res.GetImages(), 3)
+	requireGallery(reordered, imageIDs[0])
+
+	for _, invalid := range [][]string{
+		imageIDs[:2],
+		{imageIDs[0], imageIDs[0], imageIDs[1]},
+		{imageIDs[0], imageIDs[1], "unknown"},
+	} {
+		_, err = laptopClient.ReorderImages(ctx, &pb.ReorderImagesRequest{LaptopId: laptop.GetId(), ImageIds: invalid})
+		require.Equal(t, codes.InvalidArgument, status.Code(err))
+	}
+	requireGallery(reordered, imageIDs[0])
+
+	primary, err := laptopClient.SetPrimaryImage(ctx, &pb.SetPrimaryImageRequest{ImageId: imageIDs[1]})
+	require.NoError(t, err)
+	require.True(t, primary.GetImage().GetPrimary())
+	requireGallery(reordered, imageIDs[1])
+
+	updated, err := laptopClient.UpdateImage(ctx, &pb.UpdateImageRequest{
+		ImageId: imageIDs[1],
+		Caption: "lid",
+		AltText: "the closed lid",
+	})
+	require.NoError(t, err)
+	require.Equal(t, "lid", updated.GetImage().GetCaption())
+	require.True(t, updated.GetImage().GetPrimary())
+
+	_, err = laptopClient.UpdateImage(ctx, &pb.UpdateImageRequest{
+		ImageId: imageIDs[1],
+		Caption: strings.Repeat("x", 201),
+	})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	// the first image of the gallery becomes primary when the primary one is deleted
+	_, err = laptopClient.DeleteImage(ctx, &pb.DeleteImageRequest{ImageId: imageIDs[1]})
+	require.NoError(t, err)
+	requireGallery([]string{imageIDs[2], imageIDs[0]}, imageIDs[2])
+
+	_, err = laptopClient.DeleteImage(ctx, &pb.DeleteImageRequest{ImageId: imageIDs[1]})
+	require.Equal(t, codes.NotFound, status.Code(err))
+
+	// the gallery details are kept in the image metadata
+	reopened, err := service.OpenDiskImageStore(imageFolder)
+	require.NoError(t, err)
+	stored, err := reopened.List(laptop.GetId())
+	require.NoError(t, err)
+	require.Len(t, stored, 2)
+	require.Equal(t, imageIDs[2], stored[0].ID)
+	require.True(t, stored[0].Primary)
+	require.Equal(t, "keyboard", stored[0].Caption)
+	require.Equal(t, "KEYBOARD", stored[0].AltText)
+	require.Equal(t, imageIDs[0], stored[1].ID)
+	require.False(t, stored[1].Primary)
+}
@@ -4,7 +4,10 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"fmt"
 	"io"
+	"sync"
+	"time"
 
 	"github.com/Dostonlv/pcbook/pb"
 	"github.com/google/uuid"
@@ -13,23 +16,144 @@ import (
 
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
-const maxImageSize = 1 << 20
+const renditionChunkSize = 64 << 10
 
 type LaptopServer struct {
 	pb.UnimplementedLaptopServiceServer
-	laptopStore LaptopStore
-	imageStore  ImageStore
-	ratingStore RatingStore
+	tenants      *TenantCatalogs
+	imageTypes   *ImageTypes
+	imageLimits  ImageLimits
+	maxImageSize int64
+	renditions   *Renditioner
+	uploads      *UploadSessions
+	quotas       ImageQuotas
+	collector    *ImageCollector
+	scoreRange   ScoreRange
+	prior        *RatingPrior
+	ratingGuard  *RatingGuard
+
+	// quotaMutex serializes the reservations of new images while quotas are enabled,
+	// so that concurrent uploads cannot exceed them together.
+	quotaMutex sync.Mutex
+}
+
+type LaptopServerOption func(server *LaptopServer)
+
+// WithImageTypes sets the image types clients may upload, DefaultImageTypes are allowed otherwise.
+func WithImageTypes(imageTypes *ImageTypes) LaptopServerOption {
+	return func(server *LaptopServer) {
+		server.imageTypes = imageTypes
+	}
+}
+
+// WithImageLimits sets the largest pixel dimensions of uploaded images.
+func WithImageLimits(imageLimits ImageLimits) LaptopServerOption {
+	return func(server *LaptopServer) {
+		server.imageLimits = imageLimits
+	}
+}
+
+// WithMaxImageSize sets the largest size in bytes of uploaded images, DefaultMaxImageSize otherwise.
+func WithMaxImageSize(maxImageSize int64) LaptopServerOption {
+	return func(server *LaptopServer) {
+		server.maxImageSize = maxImageSize
+	}
+}
+
+// WithRenditions sets the renditioner resizing the uploaded images.
+// By default, the DefaultRenditionSizes are only generated on demand.
+func WithRenditions(renditions *Renditioner) LaptopServerOption {
+	return func(server *LaptopServer) {
+		server.renditions = renditions
+	}
+}
+
+// WithUploadSessions sets the registry of resumable uploads,
+// by default sessions expire after DefaultUploadSessionTTL.
+func WithUploadSessions(uploads *UploadSessions) LaptopServerOption {
+	return func(server *LaptopServer) {
+		server.uploads = uploads
+	}
+}
+
+// WithImageQuotas limits the images clients can upload, there is no limit by default.
+func WithImageQuotas(quotas ImageQuotas) LaptopServerOption {
+	return func(server *LaptopServer) {
+		server.quotas = quotas
+	}
+}
+
+// WithImageCollector sets the garbage collector run by CollectImageGarbage, by default
+// it keeps orphan files for DefaultGCGracePeriod and leaves the images of missing laptops alone.
+func WithImageCollector(collector *ImageCollector) LaptopServerOption {
+	return func(server *LaptopServer) {
+		server.collector = collector
+	}
+}
+
+// WithScoreRange sets the scores users can rate laptops with, DefaultScoreRange otherwise.
+func WithScoreRange(scoreRange ScoreRange) LaptopServerOption {
+	return func(server *LaptopServer) {
+		server.scoreRange = scoreRange
+	}
+}
+
+// WithRatingPrior sets the prior of the Bayesian averages,
+// by default it's the middle of the score range weighing DefaultRatingPriorWeight ratings.
+func WithRatingPrior(prior RatingPrior) LaptopServerOption {
+	return func(server *LaptopServer) {
+		server.prior = &prior
+	}
+}
+
+// WithRatingLimits sets the limits protecting the ratings, DefaultRatingLimits otherwise.
+func WithRatingLimits(limits RatingLimits) LaptopServerOption {
+	return func(server *LaptopServer) {
+		server.ratingGuard = NewRatingGuard(limits)
+	}
+}
+
+// NewLaptopServer creates a server that only serves the default tenant.
+func NewLaptopServer(laptopStore LaptopStore, imageStore ImageStore, ratingStore RatingStore, opts ...LaptopServerOption) *LaptopServer {
+	catalog := NewCatalog(laptopStore, imageStore, ratingStore)
+	return NewMultiTenantLaptopServer(NewTenantCatalogs(catalog, nil), opts...)
 }
 
-func NewLaptopServer(laptopStore LaptopStore, imageStore ImageStore, ratingStore RatingStore) *LaptopServer {
-	return &LaptopServer{
-		laptopStore: laptopStore,
-		imageStore:  imageStore,
-		ratingStore: ratingStore,
+func NewMultiTenantLaptopServer(tenants *TenantCatalogs, opts ...LaptopServerOption) *LaptopServer {
+	defaultImageTypes, _ := NewImageTypes(DefaultImageTypes...)
+	defaultRenditions, _ := NewRenditioner(DefaultRenditionSizes, 0, 0)
+
+	server := &LaptopServer{
+		tenants:    tenants,
+		imageTypes: defaultImageTypes,
+		imageLimits: ImageLimits{
+			MaxWidth:  DefaultMaxImageWidth,
+			MaxHeight: DefaultMaxImageHeight,
+		},
+		maxImageSize: DefaultMaxImageSize,
+		renditions:   defaultRenditions,
+		uploads:      NewUploadSessions(DefaultUploadSessionTTL),
+		collector:    NewImageCollector(tenants, DefaultGCGracePeriod, false),
+		scoreRange:   DefaultScoreRange,
+		ratingGuard:  NewRatingGuard(DefaultRatingLimits),
 	}
+	for _, opt := range opts {
+		opt(server)
+	}
+	return server
+}
+
+// catalog returns the stores of the tenant making the request.
+func (server *LaptopServer) catalog(ctx context.Context) (*Catalog, error) {
+	tenant := TenantFromContext(ctx)
+	catalog := server.tenants.Find(tenant)
+	if catalog == nil {
+		return nil, errorLog(status.Errorf(codes.PermissionDenied, "tenant %s doesn't exist", tenant))
+	}
+	return catalog, nil
 }
 
 func (server *LaptopServer) CreateLaptop(ctx context.Context, req *pb.CreateLaptopRequest) (resp *pb.CreateLaptopResponse, err error) {
@@ -56,8 +180,13 @@ func (server *LaptopServer) CreateLaptop(ctx context.Context, req *pb.CreateLapt
 		return nil, err
 	}
 
+	catalog, err := server.catalog(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	// save the laptop to the store
-	err = server.laptopStore.Save(laptop)
+	err = catalog.laptopStore.Save(laptop)
 	if err != nil {
 		code := codes.Internal
 		if errors.Is(err, ErrAlreadyExists) {
@@ -81,7 +210,17 @@ func (server *LaptopServer) SearchLaptop(
 	filter := req.GetFilter()
 	log.Printf("receive a search-laptop request with filter: %v", filter)
 
-	err := server.laptopStore.Search(
+	catalog, err := server.catalog(stream.Context())
+	if err != nil {
+		return err
+	}
+
+	// the laptop stores don't know the ratings, so the rating sorts are done here
+	if ratingKey(filter) != nil {
+		return server.searchByRating(catalog, filter, stream)
+	}
+
+	err = catalog.laptopStore.Search(
 		stream.Context(),
 		filter,
 		func(laptop *pb.Laptop) error {
@@ -111,22 +250,34 @@ func (server *LaptopServer) UploadImage(stream pb.LaptopService_UploadImageServe
 		return errorLog(status.Error(codes.Unknown, "cannot receive image info"))
 	}
 
+	if sessionID := req.GetSessionId(); sessionID != "" {
+		return server.resumeImageUpload(stream, sessionID)
+	}
+
 	laptopID := req.GetInfo().GetLaptopId()
 	imageType := req.GetInfo().GetImageType()
+	digest := req.GetInfo().GetDigest()
 
-	log.Printf("receive an upload-image request for laptop %s with image type %s", laptopID, imageType)
+	log.Printf("receive an upload-image request for laptop %s with image type %q", laptopID, imageType)
 
-	laptop, err := server.laptopStore.Find(laptopID)
+	catalog, info, err := server.checkImageInfo(stream.Context(), req.GetInfo())
 	if err != nil {
-		return errorLog(status.Errorf(codes.Internal, "cannot find laptop: %v", err))
+		return err
 	}
 
-	if laptop == nil {
-		return errorLog(status.Errorf(codes.InvalidArgument, "laptop %s doesn't exists", laptopID))
+	err = server.checkQuotas(catalog, info)
+	if err != nil {
+		return errorLog(err)
 	}
 
-	imageData := bytes.Buffer{}
-	imageSize := 0
+	// the content is streamed to the store from the first chunk,
+	// without any chunk the client asks to reuse the content with the digest
+	var upload *imageUpload
+	defer func() {
+		if upload != nil {
+			upload.writer.Abort()
+		}
+	}()
 
 	for {
 		if err := contextError(stream.Context()); err != nil {
@@ -149,36 +300,320 @@ func (server *LaptopServer) UploadImage(stream pb.LaptopService_UploadImageServe
 
 		log.Printf("received a chunk with size: %d", size)
 
-		imageSize += size
-		if imageSize > maxImageSize {
-			return errorLog(status.Errorf(codes.InvalidArgument, "image is to large: %d > %d", imageSize, maxImageSize))
+		if upload == nil && size > 0 {
+			upload, err = newImageUpload(catalog.imageStore, server.maxImageSize)
+			if err != nil {
+				return errorLog(status.Errorf(codes.Internal, "cannot create image: %v", err))
+			}
 		}
 
 		// time.Sleep(time.Second)
 
-		_, err = imageData.Write(chunk)
+		err = writeChunk(upload, chunk)
 		if err != nil {
-			return errorLog(status.Errorf(codes.Internal, "cannot write chunk: %v", err))
+			return err
 		}
 	}
 
-	imageID, err := server.imageStore.Save(laptopID, imageType, imageData)
+	res, err := server.saveImage(catalog, info, digest, upload)
+	if err != nil {
+		return err
+	}
+	imageSize := res.GetSize()
 
+	err = stream.SendAndClose(res)
 	if err != nil {
-		return errorLog(status.Errorf(codes.Internal, "cannot save image to store: %v", err))
+		return errorLog(status.Errorf(codes.Unknown, "cannot send response: %v", err))
 	}
 
-	res := &pb.UploadImageResponse{
-		Id:   imageID,
-		Size: uint32(imageSize),
+	log.Printf("saved image with id: %s, size: %d", res.GetId(), imageSize)
+	return nil
+}
+
+// checkImageInfo validates the info of an upload and returns the catalog of the laptop.
+// The image is owned by the user making the request.
+func (server *LaptopServer) checkImageInfo(ctx context.Context, req *pb.ImageInfo) (*Catalog, *ImageInfo, error) {
+	imageType, err := server.imageTypes.Normalize(req.GetImageType())
+	if err != nil {
+		return nil, nil, errorLog(status.Errorf(codes.InvalidArgument, "%v", err))
 	}
 
+	if digest := req.GetDigest(); digest != "" {
+		if err := ValidateDigest(digest); err != nil {
+			return nil, nil, errorLog(status.Errorf(codes.InvalidArgument, "%v", err))
+		}
+	}
+
+	catalog, err := server.catalog(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	laptopID := req.GetLaptopId()
+	laptop, err := catalog.laptopStore.Find(laptopID)
+	if err != nil {
+		return nil, nil, errorLog(status.Errorf(codes.Internal, "cannot find laptop: %v", err))
+	}
+
+	if laptop == nil {
+		return nil, nil, errorLog(status.Errorf(codes.InvalidArgument, "laptop %s doesn't exists", laptopID))
+	}
+
+	err = validateImageDetails(req.GetCaption(), req.GetAltText())
+	if err != nil {
+		return nil, nil, errorLog(status.Errorf(codes.InvalidArgument, "%v", err))
+	}
+
+	info := &ImageInfo{
+		LaptopID: laptopID,
+		Type:     imageType,
+		Caption:  req.GetCaption(),
+		AltText:  req.GetAltText(),
+	}
+	if claims := ClaimsFromContext(ctx); claims != nil {
+		info.Owner = claims.Username
+	}
+	return catalog, info, nil
+}
+
+func writeChunk(upload *imageUpload, chunk []byte) error {
+	if len(chunk) == 0 {
+		return nil
+	}
+
+	_, err := upload.Write(chunk)
+	if errors.Is(err, ErrImageTooLarge) {
+		return errorLog(status.Errorf(codes.InvalidArgument, "%v", err))
+	}
+	if err != nil {
+		return errorLog(status.Errorf(codes.Internal, "cannot write chunk: %v", err))
+	}
+	return nil
+}
+
+// saveImage validates the received content and commits it to the catalog, the caller aborts the upload on failure.
+// Without any content, the client asks to reuse the content with the digest the store already has.
+func (server *LaptopServer) saveImage(catalog *Catalog, info *ImageInfo, digest string, upload *imageUpload) (*pb.UploadImageResponse, error) {
+	if upload == nil && digest == "" {
+		return nil, errorLog(status.Errorf(codes.InvalidArgument, "image has no content"))
+	}
+
+	var imageSize int64
+	if upload != nil {
+		imageSize = upload.Size()
+		actualDigest := upload.writer.Digest()
+		if digest != "" && digest != actualDigest {
+			return nil, errorLog(status.Errorf(codes.DataLoss, "image digest mismatch: got %s, expected %s", actualDigest, digest))
+		}
+		digest = actualDigest
+
+		metadata, err := inspectImage(upload.header, server.imageTypes.MIMEType(info.Type), server.imageLimits)
+		if err != nil {
+			return nil, errorLog(status.Errorf(codes.InvalidArgument, "%v", err))
+		}
+		info.Width = metadata.Width
+		info.Height = metadata.Height
+		info.Format = metadata.Format
+	}
+
+	var image *ImageInfo
+	err := catalog.uow.Do(info.LaptopID, func(tx *Tx) error {
+		laptop, err := tx.FindLaptop(info.LaptopID)
+		if err != nil {
+			return status.Errorf(codes.Internal, "cannot find laptop: %v", err)
+		}
+		if laptop == nil {
+			return status.Errorf(codes.InvalidArgument, "laptop %s doesn't exists", info.LaptopID)
+		}
+
+		reservation, err := server.reserveQuotas(catalog, info, digest, upload)
+		if err != nil {
+			return err
+		}
+		defer catalog.imageMeter.Release(reservation)
+
+		// a new image goes to the end of the gallery, the first one is the primary image
+		images, err := tx.ListImages(info.LaptopID)
+		if err != nil {
+			return status.Errorf(codes.Internal, "cannot list laptop images: %v", err)
+		}
+		info.Position = len(images)
+		if len(images) > 0 {
+			info.Position = images[len(images)-1].Position + 1
+		}
+		info.Primary = len(images) == 0
+
+		var imageID string
+		if upload == nil {
+			imageID, err = tx.LinkImage(info, digest)
+			if errors.Is(err, ErrNotFound) {
+				return status.Errorf(codes.NotFound, "image content %s is not found, upload it", digest)
+			}
+		} else {
+			upload.committed = true
+			imageID, err = tx.CommitImage(info, upload.writer)
+		}
+		if errors.Is(err, ErrInvalidImageType) || errors.Is(err, ErrInvalidImagePath) {
+			return status.Errorf(codes.InvalidArgument, "cannot save image to store: %v", err)
+		}
+		if err != nil {
+			return status.Errorf(codes.Internal, "cannot save image to store: %v", err)
+		}
+
+		image, err = tx.FindImage(imageID)
+		if err != nil || image == nil {
+			return status.Errorf(codes.Internal, "cannot find saved image: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errorLog(err)
+	}
+	server.renditions.Enqueue(catalog.renditionStore(), image.ID)
+
+	return &pb.UploadImageResponse{
+		Id:     image.ID,
+		Size:   uint32(imageSize),
+		Digest: digest,
+		Width:  uint32(image.Width),
+		Height: uint32(image.Height),
+		Format: image.Format,
+	}, nil
+}
+
+func (server *LaptopServer) StartImageUpload(ctx context.Context, req *pb.StartImageUploadRequest) (*pb.StartImageUploadResponse, error) {
+	log.Printf("receive a start-image-upload request for laptop %s with image type %q", req.GetInfo().GetLaptopId(), req.GetInfo().GetImageType())
+
+	if req.GetSize() > uint64(server.maxImageSize) {
+		return nil, errorLog(status.Errorf(codes.InvalidArgument, "%v: %d > %d bytes", ErrImageTooLarge, req.GetSize(), server.maxImageSize))
+	}
+
+	catalog, info, err := server.checkImageInfo(ctx, req.GetInfo())
+	if err != nil {
+		return nil, err
+	}
+
+	err = server.checkQuotas(catalog, info)
+	if err != nil {
+		return nil, errorLog(err)
+	}
+
+	upload, err := newImageUpload(catalog.imageStore, server.maxImageSize)
+	if err != nil {
+		return nil, errorLog(status.Errorf(codes.Internal, "cannot create image: %v", err))
+	}
+
+	session, err := server.uploads.Start(TenantFromContext(ctx), info, req.GetInfo().GetDigest(), int64(req.GetSize()), upload)
+	if err != nil {
+		upload.writer.Abort()
+		return nil, errorLog(status.Errorf(codes.Internal, "cannot start upload: %v", err))
+	}
+
+	log.Printf("started upload session %s", session.ID)
+	return &pb.StartImageUploadResponse{
+		SessionId: session.ID,
+		ExpiresAt: timestamppb.New(server.uploads.ExpiresAt(session)),
+	}, nil
+}
+
+func (server *LaptopServer) QueryUploadStatus(ctx context.Context, req *pb.QueryUploadStatusRequest) (*pb.QueryUploadStatusResponse, error) {
+	session := server.uploads.Find(TenantFromContext(ctx), req.GetSessionId())
+	if session == nil {
+		return nil, errorLog(status.Errorf(codes.NotFound, "upload session %s is not found", req.GetSessionId()))
+	}
+
+	return &pb.QueryUploadStatusResponse{
+		SessionId:     session.ID,
+		CommittedSize: uint64(session.Committed()),
+		Size:          uint64(session.Size),
+		ExpiresAt:     timestamppb.New(server.uploads.ExpiresAt(session)),
+	}, nil
+}
+
+// resumeImageUpload receives the chunks of an upload session.
+// If the stream breaks, the session keeps the content received so far.
+func (server *LaptopServer) resumeImageUpload(stream pb.LaptopService_UploadImageServer, sessionID string) error {
+	session := server.uploads.Find(TenantFromContext(stream.Context()), sessionID)
+	if session == nil {
+		return errorLog(status.Errorf(codes.NotFound, "upload session %s is not found", sessionID))
+	}
+
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+
+	// another stream may have completed the upload while this one was waiting
+	if server.uploads.Find(TenantFromContext(stream.Context()), sessionID) != session {
+		return errorLog(status.Errorf(codes.NotFound, "upload session %s is not found", sessionID))
+	}
+
+	log.Printf("resume upload session %s at offset %d", sessionID, session.Committed())
+
+	catalog, err := server.catalog(stream.Context())
+	if err != nil {
+		return err
+	}
+
+	for {
+		if err := contextError(stream.Context()); err != nil {
+			return err
+		}
+
+		req, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return errorLog(status.Errorf(codes.Unknown, "cannot receive chunk: %v", err))
+		}
+
+		chunk := req.GetChunk()
+		if chunk == nil {
+			return errorLog(status.Errorf(codes.InvalidArgument, "expected a chunk with offset"))
+		}
+
+		end := chunk.GetOffset() + uint64(len(chunk.GetData()))
+		if session.Size > 0 && end > uint64(session.Size) {
+			return errorLog(status.Errorf(codes.InvalidArgument, "chunk ends at %d, past the image size %d", end, session.Size))
+		}
+
+		err = session.Write(int64(chunk.GetOffset()), chunk.GetData())
+		if errors.Is(err, ErrInvalidOffset) {
+			return errorLog(status.Errorf(codes.OutOfRange, "%v", err))
+		}
+		if errors.Is(err, ErrImageTooLarge) {
+			return errorLog(status.Errorf(codes.InvalidArgument, "%v", err))
+		}
+		if err != nil {
+			return errorLog(status.Errorf(codes.Internal, "cannot write chunk: %v", err))
+		}
+		server.uploads.Touch(session)
+	}
+
+	if session.Size > 0 && session.Committed() < session.Size {
+		return errorLog(status.Errorf(
+			codes.FailedPrecondition,
+			"upload is incomplete: %d of %d bytes received", session.Committed(), session.Size,
+		))
+	}
+
+	res, err := server.saveImage(catalog, session.Info.Clone(), session.Digest, session.upload)
+	if err != nil {
+		// the client resumes the upload to retry, unless the content can never be saved
+		code := status.Code(err)
+		if session.upload.committed || code == codes.InvalidArgument || code == codes.DataLoss {
+			session.upload.writer.Abort()
+			server.uploads.Remove(sessionID)
+		}
+		return err
+	}
+	server.uploads.Remove(sessionID)
+
 	err = stream.SendAndClose(res)
 	if err != nil {
 		return errorLog(status.Errorf(codes.Unknown, "cannot send response: %v", err))
 	}
 
-	log.Printf("saved image with id: %s, size: %d", imageID, imageSize)
+	log.Printf("saved image with id: %s, size: %d from upload session %s", res.GetId(), res.GetSize(), sessionID)
 	return nil
 }
 
@@ -201,7 +636,18 @@ func contextError(ctx context.Context) error {
 
 }
 
+// RateLaptop records the scores of the authenticated user, who has a single score per laptop.
 func (server *LaptopServer) RateLaptop(stream pb.LaptopService_RateLaptopServer) error {
+	claims := ClaimsFromContext(stream.Context())
+	if claims == nil || claims.Username == "" {
+		return errorLog(status.Error(codes.Unauthenticated, "rating a laptop requires an authenticated user"))
+	}
+	tenant := TenantFromContext(stream.Context())
+
+	catalog, err := server.catalog(stream.Context())
+	if err != nil {
+		return err
+	}
 
 	for {
 		err := contextError(stream.Context())
@@ -218,34 +664,375 @@ func (server *LaptopServer) RateLaptop(stream pb.LaptopService_RateLaptopServer)
 			return errorLog(status.Errorf(codes.Unknown, "cannot receive stream request: %v", err))
 		}
 
-		laptopID := req.GetLaptopId()
-		score := req.GetScore()
+		res, err := server.rateLaptop(catalog, tenant, claims, req)
+		if err != nil {
+			return errorLog(err)
+		}
 
-		log.Printf("received a rate-laptop request: id = %s, score = %.2f", laptopID, score)
+		err = stream.Send(res)
+		if err != nil {
+			return errorLog(status.Errorf(codes.Unknown, "cannot send stream response: %v", err))
+		}
+	}
+	return nil
+}
+
+// rateLaptop records a rating of the stream. A request the client got wrong is answered
+// with an error status so that the stream goes on, an error is only returned for server failures.
+// The ratings of a burst from new accounts are quarantined instead of being added to the aggregates.
+func (server *LaptopServer) rateLaptop(catalog *Catalog, tenant string, claims *UserClaims, req *pb.RateLaptopRequest) (*pb.RateLaptopResponse, error) {
+	username := claims.Username
+	laptopID := req.GetLaptopId()
+	score := req.GetScore()
+
+	log.Printf("received a rate-laptop request: id = %s, score = %.2f, user = %s, request = %s", laptopID, score, username, req.GetRequestId())
+
+	res := &pb.RateLaptopResponse{
+		LaptopId:  laptopID,
+		RequestId: req.GetRequestId(),
+	}
+	rejected := func(code codes.Code, format string, args ...interface{}) (*pb.RateLaptopResponse, error) {
+		res.Status = &pb.RatingStatus{
+			Code:    uint32(code),
+			Message: fmt.Sprintf(format, args...),
+		}
+		log.Printf("rate-laptop request %s rejected: %s", req.GetRequestId(), res.Status.Message)
+		return res, nil
+	}
 
-		found, err := server.laptopStore.Find(laptopID)
+	if laptopID == "" {
+		return rejected(codes.InvalidArgument, "laptop ID is missing")
+	}
+	if err := server.scoreRange.Check(score); err != nil {
+		return rejected(codes.InvalidArgument, "%v", err)
+	}
+
+	now := time.Now()
+	var accountCreatedAt time.Time
+	if claims.AccountCreatedAt != nil {
+		accountCreatedAt = claims.AccountCreatedAt.Time
+	}
+
+	var rating *Rating
+	var updated bool
+	var quarantined *QuarantinedRating
+	err := catalog.uow.Do(laptopID, func(tx *Tx) error {
+		found, err := tx.FindLaptop(laptopID)
 		if err != nil {
-			return errorLog(status.Errorf(codes.Internal, "cannot find laptop: %v", err))
+			return status.Errorf(codes.Internal, "cannot find laptop: %v", err)
 		}
 		if found == nil {
-			return errorLog(status.Errorf(codes.NotFound, "laptopID %s is not found", laptopID))
+			return status.Errorf(codes.NotFound, "laptopID %s is not found", laptopID)
+		}
+
+		// only the ratings of existing laptops with valid scores count against the limit
+		if !server.ratingGuard.Allow(tenant, username, now) {
+			limits := server.ratingGuard.limits
+			return status.Errorf(codes.ResourceExhausted, "cannot rate more than %d laptops per %v", limits.MaxPerUser, limits.Window)
+		}
+
+		if server.ratingGuard.Suspicious(tenant, laptopID, accountCreatedAt, now) {
+			quarantined, err = catalog.quarantine.Add(laptopID, username, score, "burst of ratings from new accounts")
+			if err != nil {
+				return status.Errorf(codes.Internal, "cannot quarantine rating: %v", err)
+			}
+			rating, err = tx.FindRating(laptopID)
+			if err != nil {
+				return status.Errorf(codes.Internal, "cannot find rating: %v", err)
+			}
+			return nil
 		}
 
-		rating, err := server.ratingStore.Add(laptopID, score)
+		rating, updated, err = tx.AddRating(laptopID, username, score, now)
+		if err != nil {
+			return status.Errorf(codes.Internal, "cannot add rating to the store: %v", err)
+		}
+		err = catalog.quarantine.RemoveBy(laptopID, username)
 		if err != nil {
-			return errorLog(status.Errorf(codes.Internal, "cannot add rating to the store: %v", err))
+			return status.Errorf(codes.Internal, "cannot release quarantined rating: %v", err)
 		}
+		return nil
+	})
+	if code := status.Code(err); code == codes.NotFound || code == codes.ResourceExhausted {
+		return rejected(code, "%s", status.Convert(err).Message())
+	}
+	if err != nil {
+		return nil, err
+	}
 
-		res := &pb.RateLaptopResponse{
-			LaptopId:     laptopID,
-			RatedCount:   rating.Count,
-			AverageScore: rating.Sum / float64(rating.Count),
+	if quarantined != nil {
+		log.Printf("quarantined rating %s of laptop %s by %s", quarantined.ID, laptopID, username)
+		res.Quarantined = true
+	}
+	if rating == nil {
+		rating = &Rating{}
+	}
+
+	res.RatedCount = rating.Count
+	res.AverageScore = rating.Average()
+	res.DecayedAverageScore = rating.DecayedAverage()
+	res.Updated = updated
+	return res, nil
+}
+
+// RebuildRatings recomputes the rating aggregates of the tenant after its rating log was repaired.
+func (server *LaptopServer) RebuildRatings(ctx context.Context, req *pb.RebuildRatingsRequest) (*pb.RebuildRatingsResponse, error) {
+	tenant := TenantFromContext(ctx)
+	log.Printf("receive a rebuild-ratings request for tenant %s", tenant)
+
+	catalog, err := server.catalog(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	store, ok := catalog.ratingStore.(RebuildableRatingStore)
+	if !ok {
+		return nil, errorLog(status.Errorf(codes.FailedPrecondition, "the rating store of tenant %s doesn't keep rating events", tenant))
+	}
+
+	var stats RatingLogStats
+	err = catalog.uow.DoAll(func(tx *Tx) error {
+		previous := store.Summaries()
+		stats, err = store.Rebuild()
+		if err != nil {
+			return err
 		}
+		catalog.quarantine.load()
 
-		err = stream.Send(res)
+		// the watchers get the rebuilt rating of every laptop, and the removal of the ones left without any
+		rebuilt := store.Summaries()
+		for laptopID, rating := range rebuilt {
+			catalog.ratingPublisher.Publish(laptopID, rating)
+		}
+		for laptopID := range previous {
+			if rebuilt[laptopID] == nil {
+				catalog.ratingPublisher.Publish(laptopID, nil)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errorLog(status.Errorf(codes.Internal, "cannot rebuild ratings: %v", err))
+	}
+
+	log.Printf("rebuilt %d ratings of %d laptops from %d events", stats.Ratings, stats.Laptops, stats.Events)
+	return &pb.RebuildRatingsResponse{
+		EventCount:  uint64(stats.Events),
+		LaptopCount: uint32(stats.Laptops),
+		RatingCount: uint32(stats.Ratings),
+	}, nil
+}
+
+func (server *LaptopServer) DeleteLaptop(ctx context.Context, req *pb.DeleteLaptopRequest) (*pb.DeleteLaptopResponse, error) {
+	laptopID := req.GetId()
+	log.Printf("receive a delete-laptop request with id: %s", laptopID)
+
+	if err := contextError(ctx); err != nil {
+		return nil, err
+	}
+
+	catalog, err := server.catalog(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var images []*ImageInfo
+	err = catalog.uow.Do(laptopID, func(tx *Tx) error {
+		err := tx.DeleteRating(laptopID)
 		if err != nil {
-			return errorLog(status.Errorf(codes.Unknown, "cannot send stream response: %v", err))
+			return status.Errorf(codes.Internal, "cannot delete laptop rating: %v", err)
+		}
+
+		err = tx.DeleteLaptop(laptopID)
+		if err != nil {
+			code := codes.Internal
+			if errors.Is(err, ErrNotFound) {
+				code = codes.NotFound
+			}
+			return status.Errorf(code, "cannot delete laptop: %v", err)
+		}
+
+		if catalog.imageStore == nil {
+			return nil
+		}
+		images, err = tx.ListImages(laptopID)
+		if err != nil {
+			return status.Errorf(codes.Internal, "cannot list laptop images: %v", err)
 		}
+		return nil
+	})
+	if err != nil {
+		return nil, errorLog(err)
+	}
+
+	deleteLaptopDependents(catalog, laptopID, images)
+
+	log.Printf("deleted laptop with id: %s", laptopID)
+	return &pb.DeleteLaptopResponse{}, nil
+}
+
+// deleteLaptopDependents deletes the images, quarantined ratings and reviews of the deleted laptop.
+// They can't be restored, so they are deleted after the laptop is, and they are only reachable through it:
+// failing to delete them is not an error, the images left behind are orphans for the collector.
+func deleteLaptopDependents(catalog *Catalog, laptopID string, images []*ImageInfo) {
+	for _, image := range images {
+		err := catalog.uow.Do(laptopID, func(tx *Tx) error {
+			return tx.DeleteImage(image.ID)
+		})
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			log.Printf("cannot delete image %s of laptop %s: %v", image.ID, laptopID, err)
+		}
+	}
+
+	err := catalog.quarantine.DeleteLaptop(laptopID)
+	if err != nil {
+		log.Printf("cannot delete quarantined ratings of laptop %s: %v", laptopID, err)
+	}
+	err = catalog.reviewStore.DeleteLaptop(laptopID)
+	if err != nil {
+		log.Printf("cannot delete reviews of laptop %s: %v", laptopID, err)
+	}
+}
+
+func (server *LaptopServer) GetImageInfo(ctx context.Context, req *pb.GetImageInfoRequest) (*pb.GetImageInfoResponse, error) {
+	imageID := req.GetImageId()
+	log.Printf("receive a get-image-info request with id: %s", imageID)
+
+	catalog, err := server.catalog(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	image, err := catalog.imageStore.Find(imageID)
+	if err != nil {
+		return nil, errorLog(status.Errorf(codes.Internal, "cannot find image: %v", err))
+	}
+	if image == nil {
+		return nil, errorLog(status.Errorf(codes.NotFound, "image %s is not found", imageID))
+	}
+
+	return &pb.GetImageInfoResponse{Image: imageToPB(image)}, nil
+}
+
+func (server *LaptopServer) GetImageRendition(
+	req *pb.GetImageRenditionRequest,
+	stream pb.LaptopService_GetImageRenditionServer,
+) error {
+	imageID := req.GetImageId()
+	size := int(req.GetSize())
+	log.Printf("receive a get-image-rendition request with id: %s, size: %d", imageID, size)
+
+	if size != 0 && !server.renditions.HasSize(size) {
+		return errorLog(status.Errorf(codes.InvalidArgument, "rendition size %d is not one of %v", size, server.renditions.Sizes()))
+	}
+
+	catalog, err := server.catalog(stream.Context())
+	if err != nil {
+		return err
+	}
+
+	image, err := catalog.imageStore.Find(imageID)
+	if err != nil {
+		return errorLog(status.Errorf(codes.Internal, "cannot find image: %v", err))
+	}
+	if image == nil {
+		return errorLog(status.Errorf(codes.NotFound, "image %s is not found", imageID))
+	}
+
+	info := &pb.RenditionInfo{
+		ImageId:   imageID,
+		Size:      uint32(size),
+		ImageType: image.Type,
+		Width:     uint32(image.Width),
+		Height:    uint32(image.Height),
+	}
+
+	var content io.Reader
+	if size == 0 {
+		file, err := catalog.imageStore.Open(imageID)
+		if err != nil {
+			return errorLog(status.Errorf(codes.Internal, "cannot open image: %v", err))
+		}
+		defer file.Close()
+		content = file
+	} else {
+		data, err := server.rendition(catalog.renditionStore(), imageID, size)
+		if errors.Is(err, ErrNotFound) {
+			return errorLog(status.Errorf(codes.NotFound, "image %s is not found", imageID))
+		}
+		if errors.Is(err, ErrInvalidImageContent) {
+			return errorLog(status.Errorf(codes.FailedPrecondition, "cannot resize image: %v", err))
+		}
+		if err != nil {
+			return errorLog(status.Errorf(codes.Internal, "cannot generate rendition: %v", err))
+		}
+
+		width, height := renditionDimensions(image.Width, image.Height, size)
+		info.ImageType = RenditionType(image)
+		info.Width = uint32(width)
+		info.Height = uint32(height)
+		content = bytes.NewReader(data)
+	}
+
+	err = stream.Send(&pb.GetImageRenditionResponse{
+		Data: &pb.GetImageRenditionResponse_Info{Info: info},
+	})
+	if err != nil {
+		return errorLog(status.Errorf(codes.Unknown, "cannot send rendition info: %v", err))
+	}
+
+	buffer := make([]byte, renditionChunkSize)
+	for {
+		if err := contextError(stream.Context()); err != nil {
+			return err
+		}
+
+		n, err := content.Read(buffer)
+		if n > 0 {
+			sendErr := stream.Send(&pb.GetImageRenditionResponse{
+				Data: &pb.GetImageRenditionResponse_ChunkData{ChunkData: buffer[:n]},
+			})
+			if sendErr != nil {
+				return errorLog(status.Errorf(codes.Unknown, "cannot send chunk data: %v", sendErr))
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errorLog(status.Errorf(codes.Internal, "cannot read image: %v", err))
+		}
+	}
+}
+
+// rendition returns the stored rendition, or generates it if it isn't built yet.
+func (server *LaptopServer) rendition(imageStore ImageStore, imageID string, size int) ([]byte, error) {
+	file, err := imageStore.OpenRendition(imageID, size)
+	if err == nil {
+		return readAllAndClose(file)
+	}
+	if !errors.Is(err, ErrNotFound) {
+		return nil, err
+	}
+
+	log.Printf("generate rendition of image %s with size %d on demand", imageID, size)
+	return server.renditions.Generate(imageStore, imageID, size)
+}
+
+func imageToPB(image *ImageInfo) *pb.Image {
+	return &pb.Image{
+		Id:        image.ID,
+		LaptopId:  image.LaptopID,
+		ImageType: image.Type,
+		Size:      uint64(image.Size),
+		Digest:    image.Digest,
+		Width:     uint32(image.Width),
+		Height:    uint32(image.Height),
+		Format:    image.Format,
+		CreatedAt: timestamppb.New(image.CreatedAt),
+		Caption:   image.Caption,
+		AltText:   image.AltText,
+		Position:  uint32(image.Position),
+		Primary:   image.Primary,
 	}
-	return nil
 }
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"sort"
 	"sync"
 	"time"
 
@@ -13,10 +14,12 @@ import (
 )
 
 var ErrAlreadyExists = errors.New("record already exists")
+var ErrNotFound = errors.New("record not found")
 
 type LaptopStore interface {
 	Save(laptop *pb.Laptop) error
 	Find(id string) (*pb.Laptop, error)
+	Delete(id string) error
 	Search(ctx context.Context, filter *pb.Filter, found func(laptop *pb.Laptop) error) error
 }
 
@@ -59,11 +62,25 @@ func (store *InMemoryLaptopStore) Find(id string) (*pb.Laptop, error) {
 	return deepCopy(laptop)
 }
 
+func (store *InMemoryLaptopStore) Delete(id string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if store.data[id] == nil {
+		return ErrNotFound
+	}
+	delete(store.data, id)
+	return nil
+}
+
 func (store *InMemoryLaptopStore) Search(
 	ctx context.Context,
 	filter *pb.Filter,
 	found func(laptop *pb.Laptop) error,
 ) error {
+	less := laptopLess(filter)
+	var matched []*pb.Laptop
+
 	{
 		store.mutex.RLock()
 		defer store.mutex.RUnlock()
@@ -84,6 +101,11 @@ func (store *InMemoryLaptopStore) Search(
 					return err
 				}
 
+				if less != nil {
+					matched = append(matched, other)
+					continue
+				}
+
 				err = found(other)
 				if err != nil {
 					return err
@@ -92,6 +114,16 @@ func (store *InMemoryLaptopStore) Search(
 			}
 		}
 	}
+
+	sort.SliceStable(matched, func(i, j int) bool {
+		return less(matched[i], matched[j])
+	})
+	for _, laptop := range matched {
+		err := found(laptop)
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -115,6 +147,32 @@ func isQualified(filter *pb.Filter, laptop *pb.Laptop) bool {
 	return true
 }
 
+// laptopLess returns the ordering requested by the filter,
+// or nil if the results don't need to be sorted.
+func laptopLess(filter *pb.Filter) func(laptop1, laptop2 *pb.Laptop) bool {
+	var key func(laptop *pb.Laptop) float64
+
+	switch filter.GetSortBy() {
+	case pb.Filter_PRICE:
+		key = func(laptop *pb.Laptop) float64 { return laptop.GetPriceUsd() }
+	case pb.Filter_CPU_GHZ:
+		key = func(laptop *pb.Laptop) float64 { return laptop.GetCpu().GetMinGhz() }
+	case pb.Filter_RELEASE_YEAR:
+		key = func(laptop *pb.Laptop) float64 { return float64(laptop.GetReleaseYear()) }
+	default:
+		return nil
+	}
+
+	if filter.GetDescending() {
+		return func(laptop1, laptop2 *pb.Laptop) bool {
+			return key(laptop1) > key(laptop2)
+		}
+	}
+	return func(laptop1, laptop2 *pb.Laptop) bool {
+		return key(laptop1) < key(laptop2)
+	}
+}
+
 func toBit(memory *pb.Memory) uint64 {
 	value := memory.GetValue()
 
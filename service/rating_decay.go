@@ -0,0 +1,101 @@
+package service
+
+import (
+	"math"
+	"time"
+)
+
+// DefaultRatingHalfLife is how long it takes for a score to weigh half as much in the decayed averages.
+const DefaultRatingHalfLife = 180 * 24 * time.Hour
+
+// RatingStoreOption configures the aggregates computed by a rating store.
+type RatingStoreOption func(config *ratingConfig)
+
+type ratingConfig struct {
+	halfLife time.Duration
+}
+
+// WithRatingHalfLife sets the half-life of the scores in the decayed averages, 0 disables the decay.
+func WithRatingHalfLife(halfLife time.Duration) RatingStoreOption {
+	return func(config *ratingConfig) {
+		config.halfLife = halfLife
+	}
+}
+
+func newRatingConfig(opts []RatingStoreOption) ratingConfig {
+	config := ratingConfig{
+		halfLife: DefaultRatingHalfLife,
+	}
+	for _, opt := range opts {
+		opt(&config)
+	}
+	return config
+}
+
+// decay is the weight of a score given elapsed before another one weighing 1.
+func decay(elapsed time.Duration, halfLife time.Duration) float64 {
+	if halfLife <= 0 {
+		return 1
+	}
+	return math.Exp2(-elapsed.Seconds() / halfLife.Seconds())
+}
+
+// DecayedAverage is the average of the scores weighted by their age, the weight of a score
+// halving every HalfLife. All weights decay at the same pace, so the average only changes
+// with new scores and it's kept up to date as they are given instead of computed on reads.
+func (rating *Rating) DecayedAverage() float64 {
+	return rating.Aggregates().DecayedAverage()
+}
+
+func (aggregates *RatingAggregates) DecayedAverage() float64 {
+	if aggregates.Count == 0 || aggregates.DecayedWeight <= 0 {
+		return 0
+	}
+	return aggregates.DecayedSum / aggregates.DecayedWeight
+}
+
+// addDecayed adds a score given at the time to the decayed sums, which are weighted
+// as of the latest score.
+func (rating *Rating) addDecayed(score float64, ratedAt time.Time) {
+	weight := 1.0
+	switch {
+	case rating.DecayedAt.IsZero():
+		rating.DecayedAt = ratedAt
+	case ratedAt.After(rating.DecayedAt):
+		factor := decay(ratedAt.Sub(rating.DecayedAt), rating.HalfLife)
+		rating.DecayedSum *= factor
+		rating.DecayedWeight *= factor
+		rating.DecayedAt = ratedAt
+	default:
+		weight = decay(rating.DecayedAt.Sub(ratedAt), rating.HalfLife)
+	}
+
+	rating.DecayedSum += score * weight
+	rating.DecayedWeight += weight
+}
+
+// removeDecayed takes a score given at the time out of the decayed sums. Subtracting its weight
+// loses some precision of the remaining scores, so once as many scores were removed as remain,
+// the sums are computed again from the scores, which only sorts them once every so many removals.
+func (rating *Rating) removeDecayed(score float64, ratedAt time.Time) {
+	rating.removals++
+	if rating.removals > rating.Count {
+		rating.redecay()
+		return
+	}
+
+	weight := decay(rating.DecayedAt.Sub(ratedAt), rating.HalfLife)
+	rating.DecayedSum -= score * weight
+	rating.DecayedWeight -= weight
+}
+
+// redecay computes the decayed sums again from every score.
+func (rating *Rating) redecay() {
+	rating.DecayedSum = 0
+	rating.DecayedWeight = 0
+	rating.DecayedAt = time.Time{}
+	rating.removals = 0
+	for _, username := range sortedUsernames(rating.Scores) {
+		rating.addDecayed(rating.Scores[username], rating.RatedAt[username])
+	}
+}
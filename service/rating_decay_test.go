@@ -0,0 +1,187 @@
+package service_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Dostonlv/pcbook/pb"
+	"github.com/Dostonlv/pcbook/sample"
+	"github.com/Dostonlv/pcbook/service"
+	"github.com/stretchr/testify/require"
+)
+
+const testHalfLife = 30 * 24 * time.Hour
+
+// writeRatingLog writes the events of a rating log.
+func writeRatingLog(t *testing.T, filename string, events ...service.RatingEvent) {
+	file, err := os.Create(filename)
+	require.NoError(t, err)
+	defer file.Close()
+
+	encoder := json.NewEncoder(file)
+	for _, event := range events {
+		require.NoError(t, encoder.Encode(event))
+	}
+}
+
+func rateEvent(laptopID string, username string, score float64, ratedAt time.Time) service.RatingEvent {
+	return service.RatingEvent{
+		Kind:     service.RatingEventRate,
+		LaptopID: laptopID,
+		Username: username,
+		Score:    score,
+		Time:     ratedAt,
+	}
+}
+
+func TestRatingDecayedAverage(t *testing.T) {
+	t.Parallel()
+
+	start := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	filename := filepath.Join(t.TempDir(), "ratings.jsonl")
+	writeRatingLog(t, filename,
+		rateEvent("laptop", "alice", 10, start),
+		rateEvent("laptop", "bob", 4, start.Add(2*testHalfLife)),
+		// a score logged late still weighs as of when it was given
+		rateEvent("laptop", "carol", 6, start.Add(testHalfLife)),
+	)
+
+	store, err := service.NewFileRatingStore(filename, service.WithRatingHalfLife(testHalfLife))
+	require.NoError(t, err)
+	defer store.Close()
+
+	rating, err := store.Find("laptop")
+	require.NoError(t, err)
+	require.InDelta(t, 20.0/3, rating.Average(), 1e-9)
+	// alice weighs 1/4 and carol 1/2 of bob
+	require.InDelta(t, (10*0.25+6*0.5+4)/1.75, rating.DecayedAverage(), 1e-9)
+
+	// replacing the score of alice only takes her previous one out
+	err = store.Save("laptop", &service.Rating{
+		Scores:  map[string]float64{"alice": 8, "bob": 4, "carol": 6},
+		RatedAt: map[string]time.Time{"alice": start.Add(2 * testHalfLife), "bob": start.Add(2 * testHalfLife), "carol": start.Add(testHalfLife)},
+	})
+	require.NoError(t, err)
+	rating, err = store.Find("laptop")
+	require.NoError(t, err)
+	require.InDelta(t, (8+6*0.5+4)/2.5, rating.DecayedAverage(), 1e-9)
+
+	// scores given years before barely count next to a new one
+	rating, _, err = store.Add("laptop", "dave", 2, time.Now())
+	require.NoError(t, err)
+	require.InDelta(t, 2.0, rating.DecayedAverage(), 1e-9)
+	require.InDelta(t, 5.0, rating.Average(), 1e-9)
+
+	// the aggregates are the same when computed again from the log
+	stats, err := store.Rebuild()
+	require.NoError(t, err)
+	require.Equal(t, 4, stats.Ratings)
+	rebuilt, err := store.Find("laptop")
+	require.NoError(t, err)
+	require.InDelta(t, rating.DecayedAverage(), rebuilt.DecayedAverage(), 1e-9)
+
+	undecayed, err := service.NewFileRatingStore(filename, service.WithRatingHalfLife(0))
+	require.NoError(t, err)
+	defer undecayed.Close()
+	rating, err = undecayed.Find("laptop")
+	require.NoError(t, err)
+	require.InDelta(t, rating.Average(), rating.DecayedAverage(), 1e-9)
+}
+
+func TestClientSearchLaptopByRating(t *testing.T) {
+	t.Parallel()
+
+	laptopStore := service.NewShardedLaptopStore(service.DefaultShardCount)
+	classic := sample.NewLaptop()
+	recent := sample.NewLaptop()
+	unrated := sample.NewLaptop()
+	for _, laptop := range []*pb.Laptop{classic, recent, unrated} {
+		laptop.PriceUsd = 1000
+		require.NoError(t, laptopStore.Save(laptop))
+	}
+
+	now := time.Now().UTC()
+	old := now.Add(-10 * testHalfLife)
+	filename := filepath.Join(t.TempDir(), "ratings.jsonl")
+	writeRatingLog(t, filename,
+		rateEvent(classic.GetId(), "alice", 10, old),
+		rateEvent(classic.GetId(), "bob", 10, old),
+		rateEvent(classic.GetId(), "carol", 4, now),
+		rateEvent(recent.GetId(), "alice", 7, now),
+	)
+	ratingStore, err := service.NewFileRatingStore(filename, service.WithRatingHalfLife(testHalfLife))
+	require.NoError(t, err)
+	t.Cleanup(func() { ratingStore.Close() })
+
+	laptopServer := service.NewLaptopServer(laptopStore, nil, ratingStore)
+	laptopClient := newTestLaptopClient(t, startTestLaptopServerWith(t, laptopServer))
+
+	search := func(sortBy pb.Filter_SortBy, descending bool) []string {
+		stream, err := laptopClient.SearchLaptop(context.Background(), &pb.SearchLaptopRequest{
+			Filter: &pb.Filter{MaxPriceUsd: 2000, SortBy: sortBy, Descending: descending},
+		})
+		require.NoError(t, err)
+
+		var ids []string
+		for {
+			res, err := stream.Recv()
+			if err == io.EOF {
+				return ids
+			}
+			require.NoError(t, err)
+			ids = append(ids, res.GetLaptop().GetId())
+		}
+	}
+
+	require.Equal(t, []string{classic.GetId(), recent.GetId(), unrated.GetId()}, search(pb.Filter_RATING, true))
+	require.Equal(t, []string{recent.GetId(), classic.GetId(), unrated.GetId()}, search(pb.Filter_DECAYED_RATING, true))
+	require.Equal(t, []string{classic.GetId(), recent.GetId(), unrated.GetId()}, search(pb.Filter_DECAYED_RATING, false))
+
+	res, err := laptopClient.GetRatingSummary(context.Background(), &pb.GetRatingSummaryRequest{LaptopIds: []string{classic.GetId()}})
+	require.NoError(t, err)
+	require.InDelta(t, 8.0, res.GetSummaries()[0].GetAverageScore(), 1e-9)
+	require.Less(t, res.GetSummaries()[0].GetDecayedAverage(), 4.1)
+
+	stream, err := laptopClient.TopRatedLaptops(context.Background(), &pb.TopRatedLaptopsRequest{RankBy: pb.TopRatedLaptopsRequest_DECAYED_AVERAGE})
+	require.NoError(t, err)
+	top, err := stream.Recv()
+	require.NoError(t, err)
+	require.Equal(t, recent.GetId(), top.GetLaptop().GetId())
+}
+
+func TestRatingDecayedAverageAfterRemovals(t *testing.T) {
+	t.Parallel()
+
+	start := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	store := service.NewInMemoryRatingStore(service.WithRatingHalfLife(testHalfLife))
+	users := []string{"alice", "bob", "carol", "dave"}
+	scores := make(map[string]float64)
+	ratedAt := make(map[string]time.Time)
+
+	// every user rates the laptop again and again, replacing their previous score
+	for i := 0; i < 50; i++ {
+		username := users[i%len(users)]
+		scores[username] = float64(1 + i%10)
+		ratedAt[username] = start.Add(time.Duration(i) * testHalfLife / 7)
+		_, _, err := store.Add("laptop", username, scores[username], ratedAt[username])
+		require.NoError(t, err)
+	}
+
+	expected := service.NewInMemoryRatingStore(service.WithRatingHalfLife(testHalfLife))
+	for _, username := range users {
+		_, _, err := expected.Add("laptop", username, scores[username], ratedAt[username])
+		require.NoError(t, err)
+	}
+
+	rating, err := store.Find("laptop")
+	require.NoError(t, err)
+	want, err := expected.Find("laptop")
+	require.NoError(t, err)
+	require.Equal(t, want.Count, rating.Count)
+	require.InDelta(t, want.DecayedAverage(), rating.DecayedAverage(), 1e-9)
+}
@@ -0,0 +1,384 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Dostonlv/pcbook/pb"
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// RatingLimits protect the ratings from floods and fake accounts, a zero limit disables its check.
+type RatingLimits struct {
+	// MaxPerUser is how many ratings a user can give within Window.
+	MaxPerUser int
+	Window     time.Duration
+	// BurstSize ratings of a laptop by accounts younger than NewAccountAge within BurstWindow
+	// are a burst, the ratings of new accounts are quarantined from the BurstSize-th one on.
+	BurstSize     int
+	BurstWindow   time.Duration
+	NewAccountAge time.Duration
+}
+
+var DefaultRatingLimits = RatingLimits{
+	MaxPerUser:    60,
+	Window:        time.Hour,
+	BurstSize:     5,
+	BurstWindow:   10 * time.Minute,
+	NewAccountAge: 24 * time.Hour,
+}
+
+// RatingGuard tracks the recent ratings of every tenant to enforce the rating limits.
+type RatingGuard struct {
+	mutex      sync.Mutex
+	limits     RatingLimits
+	userRates  map[string][]time.Time
+	newRatings map[string][]time.Time
+	sweptAt    time.Time
+}
+
+func NewRatingGuard(limits RatingLimits) *RatingGuard {
+	return &RatingGuard{
+		limits:     limits,
+		userRates:  make(map[string][]time.Time),
+		newRatings: make(map[string][]time.Time),
+	}
+}
+
+// Allow records a rating of the user and reports whether it's within their limit,
+// the ratings over the limit aren't recorded.
+func (guard *RatingGuard) Allow(tenant string, username string, now time.Time) bool {
+	if guard.limits.MaxPerUser <= 0 || guard.limits.Window <= 0 {
+		return true
+	}
+
+	guard.mutex.Lock()
+	defer guard.mutex.Unlock()
+
+	guard.sweep(now)
+	key := tenant + "/" + username
+	times := recentTimes(guard.userRates[key], now.Add(-guard.limits.Window))
+	if len(times) >= guard.limits.MaxPerUser {
+		guard.userRates[key] = times
+		return false
+	}
+	guard.userRates[key] = append(times, now)
+	return true
+}
+
+// Suspicious records a rating of the laptop by an account created at the time,
+// and reports whether it's part of a burst of ratings from new accounts.
+// The creation time of the accounts created before it was recorded is zero, they are never new.
+func (guard *RatingGuard) Suspicious(tenant string, laptopID string, accountCreatedAt time.Time, now time.Time) bool {
+	limits := guard.limits
+	if limits.BurstSize <= 0 || limits.BurstWindow <= 0 || limits.NewAccountAge <= 0 {
+		return false
+	}
+	if accountCreatedAt.IsZero() || now.Sub(accountCreatedAt) >= limits.NewAccountAge {
+		return false
+	}
+
+	guard.mutex.Lock()
+	defer guard.mutex.Unlock()
+
+	guard.sweep(now)
+	key := tenant + "/" + laptopID
+	times := append(recentTimes(guard.newRatings[key], now.Add(-limits.BurstWindow)), now)
+	guard.newRatings[key] = times
+	return len(times) >= limits.BurstSize
+}
+
+// sweep forgets the users and laptops without recent ratings, at most once per window.
+func (guard *RatingGuard) sweep(now time.Time) {
+	window := guard.limits.Window
+	if guard.limits.BurstWindow > window {
+		window = guard.limits.BurstWindow
+	}
+	if now.Sub(guard.sweptAt) < window {
+		return
+	}
+	guard.sweptAt = now
+
+	for _, times := range []map[string][]time.Time{guard.userRates, guard.newRatings} {
+		for key, recent := range times {
+			if len(recent) == 0 || !recent[len(recent)-1].After(now.Add(-window)) {
+				delete(times, key)
+			}
+		}
+	}
+}
+
+// recentTimes drops the times that aren't after the cutoff, the times are in ascending order.
+func recentTimes(times []time.Time, cutoff time.Time) []time.Time {
+	i := 0
+	for i < len(times) && !times[i].After(cutoff) {
+		i++
+	}
+	return times[i:]
+}
+
+// QuarantinedRating is a rating kept out of the aggregates until an admin reviews it.
+type QuarantinedRating struct {
+	ID       string
+	LaptopID string
+	Username string
+	Score    float64
+	RatedAt  time.Time
+	Reason   string
+}
+
+// QuarantineLog is implemented by the rating stores keeping the quarantined ratings along with the scores,
+// so that they outlive a restart. Quarantine replaces the quarantined rating of the user for the laptop.
+type QuarantineLog interface {
+	QuarantinedRatings() []*QuarantinedRating
+	Quarantine(rating *QuarantinedRating) error
+	Release(ratings ...*QuarantinedRating) error
+}
+
+// RatingQuarantine keeps the quarantined ratings of a tenant, at most one per user and laptop.
+// They are logged if the quarantine has a log, otherwise they are only kept in memory.
+type RatingQuarantine struct {
+	mutex   sync.RWMutex
+	log     QuarantineLog
+	ratings map[string]*QuarantinedRating
+}
+
+// NewRatingQuarantine creates a quarantine with the ratings of the log, which may be nil.
+func NewRatingQuarantine(log QuarantineLog) *RatingQuarantine {
+	quarantine := &RatingQuarantine{
+		log: log,
+	}
+	quarantine.load()
+	return quarantine
+}
+
+// load replaces the quarantined ratings with those of the log, after the log was rebuilt.
+func (quarantine *RatingQuarantine) load() {
+	quarantine.mutex.Lock()
+	defer quarantine.mutex.Unlock()
+
+	quarantine.ratings = make(map[string]*QuarantinedRating)
+	if quarantine.log == nil {
+		return
+	}
+	for _, rating := range quarantine.log.QuarantinedRatings() {
+		quarantine.ratings[rating.ID] = rating
+	}
+}
+
+// Add quarantines the rating, replacing the quarantined rating of the user for the laptop.
+func (quarantine *RatingQuarantine) Add(laptopID string, username string, score float64, reason string) (*QuarantinedRating, error) {
+	quarantine.mutex.Lock()
+	defer quarantine.mutex.Unlock()
+
+	rating := &QuarantinedRating{
+		ID:       uuid.New().String(),
+		LaptopID: laptopID,
+		Username: username,
+		Score:    score,
+		RatedAt:  time.Now().UTC(),
+		Reason:   reason,
+	}
+	if quarantine.log != nil {
+		err := quarantine.log.Quarantine(rating)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, other := range quarantine.ratingsOf(laptopID, username) {
+		delete(quarantine.ratings, other.ID)
+	}
+	quarantine.ratings[rating.ID] = rating
+
+	other := *rating
+	return &other, nil
+}
+
+func (quarantine *RatingQuarantine) Find(id string) *QuarantinedRating {
+	quarantine.mutex.RLock()
+	defer quarantine.mutex.RUnlock()
+
+	rating := quarantine.ratings[id]
+	if rating == nil {
+		return nil
+	}
+	other := *rating
+	return &other
+}
+
+// List returns the quarantined ratings of the laptop, of every laptop if laptopID is empty, the oldest first.
+func (quarantine *RatingQuarantine) List(laptopID string) []*QuarantinedRating {
+	quarantine.mutex.RLock()
+	defer quarantine.mutex.RUnlock()
+
+	var ratings []*QuarantinedRating
+	for _, rating := range quarantine.ratings {
+		if laptopID == "" || rating.LaptopID == laptopID {
+			other := *rating
+			ratings = append(ratings, &other)
+		}
+	}
+	sort.Slice(ratings, func(i, j int) bool {
+		if !ratings[i].RatedAt.Equal(ratings[j].RatedAt) {
+			return ratings[i].RatedAt.Before(ratings[j].RatedAt)
+		}
+		return ratings[i].ID < ratings[j].ID
+	})
+	return ratings
+}
+
+func (quarantine *RatingQuarantine) Remove(id string) error {
+	quarantine.mutex.Lock()
+	defer quarantine.mutex.Unlock()
+
+	rating := quarantine.ratings[id]
+	if rating == nil {
+		return ErrNotFound
+	}
+	return quarantine.release(rating)
+}
+
+// RemoveBy releases the rating of the user for the laptop, which a new rating supersedes.
+func (quarantine *RatingQuarantine) RemoveBy(laptopID string, username string) error {
+	quarantine.mutex.Lock()
+	defer quarantine.mutex.Unlock()
+
+	return quarantine.release(quarantine.ratingsOf(laptopID, username)...)
+}
+
+func (quarantine *RatingQuarantine) DeleteLaptop(laptopID string) error {
+	quarantine.mutex.Lock()
+	defer quarantine.mutex.Unlock()
+
+	var ratings []*QuarantinedRating
+	for _, rating := range quarantine.ratings {
+		if rating.LaptopID == laptopID {
+			ratings = append(ratings, rating)
+		}
+	}
+	return quarantine.release(ratings...)
+}
+
+func (quarantine *RatingQuarantine) ratingsOf(laptopID string, username string) []*QuarantinedRating {
+	var ratings []*QuarantinedRating
+	for _, rating := range quarantine.ratings {
+		if rating.LaptopID == laptopID && rating.Username == username {
+			ratings = append(ratings, rating)
+		}
+	}
+	return ratings
+}
+
+func (quarantine *RatingQuarantine) release(ratings ...*QuarantinedRating) error {
+	if len(ratings) == 0 {
+		return nil
+	}
+	if quarantine.log != nil {
+		err := quarantine.log.Release(ratings...)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, rating := range ratings {
+		delete(quarantine.ratings, rating.ID)
+	}
+	return nil
+}
+
+func quarantinedRatingToPB(rating *QuarantinedRating) *pb.QuarantinedRating {
+	return &pb.QuarantinedRating{
+		Id:       rating.ID,
+		LaptopId: rating.LaptopID,
+		Username: rating.Username,
+		Score:    rating.Score,
+		RatedAt:  timestamppb.New(rating.RatedAt),
+		Reason:   rating.Reason,
+	}
+}
+
+func (server *LaptopServer) ListQuarantinedRatings(ctx context.Context, req *pb.ListQuarantinedRatingsRequest) (*pb.ListQuarantinedRatingsResponse, error) {
+	log.Printf("receive a list-quarantined-ratings request for laptop %q", req.GetLaptopId())
+
+	catalog, err := server.catalog(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &pb.ListQuarantinedRatingsResponse{}
+	for _, rating := range catalog.quarantine.List(req.GetLaptopId()) {
+		res.Ratings = append(res.Ratings, quarantinedRatingToPB(rating))
+	}
+	return res, nil
+}
+
+// ApproveQuarantinedRating adds the rating to the aggregates, unless the user rated the laptop again since.
+func (server *LaptopServer) ApproveQuarantinedRating(ctx context.Context, req *pb.ApproveQuarantinedRatingRequest) (*pb.ApproveQuarantinedRatingResponse, error) {
+	id := req.GetId()
+	log.Printf("receive an approve-quarantined-rating request with id: %s", id)
+
+	catalog, err := server.catalog(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	quarantined := catalog.quarantine.Find(id)
+	if quarantined == nil {
+		return nil, errorLog(status.Errorf(codes.NotFound, "quarantined rating %s is not found", id))
+	}
+
+	var rating *Rating
+	err = catalog.uow.Do(quarantined.LaptopID, func(tx *Tx) error {
+		// the rating may have been released in the meantime
+		quarantined = catalog.quarantine.Find(id)
+		if quarantined == nil {
+			return status.Errorf(codes.NotFound, "quarantined rating %s is not found", id)
+		}
+
+		// the score weighs as of when it was given in the decayed average
+		rating, _, err = tx.AddRating(quarantined.LaptopID, quarantined.Username, quarantined.Score, quarantined.RatedAt)
+		if err != nil {
+			return status.Errorf(codes.Internal, "cannot add rating to the store: %v", err)
+		}
+
+		err = catalog.quarantine.Remove(id)
+		if err != nil {
+			return status.Errorf(codes.Internal, "cannot release quarantined rating: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errorLog(err)
+	}
+
+	return &pb.ApproveQuarantinedRatingResponse{
+		Rating: ratingSummaryToPB(quarantined.LaptopID, rating, server.ratingPrior()),
+	}, nil
+}
+
+func (server *LaptopServer) RejectQuarantinedRating(ctx context.Context, req *pb.RejectQuarantinedRatingRequest) (*pb.RejectQuarantinedRatingResponse, error) {
+	id := req.GetId()
+	log.Printf("receive a reject-quarantined-rating request with id: %s", id)
+
+	catalog, err := server.catalog(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = catalog.quarantine.Remove(id)
+	if errors.Is(err, ErrNotFound) {
+		return nil, errorLog(status.Errorf(codes.NotFound, "quarantined rating %s is not found", id))
+	}
+	if err != nil {
+		return nil, errorLog(status.Errorf(codes.Internal, "cannot reject quarantined rating: %v", err))
+	}
+	return &pb.RejectQuarantinedRatingResponse{}, nil
+}
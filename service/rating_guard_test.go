@@ -0,0 +1,213 @@
+package service_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Dostonlv/pcbook/pb"
+	"github.com/Dostonlv/pcbook/sample"
+	"github.com/Dostonlv/pcbook/service"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestRatingGuard(t *testing.T) {
+	t.Parallel()
+
+	guard := service.NewRatingGuard(service.RatingLimits{
+		MaxPerUser:    2,
+		Window:        time.Hour,
+		BurstSize:     3,
+		BurstWindow:   10 * time.Minute,
+		NewAccountAge: 24 * time.Hour,
+	})
+	now := time.Now()
+
+	require.True(t, guard.Allow("tenant1", "alice", now))
+	require.True(t, guard.Allow("tenant1", "alice", now.Add(time.Minute)))
+	require.False(t, guard.Allow("tenant1", "alice", now.Add(2*time.Minute)))
+	require.True(t, guard.Allow("tenant2", "alice", now.Add(2*time.Minute)))
+	require.True(t, guard.Allow("tenant1", "alice", now.Add(time.Hour+time.Second)))
+
+	newAccount := now.Add(-time.Hour)
+	require.False(t, guard.Suspicious("tenant1", "laptop1", time.Time{}, now))
+	require.False(t, guard.Suspicious("tenant1", "laptop1", now.Add(-48*time.Hour), now))
+	require.False(t, guard.Suspicious("tenant1", "laptop1", newAccount, now))
+	require.False(t, guard.Suspicious("tenant1", "laptop1", newAccount, now.Add(time.Minute)))
+	require.False(t, guard.Suspicious("tenant1", "laptop2", newAccount, now.Add(time.Minute)))
+	require.True(t, guard.Suspicious("tenant1", "laptop1", newAccount, now.Add(2*time.Minute)))
+
+	// the first ratings are out of the burst window
+	require.False(t, guard.Suspicious("tenant1", "laptop1", newAccount, now.Add(11*time.Minute)))
+}
+
+func TestClientRatingLimit(t *testing.T) {
+	t.Parallel()
+
+	laptopStore := service.NewInMemoryLaptopStore()
+	laptop := sample.NewLaptop()
+	require.NoError(t, laptopStore.Save(laptop))
+
+	laptopServer := service.NewLaptopServer(laptopStore, nil, service.NewInMemoryRatingStore(), service.WithRatingLimits(service.RatingLimits{
+		MaxPerUser: 3,
+		Window:     time.Hour,
+	}))
+	jwtManager := service.NewJWTManager("secret", time.Minute)
+	laptopClient := newTestUserClient(t, startTestAuthLaptopServer(t, laptopServer, jwtManager), jwtManager, "alice")
+
+	stream, err := laptopClient.RateLaptop(context.Background())
+	require.NoError(t, err)
+
+	// the rejected requests don't count against the limit
+	for _, req := range []*pb.RateLaptopRequest{
+		{LaptopId: "unknown", Score: 8},
+		{LaptopId: laptop.GetId(), Score: 100},
+		{LaptopId: "unknown", Score: 8},
+	} {
+		require.NoError(t, stream.Send(req))
+		res, err := stream.Recv()
+		require.NoError(t, err)
+		require.NotZero(t, res.GetStatus().GetCode())
+		require.NotEqual(t, uint32(codes.ResourceExhausted), res.GetStatus().GetCode())
+	}
+
+	for i, score := range []float64{8, 7, 9, 10} {
+		require.NoError(t, stream.Send(&pb.RateLaptopRequest{LaptopId: laptop.GetId(), Score: score}))
+		res, err := stream.Recv()
+		require.NoError(t, err)
+		if i < 3 {
+			require.Zero(t, res.GetStatus().GetCode())
+			require.Equal(t, score, res.GetAverageScore())
+		} else {
+			require.Equal(t, uint32(codes.ResourceExhausted), res.GetStatus().GetCode())
+		}
+	}
+	require.NoError(t, stream.CloseSend())
+}
+
+func TestClientRatingQuarantine(t *testing.T) {
+	t.Parallel()
+
+	laptopStore := service.NewInMemoryLaptopStore()
+	laptop := sample.NewLaptop()
+	require.NoError(t, laptopStore.Save(laptop))
+
+	laptopServer := service.NewLaptopServer(laptopStore, nil, service.NewInMemoryRatingStore(), service.WithRatingLimits(service.RatingLimits{
+		BurstSize:     3,
+		BurstWindow:   time.Minute,
+		NewAccountAge: time.Hour,
+	}))
+	jwtManager := service.NewJWTManager("secret", time.Minute)
+	serverAddress := startTestAuthLaptopServer(t, laptopServer, jwtManager)
+	admin := newTestUserClient(t, serverAddress, jwtManager, "admin1")
+
+	rate := func(username string, score float64) *pb.RateLaptopResponse {
+		stream, err := newTestUserClient(t, serverAddress, jwtManager, username).RateLaptop(context.Background())
+		require.NoError(t, err)
+		require.NoError(t, stream.Send(&pb.RateLaptopRequest{LaptopId: laptop.GetId(), Score: score}))
+		res, err := stream.Recv()
+		require.NoError(t, err)
+		require.Zero(t, res.GetStatus().GetCode())
+		require.NoError(t, stream.CloseSend())
+		return res
+	}
+
+	require.False(t, rate("user1", 8).GetQuarantined())
+	require.False(t, rate("user2", 6).GetQuarantined())
+	for _, username := range []string{"user3", "user4"} {
+		res := rate(username, 1)
+		require.True(t, res.GetQuarantined())
+		require.Equal(t, uint32(2), res.GetRatedCount())
+		require.Equal(t, 7.0, res.GetAverageScore())
+	}
+
+	listRes, err := admin.ListQuarantinedRatings(context.Background(), &pb.ListQuarantinedRatingsRequest{LaptopId: laptop.GetId()})
+	require.NoError(t, err)
+	ratings := listRes.GetRatings()
+	require.Len(t, ratings, 2)
+	require.Equal(t, "user3", ratings[0].GetUsername())
+	require.Equal(t, 1.0, ratings[0].GetScore())
+	require.NotEmpty(t, ratings[0].GetReason())
+
+	approveRes, err := admin.ApproveQuarantinedRating(context.Background(), &pb.ApproveQuarantinedRatingRequest{Id: ratings[0].GetId()})
+	require.NoError(t, err)
+	require.Equal(t, uint32(3), approveRes.GetRating().GetRatedCount())
+	require.Equal(t, 5.0, approveRes.GetRating().GetAverageScore())
+
+	_, err = admin.RejectQuarantinedRating(context.Background(), &pb.RejectQuarantinedRatingRequest{Id: ratings[1].GetId()})
+	require.NoError(t, err)
+
+	_, err = admin.RejectQuarantinedRating(context.Background(), &pb.RejectQuarantinedRatingRequest{Id: ratings[1].GetId()})
+	require.Equal(t, codes.NotFound, status.Code(err))
+	_, err = admin.ApproveQuarantinedRating(context.Background(), &pb.ApproveQuarantinedRatingRequest{Id: ratings[0].GetId()})
+	require.Equal(t, codes.NotFound, status.Code(err))
+
+	listRes, err = admin.ListQuarantinedRatings(context.Background(), &pb.ListQuarantinedRatingsRequest{})
+	require.NoError(t, err)
+	require.Empty(t, listRes.GetRatings())
+
+	summaryRes, err := admin.GetRatingSummary(context.Background(), &pb.GetRatingSummaryRequest{LaptopIds: []string{laptop.GetId()}})
+	require.NoError(t, err)
+	require.Equal(t, uint32(3), summaryRes.GetSummaries()[0].GetRatedCount())
+}
+
+func TestClientRatingQuarantineSurvivesRestart(t *testing.T) {
+	t.Parallel()
+
+	laptopStore := service.NewInMemoryLaptopStore()
+	laptop := sample.NewLaptop()
+	require.NoError(t, laptopStore.Save(laptop))
+
+	filename := filepath.Join(t.TempDir(), "ratings.jsonl")
+	jwtManager := service.NewJWTManager("secret", time.Minute)
+	startServer := func() string {
+		ratingStore, err := service.NewFileRatingStore(filename)
+		require.NoError(t, err)
+		t.Cleanup(func() { ratingStore.Close() })
+
+		laptopServer := service.NewLaptopServer(laptopStore, nil, ratingStore, service.WithRatingLimits(service.RatingLimits{
+			BurstSize:     1,
+			BurstWindow:   time.Minute,
+			NewAccountAge: time.Hour,
+		}))
+		return startTestAuthLaptopServer(t, laptopServer, jwtManager)
+	}
+
+	serverAddress := startServer()
+	for _, username := range []string{"user1", "user2"} {
+		stream, err := newTestUserClient(t, serverAddress, jwtManager, username).RateLaptop(context.Background())
+		require.NoError(t, err)
+		require.NoError(t, stream.Send(&pb.RateLaptopRequest{LaptopId: laptop.GetId(), Score: 2}))
+		res, err := stream.Recv()
+		require.NoError(t, err)
+		require.True(t, res.GetQuarantined())
+		require.NoError(t, stream.CloseSend())
+	}
+
+	// the quarantined ratings are logged along with the scores
+	serverAddress = startServer()
+	admin := newTestUserClient(t, serverAddress, jwtManager, "admin1")
+	listRes, err := admin.ListQuarantinedRatings(context.Background(), &pb.ListQuarantinedRatingsRequest{})
+	require.NoError(t, err)
+	ratings := listRes.GetRatings()
+	require.Len(t, ratings, 2)
+
+	_, err = admin.ApproveQuarantinedRating(context.Background(), &pb.ApproveQuarantinedRatingRequest{Id: ratings[0].GetId()})
+	require.NoError(t, err)
+	_, err = admin.RejectQuarantinedRating(context.Background(), &pb.RejectQuarantinedRatingRequest{Id: ratings[1].GetId()})
+	require.NoError(t, err)
+
+	ratingStore, err := service.NewFileRatingStore(filename)
+	require.NoError(t, err)
+	defer ratingStore.Close()
+	require.Empty(t, ratingStore.QuarantinedRatings())
+
+	// the approved score keeps the time it was given
+	rating, err := ratingStore.Find(laptop.GetId())
+	require.NoError(t, err)
+	require.Equal(t, uint32(1), rating.Count)
+	require.True(t, ratings[0].GetRatedAt().AsTime().Equal(rating.RatedAt[ratings[0].GetUsername()]))
+}
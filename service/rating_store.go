@@ -1,43 +1,256 @@
 package service
 
-import "sync"
+import (
+	"sync"
+	"time"
+)
 
+// RatingStore keeps the score every user gave to a laptop along with their aggregate.
+// Add records the score the user gave at the time, and RemoveScore forgets it, deleting the rating
+// of the laptop if nobody else rated it. Both return the rating without the scores of the users,
+// which is nil if nobody rated the laptop, like FindAggregates and Find return.
 type RatingStore interface {
-	Add(laptopID string, score float64) (*Rating, error)
+	Add(laptopID string, username string, score float64, ratedAt time.Time) (*Rating, bool, error)
+	Find(laptopID string) (*Rating, error)
+	FindAggregates(laptopID string) (*RatingAggregates, error)
+	FindScore(laptopID string, username string) (*UserScore, error)
+	RemoveScore(laptopID string, username string) (*Rating, error)
+	Save(laptopID string, rating *Rating) error
+	Delete(laptopID string) error
 }
 
+// UserScore is the score a user gave to a laptop and when they gave it.
+type UserScore struct {
+	Score   float64
+	RatedAt time.Time
+}
+
+// Rating aggregates the scores of a laptop, which are kept by username along with when they were given.
+// Histogram counts the users who gave each score. The decayed sums weigh the scores as of DecayedAt,
+// see DecayedAverage.
 type Rating struct {
-	Count uint32
-	Sum   float64
+	Count         uint32
+	Sum           float64
+	Scores        map[string]float64
+	RatedAt       map[string]time.Time
+	Histogram     map[float64]uint32
+	HalfLife      time.Duration
+	DecayedSum    float64
+	DecayedWeight float64
+	DecayedAt     time.Time
+	// removals counts the scores taken out of the decayed sums since they were last computed again.
+	removals uint32
+}
+
+// RatingAggregates are the aggregates of the scores of a laptop, without the scores themselves.
+type RatingAggregates struct {
+	Count         uint32
+	Sum           float64
+	DecayedSum    float64
+	DecayedWeight float64
+}
+
+func newRating(halfLife time.Duration) *Rating {
+	return &Rating{
+		Scores:    make(map[string]float64),
+		RatedAt:   make(map[string]time.Time),
+		Histogram: make(map[float64]uint32),
+		HalfLife:  halfLife,
+	}
+}
+
+// set records the score the user gave at the time and reports whether it replaced a previous one.
+func (rating *Rating) set(username string, score float64, ratedAt time.Time) bool {
+	updated := rating.remove(username)
+	rating.Count++
+	rating.Sum += score
+	rating.Scores[username] = score
+	rating.RatedAt[username] = ratedAt
+	rating.Histogram[score]++
+	rating.addDecayed(score, ratedAt)
+	return updated
+}
+
+// remove forgets the score of the user and reports whether there was one.
+func (rating *Rating) remove(username string) bool {
+	previous, ok := rating.Scores[username]
+	if !ok {
+		return false
+	}
+
+	ratedAt := rating.RatedAt[username]
+	rating.Count--
+	rating.Sum -= previous
+	delete(rating.Scores, username)
+	delete(rating.RatedAt, username)
+	rating.Histogram[previous]--
+	if rating.Histogram[previous] == 0 {
+		delete(rating.Histogram, previous)
+	}
+	rating.removeDecayed(previous, ratedAt)
+	return true
+}
+
+// scoreOf returns the score of the user, the rating may be nil.
+func (rating *Rating) scoreOf(username string) (float64, bool) {
+	if rating == nil {
+		return 0, false
+	}
+	score, ok := rating.Scores[username]
+	return score, ok
+}
+
+// userScore returns the score of the user, or nil if they didn't rate the laptop. The rating may be nil.
+func (rating *Rating) userScore(username string) *UserScore {
+	score, ok := rating.scoreOf(username)
+	if !ok {
+		return nil
+	}
+	return &UserScore{Score: score, RatedAt: rating.RatedAt[username]}
+}
+
+// summary copies the rating without the scores of the users. The rating may be nil.
+func (rating *Rating) summary() *Rating {
+	if rating == nil {
+		return nil
+	}
+
+	other := *rating
+	other.Scores = nil
+	other.RatedAt = nil
+	other.Histogram = make(map[float64]uint32, len(rating.Histogram))
+	for score, count := range rating.Histogram {
+		other.Histogram[score] = count
+	}
+	return &other
+}
+
+func (rating *Rating) Aggregates() *RatingAggregates {
+	return &RatingAggregates{
+		Count:         rating.Count,
+		Sum:           rating.Sum,
+		DecayedSum:    rating.DecayedSum,
+		DecayedWeight: rating.DecayedWeight,
+	}
+}
+
+func (rating *Rating) Average() float64 {
+	return rating.Aggregates().Average()
+}
+
+func (aggregates *RatingAggregates) Average() float64 {
+	if aggregates.Count == 0 {
+		return 0
+	}
+	return aggregates.Sum / float64(aggregates.Count)
 }
 
 type InMemoryRatingScore struct {
 	mutex  sync.RWMutex
+	config ratingConfig
 	rating map[string]*Rating
 }
 
-func NewInMemoryRatingStore() *InMemoryRatingScore {
+func NewInMemoryRatingStore(opts ...RatingStoreOption) *InMemoryRatingScore {
 	return &InMemoryRatingScore{
+		config: newRatingConfig(opts),
 		rating: make(map[string]*Rating),
 	}
 }
 
-func (store *InMemoryRatingScore) Add(laptopID string, score float64) (*Rating, error) {
+// Add records the score of the user for the laptop. A user has a single score per laptop,
+// rating it again replaces the previous score, in which case Add reports that the rating is updated.
+func (store *InMemoryRatingScore) Add(laptopID string, username string, score float64, ratedAt time.Time) (*Rating, bool, error) {
 	store.mutex.Lock()
 	defer store.mutex.Unlock()
 
 	rating := store.rating[laptopID]
+	if rating == nil {
+		rating = newRating(store.config.halfLife)
+		store.rating[laptopID] = rating
+	}
 
+	updated := rating.set(username, score, ratedAt)
+	return rating.summary(), updated, nil
+}
+
+func (store *InMemoryRatingScore) Find(laptopID string) (*Rating, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	rating := store.rating[laptopID]
+	if rating == nil {
+		return nil, nil
+	}
+	return rating.Clone(), nil
+}
+
+func (store *InMemoryRatingScore) FindAggregates(laptopID string) (*RatingAggregates, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	rating := store.rating[laptopID]
 	if rating == nil {
-		rating = &Rating{
-			Count: 1,
-			Sum:   score,
-		}
-	} else {
-		rating.Count++
-		rating.Sum += score
+		return nil, nil
+	}
+	return rating.Aggregates(), nil
+}
+
+func (store *InMemoryRatingScore) FindScore(laptopID string, username string) (*UserScore, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	return store.rating[laptopID].userScore(username), nil
+}
+
+func (store *InMemoryRatingScore) RemoveScore(laptopID string, username string) (*Rating, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	rating := store.rating[laptopID]
+	if rating == nil || !rating.remove(username) {
+		return rating.summary(), nil
+	}
+	if rating.Count == 0 {
+		delete(store.rating, laptopID)
+		return nil, nil
+	}
+	return rating.summary(), nil
+}
+
+// Save replaces the rating of the laptop, it's used to restore a previous state.
+func (store *InMemoryRatingScore) Save(laptopID string, rating *Rating) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	store.rating[laptopID] = rating.Clone()
+	return nil
+}
+
+func (store *InMemoryRatingScore) Delete(laptopID string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if store.rating[laptopID] == nil {
+		return ErrNotFound
 	}
-	store.rating[laptopID] = rating
-	return rating, nil
+	delete(store.rating, laptopID)
+	return nil
+}
 
+func (rating *Rating) Clone() *Rating {
+	other := *rating
+	other.Scores = make(map[string]float64, len(rating.Scores))
+	for username, score := range rating.Scores {
+		other.Scores[username] = score
+	}
+	other.RatedAt = make(map[string]time.Time, len(rating.RatedAt))
+	for username, ratedAt := range rating.RatedAt {
+		other.RatedAt[username] = ratedAt
+	}
+	other.Histogram = make(map[float64]uint32, len(rating.Histogram))
+	for score, count := range rating.Histogram {
+		other.Histogram[score] = count
+	}
+	return &other
 }
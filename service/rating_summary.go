@@ -0,0 +1,130 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+
+	"github.com/Dostonlv/pcbook/pb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// DefaultRatingPriorWeight counts the prior as that many ratings.
+	DefaultRatingPriorWeight = 10
+
+	maxRatingSummaryLaptops = 100
+)
+
+// RatingPrior is the belief about a laptop before it's rated. The Bayesian average of a laptop
+// starts at Mean and moves to the mean of its scores as their count outweighs Weight,
+// so that a laptop with a single high score doesn't outrank one with many good scores.
+type RatingPrior struct {
+	Mean   float64
+	Weight float64
+}
+
+// NewRatingPrior checks that the mean is finite and the weight isn't negative.
+func NewRatingPrior(mean float64, weight float64) (RatingPrior, error) {
+	prior := RatingPrior{Mean: mean, Weight: weight}
+	if math.IsNaN(mean) || math.IsInf(mean, 0) {
+		return prior, fmt.Errorf("prior mean %g is not a number", mean)
+	}
+	if math.IsNaN(weight) || math.IsInf(weight, 0) || weight < 0 {
+		return prior, fmt.Errorf("prior weight %g must be a positive number", weight)
+	}
+	return prior, nil
+}
+
+// BayesianAverage is the average of the scores along with the prior counted as Weight scores of Mean.
+func (rating *Rating) BayesianAverage(prior RatingPrior) float64 {
+	return rating.Aggregates().BayesianAverage(prior)
+}
+
+func (aggregates *RatingAggregates) BayesianAverage(prior RatingPrior) float64 {
+	weight := prior.Weight + float64(aggregates.Count)
+	if weight == 0 {
+		return prior.Mean
+	}
+	return (prior.Weight*prior.Mean + aggregates.Sum) / weight
+}
+
+// ratingPrior is the configured prior, by default the middle of the score range.
+func (server *LaptopServer) ratingPrior() RatingPrior {
+	if server.prior != nil {
+		return *server.prior
+	}
+	return RatingPrior{
+		Mean:   (server.scoreRange.Min + server.scoreRange.Max) / 2,
+		Weight: DefaultRatingPriorWeight,
+	}
+}
+
+func ratingSummaryToPB(laptopID string, rating *Rating, prior RatingPrior) *pb.RatingSummary {
+	if rating == nil {
+		return ratingAggregatesToPB(laptopID, nil, nil, prior)
+	}
+	return ratingAggregatesToPB(laptopID, rating.Aggregates(), rating.Histogram, prior)
+}
+
+func ratingAggregatesToPB(laptopID string, aggregates *RatingAggregates, histogram map[float64]uint32, prior RatingPrior) *pb.RatingSummary {
+	if aggregates == nil {
+		aggregates = &RatingAggregates{}
+	}
+
+	summary := &pb.RatingSummary{
+		LaptopId:        laptopID,
+		RatedCount:      aggregates.Count,
+		AverageScore:    aggregates.Average(),
+		BayesianAverage: aggregates.BayesianAverage(prior),
+		DecayedAverage:  aggregates.DecayedAverage(),
+	}
+	for score, count := range histogram {
+		summary.Histogram = append(summary.Histogram, &pb.ScoreCount{Score: score, Count: count})
+	}
+	sort.Slice(summary.Histogram, func(i, j int) bool {
+		return summary.Histogram[i].Score < summary.Histogram[j].Score
+	})
+	return summary
+}
+
+func (server *LaptopServer) GetRatingSummary(ctx context.Context, req *pb.GetRatingSummaryRequest) (*pb.GetRatingSummaryResponse, error) {
+	laptopIDs := req.GetLaptopIds()
+	log.Printf("receive a get-rating-summary request for %d laptops", len(laptopIDs))
+
+	if len(laptopIDs) == 0 {
+		return nil, errorLog(status.Error(codes.InvalidArgument, "laptop IDs are missing"))
+	}
+	if len(laptopIDs) > maxRatingSummaryLaptops {
+		return nil, errorLog(status.Errorf(codes.InvalidArgument, "cannot summarize more than %d laptops at once", maxRatingSummaryLaptops))
+	}
+
+	catalog, err := server.catalog(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	prior := server.ratingPrior()
+	res := &pb.GetRatingSummaryResponse{
+		Prior: &pb.RatingPrior{Mean: prior.Mean, Weight: prior.Weight},
+	}
+	for _, laptopID := range laptopIDs {
+		laptop, err := catalog.laptopStore.Find(laptopID)
+		if err != nil {
+			return nil, errorLog(status.Errorf(codes.Internal, "cannot find laptop: %v", err))
+		}
+		if laptop == nil {
+			return nil, errorLog(status.Errorf(codes.NotFound, "laptop %s is not found", laptopID))
+		}
+
+		rating, err := catalog.ratingStore.Find(laptopID)
+		if err != nil {
+			return nil, errorLog(status.Errorf(codes.Internal, "cannot find rating: %v", err))
+		}
+		res.Summaries = append(res.Summaries, ratingSummaryToPB(laptopID, rating, prior))
+	}
+	return res, nil
+}
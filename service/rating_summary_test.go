@@ -0,0 +1,225 @@
+package service_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Dostonlv/pcbook/pb"
+	"github.com/Dostonlv/pcbook/sample"
+	"github.com/Dostonlv/pcbook/service"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestClientGetRatingSummary(t *testing.T) {
+	t.Parallel()
+
+	laptopStore := service.NewInMemoryLaptopStore()
+	ratingStore := service.NewInMemoryRatingStore()
+
+	popular := sample.NewLaptop()
+	single := sample.NewLaptop()
+	unrated := sample.NewLaptop()
+	for _, laptop := range []*pb.Laptop{popular, single, unrated} {
+		require.NoError(t, laptopStore.Save(laptop))
+	}
+
+	// 500 ratings averaging 9.4
+	for i := 0; i < 500; i++ {
+		score := 9.5
+		if i < 100 {
+			score = 9
+		}
+		_, _, err := ratingStore.Add(popular.GetId(), fmt.Sprintf("user%d", i), score, time.Now())
+		require.NoError(t, err)
+	}
+	_, _, err := ratingStore.Add(single.GetId(), "alice", 3, time.Now())
+	require.NoError(t, err)
+	_, updated, err := ratingStore.Add(single.GetId(), "alice", 10, time.Now())
+	require.NoError(t, err)
+	require.True(t, updated)
+
+	laptopServer := service.NewLaptopServer(
+		laptopStore, nil, ratingStore,
+		service.WithRatingPrior(service.RatingPrior{Mean: 5, Weight: 10}),
+	)
+	laptopClient := newTestLaptopClient(t, startTestLaptopServerWith(t, laptopServer))
+
+	res, err := laptopClient.GetRatingSummary(context.Background(), &pb.GetRatingSummaryRequest{
+		LaptopIds: []string{single.GetId(), popular.GetId(), unrated.GetId()},
+	})
+	require.NoError(t, err)
+	require.Equal(t, 5.0, res.GetPrior().GetMean())
+	require.Equal(t, 10.0, res.GetPrior().GetWeight())
+	require.Len(t, res.GetSummaries(), 3)
+
+	singleSummary := res.GetSummaries()[0]
+	require.Equal(t, single.GetId(), singleSummary.GetLaptopId())
+	require.Equal(t, uint32(1), singleSummary.GetRatedCount())
+	require.Equal(t, 10.0, singleSummary.GetAverageScore())
+	require.InDelta(t, 60.0/11, singleSummary.GetBayesianAverage(), 1e-9)
+	require.Len(t, singleSummary.GetHistogram(), 1)
+	require.Equal(t, 10.0, singleSummary.GetHistogram()[0].GetScore())
+	require.Equal(t, uint32(1), singleSummary.GetHistogram()[0].GetCount())
+
+	popularSummary := res.GetSummaries()[1]
+	require.Equal(t, uint32(500), popularSummary.GetRatedCount())
+	require.InDelta(t, 9.4, popularSummary.GetAverageScore(), 1e-9)
+	require.InDelta(t, (50+4700)/510.0, popularSummary.GetBayesianAverage(), 1e-9)
+	require.Greater(t, popularSummary.GetBayesianAverage(), singleSummary.GetBayesianAverage())
+	require.Len(t, popularSummary.GetHistogram(), 2)
+	require.Equal(t, 9.0, popularSummary.GetHistogram()[0].GetScore())
+	require.Equal(t, uint32(100), popularSummary.GetHistogram()[0].GetCount())
+	require.Equal(t, 9.5, popularSummary.GetHistogram()[1].GetScore())
+	require.Equal(t, uint32(400), popularSummary.GetHistogram()[1].GetCount())
+
+	unratedSummary := res.GetSummaries()[2]
+	require.Zero(t, unratedSummary.GetRatedCount())
+	require.Empty(t, unratedSummary.GetHistogram())
+	require.Equal(t, 5.0, unratedSummary.GetBayesianAverage())
+
+	_, err = laptopClient.GetRatingSummary(context.Background(), &pb.GetRatingSummaryRequest{
+		LaptopIds: []string{popular.GetId(), "unknown"},
+	})
+	require.Equal(t, codes.NotFound, status.Code(err))
+
+	_, err = laptopClient.GetRatingSummary(context.Background(), &pb.GetRatingSummaryRequest{})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestDefaultRatingPrior(t *testing.T) {
+	t.Parallel()
+
+	laptopStore := service.NewInMemoryLaptopStore()
+	laptop := sample.NewLaptop()
+	require.NoError(t, laptopStore.Save(laptop))
+
+	laptopServer := service.NewLaptopServer(
+		laptopStore, nil, service.NewInMemoryRatingStore(),
+		service.WithScoreRange(service.ScoreRange{Min: 0, Max: 5, Step: 1}),
+	)
+	laptopClient := newTestLaptopClient(t, startTestLaptopServerWith(t, laptopServer))
+
+	res, err := laptopClient.GetRatingSummary(context.Background(), &pb.GetRatingSummaryRequest{
+		LaptopIds: []string{laptop.GetId()},
+	})
+	require.NoError(t, err)
+	require.Equal(t, 2.5, res.GetPrior().GetMean())
+	require.Equal(t, float64(service.DefaultRatingPriorWeight), res.GetPrior().GetWeight())
+	require.Equal(t, 2.5, res.GetSummaries()[0].GetBayesianAverage())
+
+	_, err = service.NewRatingPrior(5, -1)
+	require.Error(t, err)
+}
+
+func TestClientTopRatedLaptops(t *testing.T) {
+	t.Parallel()
+
+	laptopStore := service.NewShardedLaptopStore(service.DefaultShardCount)
+	ratingStore := service.NewInMemoryRatingStore()
+
+	newLaptop := func(price float64, scores ...float64) *pb.Laptop {
+		laptop := sample.NewLaptop()
+		laptop.PriceUsd = price
+		require.NoError(t, laptopStore.Save(laptop))
+		for i, score := range scores {
+			_, _, err := ratingStore.Add(laptop.GetId(), fmt.Sprintf("user%d", i), score, time.Now())
+			require.NoError(t, err)
+		}
+		return laptop
+	}
+
+	manyScores := make([]float64, 50)
+	for i := range manyScores {
+		manyScores[i] = 9
+	}
+	popular := newLaptop(1500, manyScores...)
+	single := newLaptop(1200, 10)
+	average := newLaptop(1800, 7, 8)
+	expensive := newLaptop(3000, 10, 10, 10)
+	newLaptop(1000)
+
+	laptopServer := service.NewLaptopServer(
+		laptopStore, nil, ratingStore,
+		service.WithRatingPrior(service.RatingPrior{Mean: 5, Weight: 10}),
+	)
+	laptopClient := newTestLaptopClient(t, startTestLaptopServerWith(t, laptopServer))
+
+	topRated := func(req *pb.TopRatedLaptopsRequest) []*pb.TopRatedLaptopsResponse {
+		stream, err := laptopClient.TopRatedLaptops(context.Background(), req)
+		require.NoError(t, err)
+
+		var responses []*pb.TopRatedLaptopsResponse
+		for {
+			res, err := stream.Recv()
+			if err == io.EOF {
+				return responses
+			}
+			require.NoError(t, err)
+			require.Equal(t, uint32(len(responses)+1), res.GetRank())
+			require.Equal(t, res.GetLaptop().GetId(), res.GetRating().GetLaptopId())
+			responses = append(responses, res)
+		}
+	}
+	laptopIDs := func(responses []*pb.TopRatedLaptopsResponse) []string {
+		var ids []string
+		for _, res := range responses {
+			ids = append(ids, res.GetLaptop().GetId())
+		}
+		return ids
+	}
+
+	underBudget := &pb.Filter{MaxPriceUsd: 2000, SortBy: pb.Filter_PRICE}
+
+	// the Bayesian average doesn't let a single 10 outrank 50 ratings of 9
+	responses := topRated(&pb.TopRatedLaptopsRequest{Filter: underBudget})
+	require.Equal(t, []string{popular.GetId(), single.GetId(), average.GetId()}, laptopIDs(responses))
+	require.Equal(t, uint32(50), responses[0].GetRating().GetRatedCount())
+	require.Equal(t, 9.0, responses[0].GetRating().GetAverageScore())
+	require.InDelta(t, 500.0/60, responses[0].GetRating().GetBayesianAverage(), 1e-9)
+
+	responses = topRated(&pb.TopRatedLaptopsRequest{Filter: underBudget, RankBy: pb.TopRatedLaptopsRequest_AVERAGE})
+	require.Equal(t, []string{single.GetId(), popular.GetId(), average.GetId()}, laptopIDs(responses))
+
+	responses = topRated(&pb.TopRatedLaptopsRequest{Filter: underBudget, MinRatingCount: 2, Limit: 1})
+	require.Equal(t, []string{popular.GetId()}, laptopIDs(responses))
+
+	responses = topRated(&pb.TopRatedLaptopsRequest{RankBy: pb.TopRatedLaptopsRequest_AVERAGE})
+	require.Equal(t, []string{expensive.GetId(), single.GetId(), popular.GetId(), average.GetId()}, laptopIDs(responses))
+
+	stream, err := laptopClient.TopRatedLaptops(context.Background(), &pb.TopRatedLaptopsRequest{Limit: 1000})
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestRatingStoreFindAggregates(t *testing.T) {
+	t.Parallel()
+
+	fileStore, err := service.NewFileRatingStore(filepath.Join(t.TempDir(), "ratings.jsonl"))
+	require.NoError(t, err)
+	defer fileStore.Close()
+
+	for _, store := range []service.RatingStore{service.NewInMemoryRatingStore(), fileStore} {
+		aggregates, err := store.FindAggregates("laptop")
+		require.NoError(t, err)
+		require.Nil(t, aggregates)
+
+		_, _, err = store.Add("laptop", "alice", 8, time.Now())
+		require.NoError(t, err)
+		rating, _, err := store.Add("laptop", "bob", 4, time.Now())
+		require.NoError(t, err)
+
+		aggregates, err = store.FindAggregates("laptop")
+		require.NoError(t, err)
+		require.Equal(t, rating.Aggregates(), aggregates)
+		require.Equal(t, uint32(2), aggregates.Count)
+		require.Equal(t, 6.0, aggregates.Average())
+		require.Equal(t, rating.DecayedAverage(), aggregates.DecayedAverage())
+	}
+}
@@ -0,0 +1,286 @@
+package service
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/Dostonlv/pcbook/pb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// RatingUpdate is the rating of a laptop after a change, without the scores of the users.
+// Aggregates is nil once the ratings of the laptop are deleted.
+type RatingUpdate struct {
+	LaptopID   string
+	Aggregates *RatingAggregates
+	Histogram  map[float64]uint32
+}
+
+func newRatingUpdate(laptopID string, rating *Rating) *RatingUpdate {
+	update := &RatingUpdate{LaptopID: laptopID}
+	if rating == nil {
+		return update
+	}
+
+	update.Aggregates = rating.Aggregates()
+	update.Histogram = make(map[float64]uint32, len(rating.Histogram))
+	for score, count := range rating.Histogram {
+		update.Histogram[score] = count
+	}
+	return update
+}
+
+// RatingPublisher fans out the rating updates of a catalog to its subscribers. Publishing never waits
+// for a subscriber: each one keeps the latest update of every laptop until it receives it,
+// so a slow subscriber skips the intermediate updates instead of holding up the raters.
+type RatingPublisher struct {
+	mutex       sync.RWMutex
+	subscribers map[*RatingSubscription]struct{}
+}
+
+func NewRatingPublisher() *RatingPublisher {
+	return &RatingPublisher{
+		subscribers: make(map[*RatingSubscription]struct{}),
+	}
+}
+
+// Subscribe starts a subscription to the updates of the laptops, of every laptop if none is given.
+// It must be closed once it's no longer used.
+func (publisher *RatingPublisher) Subscribe(laptopIDs ...string) *RatingSubscription {
+	subscription := &RatingSubscription{
+		publisher: publisher,
+		pending:   make(map[string]*RatingUpdate),
+		ready:     make(chan struct{}, 1),
+	}
+	if len(laptopIDs) > 0 {
+		subscription.laptopIDs = make(map[string]bool, len(laptopIDs))
+		for _, laptopID := range laptopIDs {
+			subscription.laptopIDs[laptopID] = true
+		}
+	}
+
+	publisher.mutex.Lock()
+	defer publisher.mutex.Unlock()
+
+	publisher.subscribers[subscription] = struct{}{}
+	return subscription
+}
+
+// Publish hands the aggregates of the rating of the laptop to the subscribers watching it,
+// the rating is nil once it's deleted.
+func (publisher *RatingPublisher) Publish(laptopID string, rating *Rating) {
+	publisher.mutex.RLock()
+	defer publisher.mutex.RUnlock()
+
+	if len(publisher.subscribers) == 0 {
+		return
+	}
+
+	update := newRatingUpdate(laptopID, rating)
+	for subscription := range publisher.subscribers {
+		subscription.push(update)
+	}
+}
+
+func (publisher *RatingPublisher) unsubscribe(subscription *RatingSubscription) {
+	publisher.mutex.Lock()
+	defer publisher.mutex.Unlock()
+
+	delete(publisher.subscribers, subscription)
+}
+
+// RatingSubscription receives the rating updates of the watched laptops.
+type RatingSubscription struct {
+	publisher *RatingPublisher
+	laptopIDs map[string]bool
+
+	mutex   sync.Mutex
+	pending map[string]*RatingUpdate
+	order   []string
+	ready   chan struct{}
+}
+
+// push queues the update, which is shared by the subscriptions and must not be changed.
+func (subscription *RatingSubscription) push(update *RatingUpdate) {
+	laptopID := update.LaptopID
+	if subscription.laptopIDs != nil && !subscription.laptopIDs[laptopID] {
+		return
+	}
+
+	subscription.mutex.Lock()
+	if _, ok := subscription.pending[laptopID]; !ok {
+		subscription.order = append(subscription.order, laptopID)
+	}
+	subscription.pending[laptopID] = update
+	subscription.mutex.Unlock()
+
+	select {
+	case subscription.ready <- struct{}{}:
+	default:
+	}
+}
+
+// Next waits for the updates published since the previous call and returns the latest one of every laptop,
+// in the order the laptops were first updated. It fails once the context is done.
+func (subscription *RatingSubscription) Next(ctx context.Context) ([]*RatingUpdate, error) {
+	select {
+	case <-subscription.ready:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	subscription.mutex.Lock()
+	defer subscription.mutex.Unlock()
+
+	updates := make([]*RatingUpdate, 0, len(subscription.order))
+	for _, laptopID := range subscription.order {
+		updates = append(updates, subscription.pending[laptopID])
+	}
+	subscription.pending = make(map[string]*RatingUpdate)
+	subscription.order = nil
+	return updates, nil
+}
+
+func (subscription *RatingSubscription) Close() {
+	subscription.publisher.unsubscribe(subscription)
+}
+
+// PublishingRatingStore wraps another RatingStore to publish every change made through it.
+// The changes made to the wrapped store directly, such as a rebuild, aren't published.
+type PublishingRatingStore struct {
+	store     RatingStore
+	publisher *RatingPublisher
+}
+
+func NewPublishingRatingStore(store RatingStore, publisher *RatingPublisher) *PublishingRatingStore {
+	return &PublishingRatingStore{
+		store:     store,
+		publisher: publisher,
+	}
+}
+
+func (store *PublishingRatingStore) Add(laptopID string, username string, score float64, ratedAt time.Time) (*Rating, bool, error) {
+	rating, updated, err := store.store.Add(laptopID, username, score, ratedAt)
+	if err != nil {
+		return nil, false, err
+	}
+
+	store.publisher.Publish(laptopID, rating)
+	return rating, updated, nil
+}
+
+func (store *PublishingRatingStore) Find(laptopID string) (*Rating, error) {
+	return store.store.Find(laptopID)
+}
+
+func (store *PublishingRatingStore) FindAggregates(laptopID string) (*RatingAggregates, error) {
+	return store.store.FindAggregates(laptopID)
+}
+
+func (store *PublishingRatingStore) FindScore(laptopID string, username string) (*UserScore, error) {
+	return store.store.FindScore(laptopID, username)
+}
+
+func (store *PublishingRatingStore) RemoveScore(laptopID string, username string) (*Rating, error) {
+	rating, err := store.store.RemoveScore(laptopID, username)
+	if err != nil {
+		return nil, err
+	}
+
+	store.publisher.Publish(laptopID, rating)
+	return rating, nil
+}
+
+func (store *PublishingRatingStore) Save(laptopID string, rating *Rating) error {
+	err := store.store.Save(laptopID, rating)
+	if err != nil {
+		return err
+	}
+
+	store.publisher.Publish(laptopID, rating)
+	return nil
+}
+
+func (store *PublishingRatingStore) Delete(laptopID string) error {
+	err := store.store.Delete(laptopID)
+	if err != nil {
+		return err
+	}
+
+	store.publisher.Publish(laptopID, nil)
+	return nil
+}
+
+// WatchRatings streams the rating of the watched laptops every time it changes, until the client cancels.
+func (server *LaptopServer) WatchRatings(req *pb.WatchRatingsRequest, stream pb.LaptopService_WatchRatingsServer) error {
+	laptopIDs := req.GetLaptopIds()
+	filter := req.GetFilter()
+	log.Printf("receive a watch-ratings request for %d laptops with filter: %v", len(laptopIDs), filter)
+
+	if len(laptopIDs) > maxRatingSummaryLaptops {
+		return errorLog(status.Errorf(codes.InvalidArgument, "cannot watch more than %d laptops at once", maxRatingSummaryLaptops))
+	}
+
+	catalog, err := server.catalog(stream.Context())
+	if err != nil {
+		return err
+	}
+
+	subscription := catalog.ratingPublisher.Subscribe(laptopIDs...)
+	defer subscription.Close()
+
+	// the headers tell the client that the ratings changed from now on are sent
+	err = stream.SendHeader(metadata.MD{})
+	if err != nil {
+		return errorLog(status.Errorf(codes.Unknown, "cannot send header: %v", err))
+	}
+
+	// the laptops matching the filter whose rating was sent, the only ones whose deletion is sent
+	matched := make(map[string]bool)
+	for {
+		updates, err := subscription.Next(stream.Context())
+		if err != nil {
+			return contextError(stream.Context())
+		}
+
+		for _, update := range updates {
+			if filter != nil {
+				ok, err := server.watchesRating(catalog, filter, update, matched)
+				if err != nil {
+					return err
+				}
+				if !ok {
+					continue
+				}
+			}
+
+			err := stream.Send(&pb.WatchRatingsResponse{
+				Rating: ratingAggregatesToPB(update.LaptopID, update.Aggregates, update.Histogram, server.ratingPrior()),
+			})
+			if err != nil {
+				return errorLog(status.Errorf(codes.Unknown, "cannot send rating: %v", err))
+			}
+		}
+	}
+}
+
+// watchesRating reports whether the laptop of the update matches the filter, or matched it before its deletion.
+func (server *LaptopServer) watchesRating(catalog *Catalog, filter *pb.Filter, update *RatingUpdate, matched map[string]bool) (bool, error) {
+	laptop, err := catalog.laptopStore.Find(update.LaptopID)
+	if err != nil {
+		return false, errorLog(status.Errorf(codes.Internal, "cannot find laptop: %v", err))
+	}
+
+	if laptop == nil || update.Aggregates == nil {
+		ok := matched[update.LaptopID]
+		delete(matched, update.LaptopID)
+		return ok, nil
+	}
+
+	matched[update.LaptopID] = isQualified(filter, laptop)
+	return matched[update.LaptopID], nil
+}
@@ -0,0 +1,116 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Dostonlv/pcbook/pb"
+	"github.com/Dostonlv/pcbook/sample"
+	"github.com/Dostonlv/pcbook/service"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRatingPublisher(t *testing.T) {
+	t.Parallel()
+
+	publisher := service.NewRatingPublisher()
+	all := publisher.Subscribe()
+	defer all.Close()
+	laptop1 := publisher.Subscribe("laptop1")
+	defer laptop1.Close()
+
+	// nobody receives the updates, which must not block the publisher
+	for i := 1; i <= 1000; i++ {
+		publisher.Publish("laptop1", &service.Rating{Count: uint32(i)})
+		publisher.Publish("laptop2", &service.Rating{Count: uint32(i)})
+	}
+	publisher.Publish("laptop1", nil)
+
+	updates, err := all.Next(context.Background())
+	require.NoError(t, err)
+	require.Len(t, updates, 2)
+	require.Equal(t, "laptop1", updates[0].LaptopID)
+	require.Nil(t, updates[0].Aggregates)
+	require.Equal(t, "laptop2", updates[1].LaptopID)
+	require.Equal(t, uint32(1000), updates[1].Aggregates.Count)
+
+	updates, err = laptop1.Next(context.Background())
+	require.NoError(t, err)
+	require.Len(t, updates, 1)
+	require.Equal(t, "laptop1", updates[0].LaptopID)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = laptop1.Next(ctx)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// a closed subscription gets no more updates
+	all.Close()
+	publisher.Publish("laptop2", &service.Rating{Count: 1})
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = all.Next(ctx)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestClientWatchRatings(t *testing.T) {
+	t.Parallel()
+
+	laptopStore := service.NewInMemoryLaptopStore()
+	cheapLaptop := sample.NewLaptop()
+	cheapLaptop.PriceUsd = 1000
+	expensiveLaptop := sample.NewLaptop()
+	expensiveLaptop.PriceUsd = 3000
+	require.NoError(t, laptopStore.Save(cheapLaptop))
+	require.NoError(t, laptopStore.Save(expensiveLaptop))
+
+	laptopServer := service.NewLaptopServer(laptopStore, nil, service.NewInMemoryRatingStore())
+	jwtManager := service.NewJWTManager("secret", time.Minute)
+	serverAddress := startTestAuthLaptopServer(t, laptopServer, jwtManager)
+	alice := newTestUserClient(t, serverAddress, jwtManager, "alice")
+	bob := newTestUserClient(t, serverAddress, jwtManager, "bob")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	watch := func(req *pb.WatchRatingsRequest) pb.LaptopService_WatchRatingsClient {
+		stream, err := newTestUserClient(t, serverAddress, jwtManager, "display").WatchRatings(ctx, req)
+		require.NoError(t, err)
+		_, err = stream.Header()
+		require.NoError(t, err)
+		return stream
+	}
+	requireRating := func(stream pb.LaptopService_WatchRatingsClient, laptopID string, count uint32, average float64) {
+		res, err := stream.Recv()
+		require.NoError(t, err)
+		require.Equal(t, laptopID, res.GetRating().GetLaptopId())
+		require.Equal(t, count, res.GetRating().GetRatedCount())
+		require.Equal(t, average, res.GetRating().GetAverageScore())
+	}
+
+	byID := watch(&pb.WatchRatingsRequest{LaptopIds: []string{expensiveLaptop.GetId()}})
+	byFilter := watch(&pb.WatchRatingsRequest{Filter: &pb.Filter{MaxPriceUsd: 2000}})
+	everything := watch(&pb.WatchRatingsRequest{})
+
+	// every update is received before the next rating, which would replace it if it was still pending
+	rateTestLaptop(t, alice, cheapLaptop.GetId(), 8)
+	requireRating(byFilter, cheapLaptop.GetId(), 1, 8)
+	requireRating(everything, cheapLaptop.GetId(), 1, 8)
+
+	rateTestLaptop(t, alice, expensiveLaptop.GetId(), 6)
+	requireRating(byID, expensiveLaptop.GetId(), 1, 6)
+	requireRating(everything, expensiveLaptop.GetId(), 1, 6)
+
+	rateTestLaptop(t, bob, cheapLaptop.GetId(), 4)
+	requireRating(byFilter, cheapLaptop.GetId(), 2, 6)
+	requireRating(everything, cheapLaptop.GetId(), 2, 6)
+
+	_, err := alice.DeleteLaptop(context.Background(), &pb.DeleteLaptopRequest{Id: cheapLaptop.GetId()})
+	require.NoError(t, err)
+	requireRating(byFilter, cheapLaptop.GetId(), 0, 0)
+	requireRating(everything, cheapLaptop.GetId(), 0, 0)
+
+	rateTestLaptop(t, bob, expensiveLaptop.GetId(), 10)
+	requireRating(byID, expensiveLaptop.GetId(), 2, 8)
+	requireRating(everything, expensiveLaptop.GetId(), 2, 8)
+}
@@ -0,0 +1,276 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"log"
+	"sort"
+	"sync"
+)
+
+// DefaultRenditionSizes are the largest dimensions in pixels of the resized versions of every image.
+var DefaultRenditionSizes = []int{128, 512}
+
+const renditionJPEGQuality = 85
+
+// Renditioner generates resized versions of the uploaded images.
+// Images enqueued after an upload are resized by a pool of background workers,
+// a rendition that is not built yet can also be generated on demand.
+type Renditioner struct {
+	sizes []int
+
+	mutex  sync.RWMutex
+	closed bool
+	jobs   chan renditionJob
+	wg     sync.WaitGroup
+}
+
+type renditionJob struct {
+	store   ImageStore
+	imageID string
+}
+
+// NewRenditioner starts workers goroutines resizing the enqueued images.
+// With no workers, renditions are only generated on demand.
+func NewRenditioner(sizes []int, workers int, queueSize int) (*Renditioner, error) {
+	for _, size := range sizes {
+		if size <= 0 {
+			return nil, fmt.Errorf("invalid rendition size %d", size)
+		}
+	}
+
+	renditioner := &Renditioner{
+		sizes: append([]int(nil), sizes...),
+	}
+	sort.Ints(renditioner.sizes)
+
+	if workers <= 0 {
+		renditioner.closed = true
+		return renditioner, nil
+	}
+
+	renditioner.jobs = make(chan renditionJob, queueSize)
+	for i := 0; i < workers; i++ {
+		renditioner.wg.Add(1)
+		go renditioner.work()
+	}
+	return renditioner, nil
+}
+
+func (renditioner *Renditioner) Sizes() []int {
+	return append([]int(nil), renditioner.sizes...)
+}
+
+func (renditioner *Renditioner) HasSize(size int) bool {
+	i := sort.SearchInts(renditioner.sizes, size)
+	return i < len(renditioner.sizes) && renditioner.sizes[i] == size
+}
+
+// Enqueue schedules the renditions of the image without blocking.
+// It returns false if the queue is full or the renditioner is closed,
+// the renditions are then generated on demand.
+func (renditioner *Renditioner) Enqueue(store ImageStore, imageID string) bool {
+	renditioner.mutex.RLock()
+	defer renditioner.mutex.RUnlock()
+
+	if renditioner.closed {
+		return false
+	}
+
+	select {
+	case renditioner.jobs <- renditionJob{store: store, imageID: imageID}:
+		return true
+	default:
+		log.Printf("rendition queue is full, skip image %s", imageID)
+		return false
+	}
+}
+
+// Close stops accepting images and waits for the enqueued ones to be resized.
+func (renditioner *Renditioner) Close() {
+	renditioner.mutex.Lock()
+	if renditioner.closed {
+		renditioner.mutex.Unlock()
+		return
+	}
+	renditioner.closed = true
+	close(renditioner.jobs)
+	renditioner.mutex.Unlock()
+
+	renditioner.wg.Wait()
+}
+
+func (renditioner *Renditioner) work() {
+	defer renditioner.wg.Done()
+
+	for job := range renditioner.jobs {
+		err := renditioner.generateAll(job.store, job.imageID)
+		if err != nil {
+			log.Printf("cannot generate renditions of image %s: %v", job.imageID, err)
+		}
+	}
+}
+
+func (renditioner *Renditioner) generateAll(store ImageStore, imageID string) error {
+	var missing []int
+	for _, size := range renditioner.sizes {
+		rendition, err := store.OpenRendition(imageID, size)
+		if err == nil {
+			rendition.Close()
+			continue
+		}
+		if !errors.Is(err, ErrNotFound) {
+			return err
+		}
+		missing = append(missing, size)
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	source, image, err := decodeStoredImage(store, imageID)
+	if err != nil {
+		return err
+	}
+
+	for _, size := range missing {
+		_, err := saveRendition(store, image, source, size)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Generate resizes the image to the size, saves the rendition to the store and returns its content.
+func (renditioner *Renditioner) Generate(store ImageStore, imageID string, size int) ([]byte, error) {
+	if !renditioner.HasSize(size) {
+		return nil, fmt.Errorf("invalid rendition size %d", size)
+	}
+
+	source, image, err := decodeStoredImage(store, imageID)
+	if err != nil {
+		return nil, err
+	}
+	return saveRendition(store, image, source, size)
+}
+
+func decodeStoredImage(store ImageStore, imageID string) (image.Image, *ImageInfo, error) {
+	info, err := store.Find(imageID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if info == nil {
+		return nil, nil, ErrNotFound
+	}
+
+	file, err := store.Open(imageID)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+
+	source, _, err := image.Decode(file)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: cannot decode image: %v", ErrInvalidImageContent, err)
+	}
+	return source, info, nil
+}
+
+func saveRendition(store ImageStore, info *ImageInfo, source image.Image, size int) ([]byte, error) {
+	resized := resizeImage(source, size)
+
+	data := bytes.Buffer{}
+	var err error
+	if RenditionType(info) == ".jpg" {
+		err = jpeg.Encode(&data, resized, &jpeg.Options{Quality: renditionJPEGQuality})
+	} else {
+		err = png.Encode(&data, resized)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot encode rendition: %w", err)
+	}
+
+	content := data.Bytes()
+	err = store.SaveRendition(info.ID, size, data)
+	if err != nil {
+		return nil, err
+	}
+	return content, nil
+}
+
+// RenditionType returns the file extension of the renditions of the image.
+// JPEG photos stay JPEG, the other formats become PNG to keep their transparency.
+func RenditionType(image *ImageInfo) string {
+	if image.Format == "jpeg" {
+		return ".jpg"
+	}
+	return ".png"
+}
+
+// resizeImage scales the image down to fit a size x size box, keeping its aspect ratio.
+// Every pixel of the result is the average of the source pixels it covers.
+func resizeImage(source image.Image, size int) image.Image {
+	bounds := source.Bounds()
+	srcWidth, srcHeight := bounds.Dx(), bounds.Dy()
+
+	src := image.NewRGBA(image.Rect(0, 0, srcWidth, srcHeight))
+	draw.Draw(src, src.Bounds(), source, bounds.Min, draw.Src)
+
+	width, height := renditionDimensions(srcWidth, srcHeight, size)
+	if width == srcWidth && height == srcHeight {
+		return src
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0 := y * srcHeight / height
+		y1 := max((y+1)*srcHeight/height, y0+1)
+
+		for x := 0; x < width; x++ {
+			x0 := x * srcWidth / width
+			x1 := max((x+1)*srcWidth/width, x0+1)
+
+			var sum [4]int
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[sy*src.Stride+x0*4 : sy*src.Stride+x1*4]
+				for i := 0; i < len(row); i += 4 {
+					sum[0] += int(row[i])
+					sum[1] += int(row[i+1])
+					sum[2] += int(row[i+2])
+					sum[3] += int(row[i+3])
+				}
+			}
+
+			count := (y1 - y0) * (x1 - x0)
+			offset := y*dst.Stride + x*4
+			for i := range sum {
+				dst.Pix[offset+i] = uint8((sum[i] + count/2) / count)
+			}
+		}
+	}
+	return dst
+}
+
+// renditionDimensions fits width x height into a size x size box, images are never scaled up.
+func renditionDimensions(width int, height int, size int) (int, int) {
+	if width <= size && height <= size {
+		return width, height
+	}
+	if width >= height {
+		return size, max((height*size+width/2)/width, 1)
+	}
+	return max((width*size+height/2)/height, 1), size
+}
+
+// readAllAndClose reads a rendition opened from a store.
+func readAllAndClose(reader io.ReadCloser) ([]byte, error) {
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
@@ -0,0 +1,226 @@
+package service_test
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/jpeg"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Dostonlv/pcbook/pb"
+	"github.com/Dostonlv/pcbook/sample"
+	"github.com/Dostonlv/pcbook/service"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func newTestJPEG(t *testing.T, width, height int) []byte {
+	buffer := bytes.Buffer{}
+	require.NoError(t, jpeg.Encode(&buffer, newTestImage(width, height), nil))
+	return buffer.Bytes()
+}
+
+func uploadTestImage(t *testing.T, laptopClient pb.LaptopServiceClient, laptopID string, imageType string, content []byte) string {
+	stream, err := laptopClient.UploadImage(context.Background())
+	require.NoError(t, err)
+
+	err = stream.Send(&pb.UploadImageRequest{
+		Data: &pb.UploadImageRequest_Info{
+			Info: &pb.ImageInfo{LaptopId: laptopID, ImageType: imageType},
+		},
+	})
+	require.NoError(t, err)
+
+	err = stream.Send(&pb.UploadImageRequest{
+		Data: &pb.UploadImageRequest_ChunkData{ChunkData: content},
+	})
+	require.NoError(t, err)
+
+	res, err := stream.CloseAndRecv()
+	require.NoError(t, err)
+	return res.GetId()
+}
+
+func downloadTestRendition(laptopClient pb.LaptopServiceClient, imageID string, size uint32) (*pb.RenditionInfo, []byte, error) {
+	stream, err := laptopClient.GetImageRendition(context.Background(), &pb.GetImageRenditionRequest{
+		ImageId: imageID,
+		Size:    size,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var info *pb.RenditionInfo
+	content := bytes.Buffer{}
+	for {
+		res, err := stream.Recv()
+		if err == io.EOF {
+			return info, content.Bytes(), nil
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if res.GetInfo() != nil {
+			info = res.GetInfo()
+			continue
+		}
+		content.Write(res.GetChunkData())
+	}
+}
+
+func TestClientGetImageRendition(t *testing.T) {
+	t.Parallel()
+
+	laptopStore := service.NewInMemoryLaptopStore()
+	imageStore := service.NewDiskImageStore(t.TempDir())
+
+	laptop := sample.NewLaptop()
+	require.NoError(t, laptopStore.Save(laptop))
+
+	renditions, err := service.NewRenditioner([]int{16, 32}, 2, 10)
+	require.NoError(t, err)
+	defer renditions.Close()
+
+	laptopServer := service.NewLaptopServer(laptopStore, imageStore, nil, service.WithRenditions(renditions))
+	serverAddress := startTestLaptopServerWith(t, laptopServer)
+	laptopClient := newTestLaptopClient(t, serverAddress)
+
+	original := newTestPNG(t, 64, 48)
+	imageID := uploadTestImage(t, laptopClient, laptop.GetId(), ".png", original)
+
+	// the renditions are generated in the background after the upload
+	require.Eventually(t, func() bool {
+		for _, size := range []int{16, 32} {
+			rendition, err := imageStore.OpenRendition(imageID, size)
+			if err != nil {
+				return false
+			}
+			rendition.Close()
+		}
+		return true
+	}, 5*time.Second, 10*time.Millisecond)
+
+	info, content, err := downloadTestRendition(laptopClient, imageID, 16)
+	require.NoError(t, err)
+	require.Equal(t, ".png", info.GetImageType())
+	require.EqualValues(t, 16, info.GetWidth())
+	require.EqualValues(t, 12, info.GetHeight())
+
+	config, format, err := image.DecodeConfig(bytes.NewReader(content))
+	require.NoError(t, err)
+	require.Equal(t, "png", format)
+	require.Equal(t, 16, config.Width)
+	require.Equal(t, 12, config.Height)
+
+	info, content, err = downloadTestRendition(laptopClient, imageID, 0)
+	require.NoError(t, err)
+	require.EqualValues(t, 64, info.GetWidth())
+	require.EqualValues(t, 48, info.GetHeight())
+	require.Equal(t, original, content)
+
+	_, _, err = downloadTestRendition(laptopClient, imageID, 100)
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, _, err = downloadTestRendition(laptopClient, "unknown", 16)
+	require.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestClientGetImageRenditionOnDemand(t *testing.T) {
+	t.Parallel()
+
+	laptopStore := service.NewInMemoryLaptopStore()
+	imageFolder := t.TempDir()
+	imageStore := service.NewDiskImageStore(imageFolder)
+
+	laptop := sample.NewLaptop()
+	require.NoError(t, laptopStore.Save(laptop))
+
+	serverAddress := startTestLaptopServer(t, laptopStore, imageStore, nil)
+	laptopClient := newTestLaptopClient(t, serverAddress)
+
+	imageID := uploadTestImage(t, laptopClient, laptop.GetId(), ".jpg", newTestJPEG(t, 300, 200))
+
+	_, err := imageStore.OpenRendition(imageID, 128)
+	require.ErrorIs(t, err, service.ErrNotFound)
+
+	info, content, err := downloadTestRendition(laptopClient, imageID, 128)
+	require.NoError(t, err)
+	require.Equal(t, ".jpg", info.GetImageType())
+	require.EqualValues(t, 128, info.GetWidth())
+	require.EqualValues(t, 85, info.GetHeight())
+
+	config, format, err := image.DecodeConfig(bytes.NewReader(content))
+	require.NoError(t, err)
+	require.Equal(t, "jpeg", format)
+	require.Equal(t, 128, config.Width)
+	require.Equal(t, 85, config.Height)
+
+	// the rendition generated on demand is kept for the next request
+	rendition, err := imageStore.OpenRendition(imageID, 128)
+	require.NoError(t, err)
+	rendition.Close()
+
+	// images smaller than the rendition are not scaled up
+	info, _, err = downloadTestRendition(laptopClient, imageID, 512)
+	require.NoError(t, err)
+	require.EqualValues(t, 300, info.GetWidth())
+	require.EqualValues(t, 200, info.GetHeight())
+
+	reopened, err := service.OpenDiskImageStore(imageFolder)
+	require.NoError(t, err)
+	rendition, err = reopened.OpenRendition(imageID, 128)
+	require.NoError(t, err)
+	rendition.Close()
+	require.NoDirExists(t, filepath.Join(imageFolder, "quarantine"))
+
+	require.NoError(t, reopened.Delete(imageID))
+	entries, err := os.ReadDir(imageFolder)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
+
+func TestContentAddressedImageStoreSharesRenditions(t *testing.T) {
+	t.Parallel()
+
+	imageFolder := t.TempDir()
+	store, err := service.NewContentAddressedImageStore(imageFolder)
+	require.NoError(t, err)
+
+	content := newTestPNG(t, 40, 40)
+	info := &service.ImageInfo{Type: ".png", Width: 40, Height: 40, Format: "png"}
+
+	info.LaptopID = "laptop-1"
+	imageID1, err := store.Save(info, *bytes.NewBuffer(content))
+	require.NoError(t, err)
+	info.LaptopID = "laptop-2"
+	imageID2, err := store.Save(info, *bytes.NewBuffer(content))
+	require.NoError(t, err)
+
+	renditions, err := service.NewRenditioner([]int{20}, 0, 0)
+	require.NoError(t, err)
+	rendition, err := renditions.Generate(store, imageID1, 20)
+	require.NoError(t, err)
+
+	file, err := store.OpenRendition(imageID2, 20)
+	require.NoError(t, err)
+	shared, err := io.ReadAll(file)
+	file.Close()
+	require.NoError(t, err)
+	require.Equal(t, rendition, shared)
+
+	require.NoError(t, store.Delete(imageID1))
+	file, err = store.OpenRendition(imageID2, 20)
+	require.NoError(t, err)
+	file.Close()
+
+	require.NoError(t, store.Delete(imageID2))
+	entries, err := os.ReadDir(filepath.Join(imageFolder, "renditions"))
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
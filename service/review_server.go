@@ -0,0 +1,436 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Dostonlv/pcbook/pb"
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	DefaultReviewPageSize = 20
+	maxReviewPageSize     = 100
+
+	maxReviewTitleLength  = 120
+	maxReviewBodyLength   = 5000
+	maxReviewPoints       = 10
+	maxReviewPointLength  = 200
+	maxRejectReasonLength = 500
+)
+
+// ReviewServer lets users review the laptops they rated, and admins moderate the reviews.
+type ReviewServer struct {
+	pb.UnimplementedReviewServiceServer
+	tenants     *TenantCatalogs
+	bannedWords *BannedWords
+}
+
+type ReviewServerOption func(server *ReviewServer)
+
+// WithBannedWords flags the reviews containing the words for the moderators, no word is banned by default.
+func WithBannedWords(bannedWords *BannedWords) ReviewServerOption {
+	return func(server *ReviewServer) {
+		server.bannedWords = bannedWords
+	}
+}
+
+func NewReviewServer(tenants *TenantCatalogs, opts ...ReviewServerOption) *ReviewServer {
+	server := &ReviewServer{
+		tenants:     tenants,
+		bannedWords: NewBannedWords(),
+	}
+	for _, opt := range opts {
+		opt(server)
+	}
+	return server
+}
+
+func (server *ReviewServer) catalog(ctx context.Context) (*Catalog, error) {
+	tenant := TenantFromContext(ctx)
+	catalog := server.tenants.Find(tenant)
+	if catalog == nil {
+		return nil, errorLog(status.Errorf(codes.PermissionDenied, "tenant %s doesn't exist", tenant))
+	}
+	return catalog, nil
+}
+
+func validateReview(req *pb.SubmitReviewRequest) error {
+	title := strings.TrimSpace(req.GetTitle())
+	if title == "" || utf8.RuneCountInString(title) > maxReviewTitleLength {
+		return fmt.Errorf("title must have between 1 and %d characters", maxReviewTitleLength)
+	}
+	body := strings.TrimSpace(req.GetBody())
+	if body == "" || utf8.RuneCountInString(body) > maxReviewBodyLength {
+		return fmt.Errorf("body must have between 1 and %d characters", maxReviewBodyLength)
+	}
+	for name, points := range map[string][]string{"pros": req.GetPros(), "cons": req.GetCons()} {
+		if len(points) > maxReviewPoints {
+			return fmt.Errorf("cannot list more than %d %s", maxReviewPoints, name)
+		}
+		for _, point := range points {
+			point = strings.TrimSpace(point)
+			if point == "" || utf8.RuneCountInString(point) > maxReviewPointLength {
+				return fmt.Errorf("%s must have between 1 and %d characters", name, maxReviewPointLength)
+			}
+		}
+	}
+	return nil
+}
+
+func trimAll(texts []string) []string {
+	result := make([]string, len(texts))
+	for i, text := range texts {
+		result[i] = strings.TrimSpace(text)
+	}
+	return result
+}
+
+// reviewToPB converts the review along with the score of its author,
+// the banned words are only shown to the moderators.
+func reviewToPB(review *Review, score float64, public bool) *pb.Review {
+	result := &pb.Review{
+		Id:           review.ID,
+		LaptopId:     review.LaptopID,
+		Username:     review.Username,
+		Title:        review.Title,
+		Body:         review.Body,
+		Pros:         review.Pros,
+		Cons:         review.Cons,
+		Score:        score,
+		State:        pb.Review_State(review.State),
+		RejectReason: review.RejectReason,
+		ModeratedBy:  review.ModeratedBy,
+		CreatedAt:    timestamppb.New(review.CreatedAt),
+		UpdatedAt:    timestamppb.New(review.UpdatedAt),
+	}
+	if !review.ModeratedAt.IsZero() {
+		result.ModeratedAt = timestamppb.New(review.ModeratedAt)
+	}
+	if !public {
+		result.FlaggedWords = review.FlaggedWords
+	}
+	return result
+}
+
+// reviewsToPB converts the reviews along with the current scores of their authors.
+func reviewsToPB(catalog *Catalog, reviews []*Review, public bool) ([]*pb.Review, error) {
+	ratings := make(map[string]*Rating)
+	result := make([]*pb.Review, len(reviews))
+	for i, review := range reviews {
+		rating, ok := ratings[review.LaptopID]
+		if !ok {
+			var err error
+			rating, err = catalog.ratingStore.Find(review.LaptopID)
+			if err != nil {
+				return nil, err
+			}
+			ratings[review.LaptopID] = rating
+		}
+
+		var score float64
+		if rating != nil {
+			score = rating.Scores[review.Username]
+		}
+		result[i] = reviewToPB(review, score, public)
+	}
+	return result, nil
+}
+
+// pageToken is the position of the last review of a page, so that reviews
+// submitted or removed in the meantime don't shift the next pages.
+func pageToken(review *Review) string {
+	token := strconv.FormatInt(review.UpdatedAt.UnixNano(), 10) + "/" + review.ID
+	return base64.RawURLEncoding.EncodeToString([]byte(token))
+}
+
+func parsePageToken(token string) (*Review, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, err
+	}
+	nanos, id, ok := strings.Cut(string(data), "/")
+	if !ok {
+		return nil, fmt.Errorf("missing review ID")
+	}
+	unixNano, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &Review{ID: id, UpdatedAt: time.Unix(0, unixNano)}, nil
+}
+
+// pageOfReviews returns the page of the reviews following the token. The reviews are sorted
+// by their last submission, and listed from the most recent one if newestFirst is true.
+func pageOfReviews(reviews []*Review, pageSize uint32, token string, newestFirst bool) ([]*Review, string, error) {
+	if pageSize == 0 {
+		pageSize = DefaultReviewPageSize
+	}
+	if pageSize > maxReviewPageSize {
+		pageSize = maxReviewPageSize
+	}
+
+	if newestFirst {
+		for i, j := 0, len(reviews)-1; i < j; i, j = i+1, j-1 {
+			reviews[i], reviews[j] = reviews[j], reviews[i]
+		}
+	}
+
+	start := 0
+	if token != "" {
+		last, err := parsePageToken(token)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid page token: %w", err)
+		}
+		for start < len(reviews) {
+			if newestFirst && reviewBefore(reviews[start], last) || !newestFirst && reviewBefore(last, reviews[start]) {
+				break
+			}
+			start++
+		}
+	}
+
+	end := start + int(pageSize)
+	if end >= len(reviews) {
+		return reviews[start:], "", nil
+	}
+	return reviews[start:end], pageToken(reviews[end-1]), nil
+}
+
+func (server *ReviewServer) SubmitReview(ctx context.Context, req *pb.SubmitReviewRequest) (*pb.SubmitReviewResponse, error) {
+	laptopID := req.GetLaptopId()
+	claims := ClaimsFromContext(ctx)
+	if claims == nil || claims.Username == "" {
+		return nil, errorLog(status.Error(codes.Unauthenticated, "reviewing a laptop requires an authenticated user"))
+	}
+	username := claims.Username
+	log.Printf("receive a submit-review request for laptop %s from %s", laptopID, username)
+
+	if err := validateReview(req); err != nil {
+		return nil, errorLog(status.Errorf(codes.InvalidArgument, "invalid review: %v", err))
+	}
+
+	catalog, err := server.catalog(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var review *Review
+	var score float64
+	err = catalog.uow.Do(laptopID, func(tx *Tx) error {
+		laptop, err := tx.FindLaptop(laptopID)
+		if err != nil {
+			return status.Errorf(codes.Internal, "cannot find laptop: %v", err)
+		}
+		if laptop == nil {
+			return status.Errorf(codes.NotFound, "laptop %s is not found", laptopID)
+		}
+
+		rating, err := tx.FindRating(laptopID)
+		if err != nil {
+			return status.Errorf(codes.Internal, "cannot find rating: %v", err)
+		}
+		rated := false
+		if rating != nil {
+			score, rated = rating.Scores[username]
+		}
+		if !rated {
+			return status.Errorf(codes.FailedPrecondition, "laptop %s must be rated before being reviewed", laptopID)
+		}
+
+		review, err = catalog.reviewStore.FindByAuthor(laptopID, username)
+		if err != nil {
+			return status.Errorf(codes.Internal, "cannot find review: %v", err)
+		}
+
+		now := time.Now()
+		if review == nil {
+			review = &Review{
+				ID:        uuid.New().String(),
+				LaptopID:  laptopID,
+				Username:  username,
+				CreatedAt: now,
+			}
+		}
+		review.Title = strings.TrimSpace(req.GetTitle())
+		review.Body = strings.TrimSpace(req.GetBody())
+		review.Pros = trimAll(req.GetPros())
+		review.Cons = trimAll(req.GetCons())
+		review.State = ReviewPending
+		texts := append([]string{review.Title, review.Body}, review.Pros...)
+		review.FlaggedWords = server.bannedWords.Find(append(texts, review.Cons...)...)
+		review.RejectReason = ""
+		review.ModeratedBy = ""
+		review.ModeratedAt = time.Time{}
+		review.UpdatedAt = now
+
+		err = catalog.reviewStore.Save(review)
+		if err != nil {
+			return status.Errorf(codes.Internal, "cannot save review: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errorLog(err)
+	}
+
+	if len(review.FlaggedWords) > 0 {
+		log.Printf("review %s is flagged for %s", review.ID, strings.Join(review.FlaggedWords, ", "))
+	}
+	return &pb.SubmitReviewResponse{Review: reviewToPB(review, score, false)}, nil
+}
+
+func (server *ReviewServer) ListReviews(ctx context.Context, req *pb.ListReviewsRequest) (*pb.ListReviewsResponse, error) {
+	laptopID := req.GetLaptopId()
+	log.Printf("receive a list-reviews request for laptop %s", laptopID)
+
+	catalog, err := server.catalog(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	laptop, err := catalog.laptopStore.Find(laptopID)
+	if err != nil {
+		return nil, errorLog(status.Errorf(codes.Internal, "cannot find laptop: %v", err))
+	}
+	if laptop == nil {
+		return nil, errorLog(status.Errorf(codes.NotFound, "laptop %s is not found", laptopID))
+	}
+
+	reviews, err := catalog.reviewStore.List(laptopID, ReviewApproved)
+	if err != nil {
+		return nil, errorLog(status.Errorf(codes.Internal, "cannot list reviews: %v", err))
+	}
+	page, nextPageToken, err := pageOfReviews(reviews, req.GetPageSize(), req.GetPageToken(), true)
+	if err != nil {
+		return nil, errorLog(status.Error(codes.InvalidArgument, err.Error()))
+	}
+
+	result, err := reviewsToPB(catalog, page, true)
+	if err != nil {
+		return nil, errorLog(status.Errorf(codes.Internal, "cannot find ratings: %v", err))
+	}
+	return &pb.ListReviewsResponse{Reviews: result, NextPageToken: nextPageToken}, nil
+}
+
+func (server *ReviewServer) ListPendingReviews(ctx context.Context, req *pb.ListPendingReviewsRequest) (*pb.ListPendingReviewsResponse, error) {
+	log.Printf("receive a list-pending-reviews request, flagged only: %t", req.GetFlaggedOnly())
+
+	catalog, err := server.catalog(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	reviews, err := catalog.reviewStore.List("", ReviewPending)
+	if err != nil {
+		return nil, errorLog(status.Errorf(codes.Internal, "cannot list reviews: %v", err))
+	}
+	if req.GetFlaggedOnly() {
+		flagged := reviews[:0]
+		for _, review := range reviews {
+			if len(review.FlaggedWords) > 0 {
+				flagged = append(flagged, review)
+			}
+		}
+		reviews = flagged
+	}
+
+	page, nextPageToken, err := pageOfReviews(reviews, req.GetPageSize(), req.GetPageToken(), false)
+	if err != nil {
+		return nil, errorLog(status.Error(codes.InvalidArgument, err.Error()))
+	}
+
+	result, err := reviewsToPB(catalog, page, false)
+	if err != nil {
+		return nil, errorLog(status.Errorf(codes.Internal, "cannot find ratings: %v", err))
+	}
+	return &pb.ListPendingReviewsResponse{Reviews: result, NextPageToken: nextPageToken}, nil
+}
+
+func (server *ReviewServer) ApproveReview(ctx context.Context, req *pb.ApproveReviewRequest) (*pb.ApproveReviewResponse, error) {
+	log.Printf("receive an approve-review request for review %s", req.GetReviewId())
+
+	review, err := server.moderate(ctx, req.GetReviewId(), ReviewApproved, "")
+	if err != nil {
+		return nil, err
+	}
+	return &pb.ApproveReviewResponse{Review: review}, nil
+}
+
+func (server *ReviewServer) RejectReview(ctx context.Context, req *pb.RejectReviewRequest) (*pb.RejectReviewResponse, error) {
+	log.Printf("receive a reject-review request for review %s", req.GetReviewId())
+
+	reason := strings.TrimSpace(req.GetReason())
+	if utf8.RuneCountInString(reason) > maxRejectReasonLength {
+		return nil, errorLog(status.Errorf(codes.InvalidArgument, "reason is longer than %d characters", maxRejectReasonLength))
+	}
+
+	review, err := server.moderate(ctx, req.GetReviewId(), ReviewRejected, reason)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.RejectReviewResponse{Review: review}, nil
+}
+
+// moderate approves or rejects a pending review on behalf of the calling admin.
+func (server *ReviewServer) moderate(ctx context.Context, reviewID string, state ReviewState, reason string) (*pb.Review, error) {
+	catalog, err := server.catalog(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var moderator string
+	if claims := ClaimsFromContext(ctx); claims != nil {
+		moderator = claims.Username
+	}
+
+	// the laptop of the review never changes, the review is found again in the transaction
+	review, err := catalog.reviewStore.Find(reviewID)
+	if err != nil {
+		return nil, errorLog(status.Errorf(codes.Internal, "cannot find review: %v", err))
+	}
+	if review == nil {
+		return nil, errorLog(status.Errorf(codes.NotFound, "review %s is not found", reviewID))
+	}
+
+	err = catalog.uow.Do(review.LaptopID, func(tx *Tx) error {
+		review, err = catalog.reviewStore.Find(reviewID)
+		if err != nil {
+			return status.Errorf(codes.Internal, "cannot find review: %v", err)
+		}
+		if review == nil {
+			return status.Errorf(codes.NotFound, "review %s is not found", reviewID)
+		}
+		if review.State != ReviewPending {
+			return status.Errorf(codes.FailedPrecondition, "review %s is not pending moderation", reviewID)
+		}
+
+		review.State = state
+		review.RejectReason = reason
+		review.ModeratedBy = moderator
+		review.ModeratedAt = time.Now()
+		err = catalog.reviewStore.Save(review)
+		if err != nil {
+			return status.Errorf(codes.Internal, "cannot save review: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errorLog(err)
+	}
+
+	result, err := reviewsToPB(catalog, []*Review{review}, false)
+	if err != nil {
+		return nil, errorLog(status.Errorf(codes.Internal, "cannot find rating: %v", err))
+	}
+	return result[0], nil
+}
@@ -0,0 +1,237 @@
+package service_test
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Dostonlv/pcbook/pb"
+	"github.com/Dostonlv/pcbook/sample"
+	"github.com/Dostonlv/pcbook/service"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func startTestReviewServer(t *testing.T, catalog *service.Catalog, jwtManager *service.JWTManager, opts ...service.ReviewServerOption) string {
+	tenants := service.NewTenantCatalogs(catalog, nil)
+
+	interceptor := service.NewAuthInterceptor(jwtManager, nil)
+	grpcServer := grpc.NewServer(
+		grpc.UnaryInterceptor(interceptor.Unary()),
+		grpc.StreamInterceptor(interceptor.Stream()),
+	)
+	// the review tests rate a laptop with many new accounts, which would look like a burst
+	laptopServer := service.NewMultiTenantLaptopServer(tenants, service.WithRatingLimits(service.RatingLimits{}))
+	pb.RegisterLaptopServiceServer(grpcServer, laptopServer)
+	pb.RegisterReviewServiceServer(grpcServer, service.NewReviewServer(tenants, opts...))
+
+	listener, err := net.Listen("tcp", ":0")
+	require.NoError(t, err)
+	go grpcServer.Serve(listener)
+	t.Cleanup(grpcServer.Stop)
+
+	return listener.Addr().String()
+}
+
+func TestClientReviews(t *testing.T) {
+	t.Parallel()
+
+	laptopStore := service.NewInMemoryLaptopStore()
+	ratingStore := service.NewInMemoryRatingStore()
+	laptop := sample.NewLaptop()
+	require.NoError(t, laptopStore.Save(laptop))
+	_, _, err := ratingStore.Add(laptop.GetId(), "alice", 9, time.Now())
+	require.NoError(t, err)
+	_, _, err = ratingStore.Add(laptop.GetId(), "bob", 4, time.Now())
+	require.NoError(t, err)
+
+	catalog := service.NewCatalog(laptopStore, nil, ratingStore)
+	jwtManager := service.NewJWTManager("secret", time.Minute)
+	serverAddress := startTestReviewServer(t, catalog, jwtManager, service.WithBannedWords(service.NewBannedWords("scam", " Junk ")))
+
+	alice := pb.NewReviewServiceClient(newTestUserConn(t, serverAddress, jwtManager, "alice"))
+	bob := pb.NewReviewServiceClient(newTestUserConn(t, serverAddress, jwtManager, "bob"))
+	carol := pb.NewReviewServiceClient(newTestUserConn(t, serverAddress, jwtManager, "carol"))
+	admin := pb.NewReviewServiceClient(newTestUserConn(t, serverAddress, jwtManager, "admin1"))
+	ctx := context.Background()
+
+	aliceReview, err := alice.SubmitReview(ctx, &pb.SubmitReviewRequest{
+		LaptopId: laptop.GetId(),
+		Title:    " Great laptop ",
+		Body:     "Fast and light.",
+		Pros:     []string{"battery"},
+		Cons:     []string{"price"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, "alice", aliceReview.GetReview().GetUsername())
+	require.Equal(t, "Great laptop", aliceReview.GetReview().GetTitle())
+	require.Equal(t, 9.0, aliceReview.GetReview().GetScore())
+	require.Equal(t, pb.Review_PENDING, aliceReview.GetReview().GetState())
+	require.Empty(t, aliceReview.GetReview().GetFlaggedWords())
+
+	bobReview, err := bob.SubmitReview(ctx, &pb.SubmitReviewRequest{
+		LaptopId: laptop.GetId(),
+		Title:    "Total SCAM",
+		Body:     "Junk, broke in a week.",
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"junk", "scam"}, bobReview.GetReview().GetFlaggedWords())
+
+	// the reviewer must have rated the laptop, and the review must be complete
+	_, err = carol.SubmitReview(ctx, &pb.SubmitReviewRequest{LaptopId: laptop.GetId(), Title: "Nice", Body: "Nice."})
+	require.Equal(t, codes.FailedPrecondition, status.Code(err))
+	_, err = alice.SubmitReview(ctx, &pb.SubmitReviewRequest{LaptopId: laptop.GetId(), Title: "No body"})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = alice.SubmitReview(ctx, &pb.SubmitReviewRequest{LaptopId: "unknown", Title: "Nice", Body: "Nice."})
+	require.Equal(t, codes.NotFound, status.Code(err))
+
+	// only approved reviews are public
+	listed, err := carol.ListReviews(ctx, &pb.ListReviewsRequest{LaptopId: laptop.GetId()})
+	require.NoError(t, err)
+	require.Empty(t, listed.GetReviews())
+
+	pending, err := admin.ListPendingReviews(ctx, &pb.ListPendingReviewsRequest{})
+	require.NoError(t, err)
+	require.Len(t, pending.GetReviews(), 2)
+	require.Equal(t, aliceReview.GetReview().GetId(), pending.GetReviews()[0].GetId())
+
+	pending, err = admin.ListPendingReviews(ctx, &pb.ListPendingReviewsRequest{FlaggedOnly: true})
+	require.NoError(t, err)
+	require.Len(t, pending.GetReviews(), 1)
+	require.Equal(t, bobReview.GetReview().GetId(), pending.GetReviews()[0].GetId())
+
+	approved, err := admin.ApproveReview(ctx, &pb.ApproveReviewRequest{ReviewId: aliceReview.GetReview().GetId()})
+	require.NoError(t, err)
+	require.Equal(t, pb.Review_APPROVED, approved.GetReview().GetState())
+	require.Equal(t, "admin1", approved.GetReview().GetModeratedBy())
+	require.NotNil(t, approved.GetReview().GetModeratedAt())
+
+	rejected, err := admin.RejectReview(ctx, &pb.RejectReviewRequest{ReviewId: bobReview.GetReview().GetId(), Reason: "abusive"})
+	require.NoError(t, err)
+	require.Equal(t, pb.Review_REJECTED, rejected.GetReview().GetState())
+	require.Equal(t, "abusive", rejected.GetReview().GetRejectReason())
+
+	_, err = admin.ApproveReview(ctx, &pb.ApproveReviewRequest{ReviewId: bobReview.GetReview().GetId()})
+	require.Equal(t, codes.FailedPrecondition, status.Code(err))
+	_, err = admin.ApproveReview(ctx, &pb.ApproveReviewRequest{ReviewId: "unknown"})
+	require.Equal(t, codes.NotFound, status.Code(err))
+
+	listed, err = carol.ListReviews(ctx, &pb.ListReviewsRequest{LaptopId: laptop.GetId()})
+	require.NoError(t, err)
+	require.Len(t, listed.GetReviews(), 1)
+	require.Equal(t, aliceReview.GetReview().GetId(), listed.GetReviews()[0].GetId())
+	require.Equal(t, 9.0, listed.GetReviews()[0].GetScore())
+	require.Empty(t, listed.GetNextPageToken())
+
+	// editing a review replaces it and puts it back in the moderation queue
+	edited, err := alice.SubmitReview(ctx, &pb.SubmitReviewRequest{LaptopId: laptop.GetId(), Title: "Still great", Body: "After a year."})
+	require.NoError(t, err)
+	require.Equal(t, aliceReview.GetReview().GetId(), edited.GetReview().GetId())
+	require.Equal(t, pb.Review_PENDING, edited.GetReview().GetState())
+	require.Empty(t, edited.GetReview().GetModeratedBy())
+
+	listed, err = carol.ListReviews(ctx, &pb.ListReviewsRequest{LaptopId: laptop.GetId()})
+	require.NoError(t, err)
+	require.Empty(t, listed.GetReviews())
+
+	// the reviews go along with their laptop
+	laptopClient := newTestUserClient(t, serverAddress, jwtManager, "admin1")
+	_, err = laptopClient.DeleteLaptop(ctx, &pb.DeleteLaptopRequest{Id: laptop.GetId()})
+	require.NoError(t, err)
+	pending, err = admin.ListPendingReviews(ctx, &pb.ListPendingReviewsRequest{})
+	require.NoError(t, err)
+	require.Empty(t, pending.GetReviews())
+}
+
+func TestClientListReviewsPages(t *testing.T) {
+	t.Parallel()
+
+	laptopStore := service.NewInMemoryLaptopStore()
+	laptop := sample.NewLaptop()
+	require.NoError(t, laptopStore.Save(laptop))
+
+	catalog := service.NewCatalog(laptopStore, nil, service.NewInMemoryRatingStore())
+	jwtManager := service.NewJWTManager("secret", time.Minute)
+	serverAddress := startTestReviewServer(t, catalog, jwtManager)
+	ctx := context.Background()
+
+	const reviewCount = 7
+	var reviewIDs []string
+	for i := 0; i < reviewCount; i++ {
+		username := fmt.Sprintf("user%d", i)
+		conn := newTestUserConn(t, serverAddress, jwtManager, username)
+		rateTestLaptop(t, pb.NewLaptopServiceClient(conn), laptop.GetId(), 8)
+
+		res, err := pb.NewReviewServiceClient(conn).SubmitReview(ctx, &pb.SubmitReviewRequest{
+			LaptopId: laptop.GetId(),
+			Title:    "Review " + username,
+			Body:     "Body",
+		})
+		require.NoError(t, err)
+		reviewIDs = append(reviewIDs, res.GetReview().GetId())
+	}
+
+	admin := pb.NewReviewServiceClient(newTestUserConn(t, serverAddress, jwtManager, "admin1"))
+	var pendingIDs []string
+	pageToken := ""
+	for {
+		res, err := admin.ListPendingReviews(ctx, &pb.ListPendingReviewsRequest{PageSize: 3, PageToken: pageToken})
+		require.NoError(t, err)
+		require.LessOrEqual(t, len(res.GetReviews()), 3)
+		for _, review := range res.GetReviews() {
+			pendingIDs = append(pendingIDs, review.GetId())
+			_, err := admin.ApproveReview(ctx, &pb.ApproveReviewRequest{ReviewId: review.GetId()})
+			require.NoError(t, err)
+		}
+		if res.GetNextPageToken() == "" {
+			break
+		}
+		pageToken = res.GetNextPageToken()
+	}
+	require.Equal(t, reviewIDs, pendingIDs)
+
+	// public reviews are listed from the most recent one
+	var listedIDs []string
+	pageToken = ""
+	for {
+		res, err := admin.ListReviews(ctx, &pb.ListReviewsRequest{LaptopId: laptop.GetId(), PageSize: 2, PageToken: pageToken})
+		require.NoError(t, err)
+		for _, review := range res.GetReviews() {
+			listedIDs = append(listedIDs, review.GetId())
+		}
+		if res.GetNextPageToken() == "" {
+			break
+		}
+		pageToken = res.GetNextPageToken()
+	}
+	require.Len(t, listedIDs, reviewCount)
+	for i, id := range listedIDs {
+		require.Equal(t, reviewIDs[reviewCount-1-i], id)
+	}
+
+	_, err := admin.ListReviews(ctx, &pb.ListReviewsRequest{LaptopId: laptop.GetId(), PageToken: "not a token"})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func rateTestLaptop(t *testing.T, laptopClient pb.LaptopServiceClient, laptopID string, score float64) {
+	stream, err := laptopClient.RateLaptop(context.Background())
+	require.NoError(t, err)
+	require.NoError(t, stream.Send(&pb.RateLaptopRequest{LaptopId: laptopID, Score: score}))
+	res, err := stream.Recv()
+	require.NoError(t, err)
+	require.Zero(t, res.GetStatus().GetCode())
+	require.NoError(t, stream.CloseSend())
+}
+
+func TestBannedWords(t *testing.T) {
+	t.Parallel()
+
+	bannedWords := service.NewBannedWords("ass", "Scam", "")
+	require.Empty(t, bannedWords.Find("A first-class laptop"))
+	require.Equal(t, []string{"ass", "scam"}, bannedWords.Find("scam!", "You ASS.", "Scam"))
+	require.Empty(t, service.NewBannedWords().Find("scam"))
+}
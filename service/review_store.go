@@ -0,0 +1,131 @@
+package service
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+type ReviewState int
+
+const (
+	ReviewPending ReviewState = iota + 1
+	ReviewApproved
+	ReviewRejected
+)
+
+// Review is the text a user wrote about a laptop they rated.
+// It's only shown publicly once an admin approved it.
+type Review struct {
+	ID           string
+	LaptopID     string
+	Username     string
+	Title        string
+	Body         string
+	Pros         []string
+	Cons         []string
+	State        ReviewState
+	FlaggedWords []string
+	RejectReason string
+	ModeratedBy  string
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	ModeratedAt  time.Time
+}
+
+func (review *Review) Clone() *Review {
+	other := *review
+	other.Pros = append([]string(nil), review.Pros...)
+	other.Cons = append([]string(nil), review.Cons...)
+	other.FlaggedWords = append([]string(nil), review.FlaggedWords...)
+	return &other
+}
+
+// ReviewStore keeps the reviews of a tenant, a user has at most one review per laptop.
+type ReviewStore interface {
+	// Save creates the review or replaces the one with the same ID.
+	Save(review *Review) error
+	Find(id string) (*Review, error)
+	FindByAuthor(laptopID string, username string) (*Review, error)
+	// List returns the reviews in the state, of every laptop if laptopID is empty,
+	// sorted by their last submission.
+	List(laptopID string, state ReviewState) ([]*Review, error)
+	DeleteLaptop(laptopID string) error
+}
+
+type InMemoryReviewStore struct {
+	mutex   sync.RWMutex
+	reviews map[string]*Review
+}
+
+func NewInMemoryReviewStore() *InMemoryReviewStore {
+	return &InMemoryReviewStore{
+		reviews: make(map[string]*Review),
+	}
+}
+
+func (store *InMemoryReviewStore) Save(review *Review) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	store.reviews[review.ID] = review.Clone()
+	return nil
+}
+
+func (store *InMemoryReviewStore) Find(id string) (*Review, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	review := store.reviews[id]
+	if review == nil {
+		return nil, nil
+	}
+	return review.Clone(), nil
+}
+
+func (store *InMemoryReviewStore) FindByAuthor(laptopID string, username string) (*Review, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	for _, review := range store.reviews {
+		if review.LaptopID == laptopID && review.Username == username {
+			return review.Clone(), nil
+		}
+	}
+	return nil, nil
+}
+
+func (store *InMemoryReviewStore) List(laptopID string, state ReviewState) ([]*Review, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	var reviews []*Review
+	for _, review := range store.reviews {
+		if review.State == state && (laptopID == "" || review.LaptopID == laptopID) {
+			reviews = append(reviews, review.Clone())
+		}
+	}
+	sort.Slice(reviews, func(i, j int) bool {
+		return reviewBefore(reviews[i], reviews[j])
+	})
+	return reviews, nil
+}
+
+func (store *InMemoryReviewStore) DeleteLaptop(laptopID string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	for id, review := range store.reviews {
+		if review.LaptopID == laptopID {
+			delete(store.reviews, id)
+		}
+	}
+	return nil
+}
+
+func reviewBefore(review *Review, other *Review) bool {
+	if !review.UpdatedAt.Equal(other.UpdatedAt) {
+		return review.UpdatedAt.Before(other.UpdatedAt)
+	}
+	return review.ID < other.ID
+}
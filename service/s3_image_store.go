@@ -0,0 +1,760 @@
+package service
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DefaultS3PartSize is the size of the parts of a multipart upload,
+// the smallest S3 accepts for every part but the last one.
+const DefaultS3PartSize = 5 << 20
+
+// s3RenditionPattern matches the keys of renditions: <image ID>_<size>.
+var s3RenditionPattern = regexp.MustCompile(`^(.+)_[0-9]+$`)
+
+// s3LaptopFolder keeps an entry per image of every laptop, tenant names can't start with an underscore.
+const s3LaptopFolder = "_laptops/"
+
+// S3Config locates the bucket keeping the images. The endpoint is the base URL of
+// the S3-compatible service, buckets are addressed by path. Every key of the store starts with the prefix.
+type S3Config struct {
+	Endpoint    string
+	Bucket      string
+	Region      string
+	Prefix      string
+	Credentials S3Credentials
+	PartSize    int64
+	Client      *http.Client
+}
+
+// S3Error is an error response of the object storage.
+type S3Error struct {
+	StatusCode int
+	Code       string `xml:"Code"`
+	Message    string `xml:"Message"`
+}
+
+func (err *S3Error) Error() string {
+	return fmt.Sprintf("s3 error %d %s: %s", err.StatusCode, err.Code, err.Message)
+}
+
+// Is reports a missing object as ErrNotFound, but not a missing bucket.
+func (err *S3Error) Is(target error) bool {
+	return target == ErrNotFound && err.StatusCode == http.StatusNotFound && err.Code != "NoSuchBucket"
+}
+
+// S3ImageStore keeps the images in an S3-compatible object storage:
+// the content of an image under <prefix><image ID>, its metadata under <prefix><image ID>.meta,
+// its renditions under <prefix><image ID>_<size> and an empty entry under
+// <prefix>_laptops/<laptop ID>/<image ID> to list the images of a laptop.
+// Nothing is kept in memory, so that the servers sharing the bucket see the same images.
+type S3ImageStore struct {
+	config S3Config
+}
+
+func NewS3ImageStore(config S3Config) *S3ImageStore {
+	if config.PartSize <= 0 {
+		config.PartSize = DefaultS3PartSize
+	}
+	if config.Client == nil {
+		config.Client = http.DefaultClient
+	}
+	config.Endpoint = strings.TrimSuffix(config.Endpoint, "/")
+
+	return &S3ImageStore{
+		config: config,
+	}
+}
+
+// OpenS3ImageStore checks the bucket can be listed and adds the laptop entries
+// of the images stored before them.
+func OpenS3ImageStore(config S3Config) (*S3ImageStore, error) {
+	store := NewS3ImageStore(config)
+
+	objects, err := store.listObjects(store.config.Prefix)
+	if err != nil {
+		return nil, fmt.Errorf("cannot list images: %w", err)
+	}
+	entries, err := store.listAllObjects(store.config.Prefix + s3LaptopFolder)
+	if err != nil {
+		return nil, fmt.Errorf("cannot list laptop entries: %w", err)
+	}
+
+	listed := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		listed[path.Base(entry.Key)] = true
+	}
+
+	added := 0
+	for _, object := range objects {
+		name := strings.TrimPrefix(object.Key, store.config.Prefix)
+		if !strings.HasSuffix(name, metadataExt) || listed[strings.TrimSuffix(name, metadataExt)] {
+			continue
+		}
+
+		image, err := store.Find(strings.TrimSuffix(name, metadataExt))
+		if err != nil {
+			log.Printf("skip image metadata %s: %v", object.Key, err)
+			continue
+		}
+		if image == nil {
+			continue
+		}
+		err = store.putObject(store.laptopKey(image.LaptopID, image.ID), nil)
+		if err != nil {
+			return nil, fmt.Errorf("cannot add laptop entry of image %s: %w", image.ID, err)
+		}
+		added++
+	}
+
+	if added > 0 {
+		log.Printf("added the laptop entries of %d images to bucket %s", added, store.config.Bucket)
+	}
+	return store, nil
+}
+
+func (store *S3ImageStore) loadMetadata(key string) (*ImageInfo, error) {
+	body, err := store.getObject(key)
+	if err != nil {
+		return nil, err
+	}
+	data, err := readAllAndClose(body)
+	if err != nil {
+		return nil, err
+	}
+
+	image := &ImageInfo{}
+	err = json.Unmarshal(data, image)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode metadata: %w", err)
+	}
+	image.Path = store.contentKey(image.ID)
+	return image, nil
+}
+
+func (store *S3ImageStore) contentKey(imageID string) string {
+	return store.config.Prefix + imageID
+}
+
+func (store *S3ImageStore) metadataKey(imageID string) string {
+	return store.config.Prefix + imageID + metadataExt
+}
+
+func (store *S3ImageStore) renditionKey(imageID string, size int) string {
+	return store.config.Prefix + imageID + "_" + strconv.Itoa(size)
+}
+
+func (store *S3ImageStore) laptopKey(laptopID string, imageID string) string {
+	return store.laptopFolder(laptopID) + imageID
+}
+
+// laptopFolder escapes the laptop ID, so that it's a single folder of the key.
+func (store *S3ImageStore) laptopFolder(laptopID string) string {
+	return store.config.Prefix + s3LaptopFolder + url.PathEscape(laptopID) + "/"
+}
+
+func (store *S3ImageStore) Save(info *ImageInfo, imageData bytes.Buffer) (string, error) {
+	return saveImage(store, info, imageData.Bytes())
+}
+
+// Create streams the content to the bucket, in a multipart upload once it's larger than a part.
+func (store *S3ImageStore) Create() (ImageWriter, error) {
+	imageID, err := uuid.NewRandom()
+	if err != nil {
+		return nil, fmt.Errorf("cannot generate image %w", err)
+	}
+
+	return &s3ImageWriter{
+		store:   store,
+		imageID: imageID.String(),
+		hash:    sha256.New(),
+	}, nil
+}
+
+// Find loads the metadata of the image from the bucket.
+func (store *S3ImageStore) Find(imageID string) (*ImageInfo, error) {
+	// only the IDs this store generates are looked up, so that they can't point to other keys
+	if _, err := uuid.Parse(imageID); err != nil {
+		return nil, nil
+	}
+
+	image, err := store.loadMetadata(store.metadataKey(imageID))
+	if errors.Is(err, ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot load image metadata: %w", err)
+	}
+	if image.ID != imageID {
+		return nil, fmt.Errorf("metadata of image %s belongs to image %s", imageID, image.ID)
+	}
+	return image, nil
+}
+
+// List loads the images of the laptop entries, an entry left behind by a failed deletion is skipped.
+func (store *S3ImageStore) List(laptopID string) ([]*ImageInfo, error) {
+	entries, err := store.listObjects(store.laptopFolder(laptopID))
+	if err != nil {
+		return nil, fmt.Errorf("cannot list images: %w", err)
+	}
+
+	images := make(map[string]*ImageInfo, len(entries))
+	for _, entry := range entries {
+		image, err := store.Find(path.Base(entry.Key))
+		if err != nil {
+			return nil, err
+		}
+		if image != nil {
+			images[image.ID] = image
+		}
+	}
+	return listImages(images, laptopID), nil
+}
+
+// ListAll loads the images of the metadata objects, skipping the ones that can't be loaded.
+func (store *S3ImageStore) ListAll() ([]*ImageInfo, error) {
+	objects, err := store.listObjects(store.config.Prefix)
+	if err != nil {
+		return nil, fmt.Errorf("cannot list images: %w", err)
+	}
+
+	var images []*ImageInfo
+	for _, object := range objects {
+		name := strings.TrimPrefix(object.Key, store.config.Prefix)
+		if !strings.HasSuffix(name, metadataExt) {
+			continue
+		}
+
+		image, err := store.Find(strings.TrimSuffix(name, metadataExt))
+		if err != nil {
+			log.Printf("skip image metadata %s: %v", object.Key, err)
+			continue
+		}
+		if image == nil {
+			continue
+		}
+		images = append(images, image)
+	}
+	return images, nil
+}
+
+func (store *S3ImageStore) writeMetadata(image *ImageInfo) error {
+	metadata, err := json.Marshal(image)
+	if err != nil {
+		return err
+	}
+	return store.putObject(store.metadataKey(image.ID), metadata)
+}
+
+func (store *S3ImageStore) Update(image *ImageInfo) error {
+	updated, err := store.Find(image.ID)
+	if err != nil {
+		return err
+	}
+	if updated == nil {
+		return ErrNotFound
+	}
+
+	updated.updateDetails(image)
+	err = store.writeMetadata(updated)
+	if err != nil {
+		return fmt.Errorf("cannot write image metadata: %w", err)
+	}
+	return nil
+}
+
+func (store *S3ImageStore) Open(imageID string) (io.ReadCloser, error) {
+	image, err := store.Find(imageID)
+	if err != nil {
+		return nil, err
+	}
+	if image == nil {
+		return nil, ErrNotFound
+	}
+	return store.getObject(image.Path)
+}
+
+func (store *S3ImageStore) SaveRendition(imageID string, size int, data bytes.Buffer) error {
+	image, err := store.Find(imageID)
+	if err != nil {
+		return err
+	}
+	if image == nil {
+		return ErrNotFound
+	}
+
+	err = store.putObject(store.renditionKey(imageID, size), data.Bytes())
+	if err != nil {
+		return fmt.Errorf("cannot write rendition: %w", err)
+	}
+	return nil
+}
+
+func (store *S3ImageStore) OpenRendition(imageID string, size int) (io.ReadCloser, error) {
+	image, err := store.Find(imageID)
+	if err != nil {
+		return nil, err
+	}
+	if image == nil {
+		return nil, ErrNotFound
+	}
+	return store.getObject(store.renditionKey(imageID, size))
+}
+
+// RemoveAll deletes every object under the prefix of the store, along with the laptop entries.
+func (store *S3ImageStore) RemoveAll() error {
+	objects, err := store.listObjects(store.config.Prefix)
+	if err != nil {
+		return fmt.Errorf("cannot list objects: %w", err)
+	}
+	entries, err := store.listAllObjects(store.config.Prefix + s3LaptopFolder)
+	if err != nil {
+		return fmt.Errorf("cannot list laptop entries: %w", err)
+	}
+
+	for _, object := range append(objects, entries...) {
+		err := store.deleteObject(object.Key)
+		if err != nil {
+			return fmt.Errorf("cannot delete object %s: %w", object.Key, err)
+		}
+	}
+	return nil
+}
+
+func (store *S3ImageStore) Delete(imageID string) error {
+	image, err := store.Find(imageID)
+	if err != nil {
+		return err
+	}
+	if image == nil {
+		return ErrNotFound
+	}
+
+	// once the metadata is gone the image is deleted,
+	// the objects left behind by a failure are removed by the garbage collector
+	err = store.deleteObject(store.metadataKey(imageID))
+	if err != nil {
+		return fmt.Errorf("cannot remove image metadata: %w", err)
+	}
+
+	err = store.deleteObject(store.laptopKey(image.LaptopID, imageID))
+	if err != nil {
+		log.Printf("cannot remove laptop entry of image %s: %v", imageID, err)
+	}
+
+	err = store.deleteObject(image.Path)
+	if err != nil {
+		log.Printf("cannot remove content of image %s: %v", imageID, err)
+	}
+
+	renditions, err := store.listObjects(store.config.Prefix + imageID + "_")
+	if err != nil {
+		log.Printf("cannot list renditions of image %s: %v", imageID, err)
+	}
+	for _, rendition := range renditions {
+		err = store.deleteObject(rendition.Key)
+		if err != nil {
+			log.Printf("cannot remove rendition %s: %v", rendition.Key, err)
+		}
+	}
+	return nil
+}
+
+// RemoveOrphanFiles removes the objects under the prefix and the laptop entries that don't belong to an image,
+// the images being those with a metadata object in the bucket.
+// Unfinished multipart uploads are left to the lifecycle rules of the bucket.
+func (store *S3ImageStore) RemoveOrphanFiles(before time.Time, dryRun bool) ([]OrphanFile, error) {
+	objects, err := store.listObjects(store.config.Prefix)
+	if err != nil {
+		return nil, fmt.Errorf("cannot list objects: %w", err)
+	}
+	entries, err := store.listAllObjects(store.config.Prefix + s3LaptopFolder)
+	if err != nil {
+		return nil, fmt.Errorf("cannot list laptop entries: %w", err)
+	}
+
+	images := make(map[string]bool)
+	for _, object := range objects {
+		name := strings.TrimPrefix(object.Key, store.config.Prefix)
+		if strings.HasSuffix(name, metadataExt) {
+			images[strings.TrimSuffix(name, metadataExt)] = true
+		}
+	}
+
+	var orphans []OrphanFile
+	for _, object := range objects {
+		name := strings.TrimPrefix(object.Key, store.config.Prefix)
+		imageID := strings.TrimSuffix(name, metadataExt)
+		if match := s3RenditionPattern.FindStringSubmatch(name); match != nil {
+			imageID = match[1]
+		}
+		if images[imageID] || !object.LastModified.Before(before) {
+			continue
+		}
+
+		orphan, err := store.removeOrphan(object, name, dryRun)
+		if err != nil {
+			return orphans, err
+		}
+		orphans = append(orphans, orphan)
+	}
+
+	for _, entry := range entries {
+		if images[path.Base(entry.Key)] || !entry.LastModified.Before(before) {
+			continue
+		}
+
+		orphan, err := store.removeOrphan(entry, strings.TrimPrefix(entry.Key, store.config.Prefix), dryRun)
+		if err != nil {
+			return orphans, err
+		}
+		orphans = append(orphans, orphan)
+	}
+	return orphans, nil
+}
+
+func (store *S3ImageStore) removeOrphan(object s3Object, name string, dryRun bool) (OrphanFile, error) {
+	if !dryRun {
+		err := store.deleteObject(object.Key)
+		if err != nil {
+			return OrphanFile{}, fmt.Errorf("cannot remove %s: %w", object.Key, err)
+		}
+	}
+	return OrphanFile{
+		Path:    name,
+		Size:    object.Size,
+		ModTime: object.LastModified,
+	}, nil
+}
+
+// s3Object is an object listed by ListObjectsV2.
+type s3Object struct {
+	Key          string    `xml:"Key"`
+	Size         int64     `xml:"Size"`
+	LastModified time.Time `xml:"LastModified"`
+}
+
+type listBucketResult struct {
+	Contents              []s3Object `xml:"Contents"`
+	IsTruncated           bool       `xml:"IsTruncated"`
+	NextContinuationToken string     `xml:"NextContinuationToken"`
+}
+
+type initiateMultipartUploadResult struct {
+	UploadID string `xml:"UploadId"`
+}
+
+type completedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+type completeMultipartUpload struct {
+	XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+	Parts   []completedPart `xml:"Part"`
+}
+
+// listObjects returns the objects whose key starts with the prefix, without going into sub-folders.
+func (store *S3ImageStore) listObjects(prefix string) ([]s3Object, error) {
+	return store.list(url.Values{
+		"list-type": {"2"},
+		"prefix":    {prefix},
+		"delimiter": {"/"},
+	})
+}
+
+// listAllObjects returns the objects whose key starts with the prefix, including those of sub-folders.
+func (store *S3ImageStore) listAllObjects(prefix string) ([]s3Object, error) {
+	return store.list(url.Values{
+		"list-type": {"2"},
+		"prefix":    {prefix},
+	})
+}
+
+func (store *S3ImageStore) list(query url.Values) ([]s3Object, error) {
+	var objects []s3Object
+
+	for {
+		res, err := store.do(http.MethodGet, "", query, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		result := &listBucketResult{}
+		err = decodeXMLResponse(res, result)
+		if err != nil {
+			return nil, err
+		}
+
+		objects = append(objects, result.Contents...)
+		if !result.IsTruncated {
+			return objects, nil
+		}
+		query.Set("continuation-token", result.NextContinuationToken)
+	}
+}
+
+func (store *S3ImageStore) getObject(key string) (io.ReadCloser, error) {
+	res, err := store.do(http.MethodGet, key, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return res.Body, nil
+}
+
+func (store *S3ImageStore) putObject(key string, data []byte) error {
+	res, err := store.do(http.MethodPut, key, nil, data)
+	if err != nil {
+		return err
+	}
+	return res.Body.Close()
+}
+
+// deleteObject removes the object, deleting a missing object succeeds.
+func (store *S3ImageStore) deleteObject(key string) error {
+	res, err := store.do(http.MethodDelete, key, nil, nil)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return res.Body.Close()
+}
+
+// do sends a signed request for the object with the key, or for the bucket if the key is empty.
+// An error response is returned as an *S3Error, otherwise the caller closes the body.
+func (store *S3ImageStore) do(method string, key string, query url.Values, body []byte) (*http.Response, error) {
+	target, err := url.Parse(store.config.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid s3 endpoint: %w", err)
+	}
+
+	path := "/" + store.config.Bucket
+	if key != "" {
+		path += "/" + key
+	}
+	target.Path += path
+	target.RawPath = ""
+	target.RawQuery = canonicalQuery(query)
+
+	req, err := http.NewRequest(method, target.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	SignV4(req, store.config.Credentials, store.config.Region, PayloadHash(body), time.Now())
+
+	res, err := store.config.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode >= 300 {
+		return nil, readS3Error(res)
+	}
+	return res, nil
+}
+
+func readS3Error(res *http.Response) error {
+	defer res.Body.Close()
+
+	s3Err := &S3Error{StatusCode: res.StatusCode}
+	data, _ := io.ReadAll(io.LimitReader(res.Body, 64<<10))
+	if xml.Unmarshal(data, s3Err) != nil || s3Err.Code == "" {
+		s3Err.Code = http.StatusText(res.StatusCode)
+	}
+	return s3Err
+}
+
+// decodeXMLResponse decodes the body into v, S3 may report an error in a successful response.
+func decodeXMLResponse(res *http.Response, v any) error {
+	defer res.Body.Close()
+
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+
+	s3Err := &S3Error{StatusCode: res.StatusCode}
+	if xml.Unmarshal(data, s3Err) == nil && s3Err.Code != "" {
+		return s3Err
+	}
+	return xml.Unmarshal(data, v)
+}
+
+// s3ImageWriter keeps the content in memory until it's larger than a part,
+// it then uploads the content in parts of a multipart upload.
+type s3ImageWriter struct {
+	store    *S3ImageStore
+	imageID  string
+	hash     hash.Hash
+	size     int64
+	buffer   bytes.Buffer
+	uploadID string
+	parts    []completedPart
+	done     bool
+}
+
+func (writer *s3ImageWriter) Write(p []byte) (int, error) {
+	if writer.done {
+		return 0, errImageWriterDone
+	}
+
+	writer.buffer.Write(p)
+	writer.hash.Write(p)
+	writer.size += int64(len(p))
+
+	partSize := int(writer.store.config.PartSize)
+	for writer.buffer.Len() >= partSize {
+		err := writer.uploadPart(writer.buffer.Next(partSize))
+		if err != nil {
+			return len(p), err
+		}
+	}
+	return len(p), nil
+}
+
+func (writer *s3ImageWriter) uploadPart(data []byte) error {
+	store := writer.store
+	key := store.contentKey(writer.imageID)
+
+	if writer.uploadID == "" {
+		res, err := store.do(http.MethodPost, key, url.Values{"uploads": {""}}, nil)
+		if err != nil {
+			return fmt.Errorf("cannot start multipart upload: %w", err)
+		}
+
+		result := &initiateMultipartUploadResult{}
+		err = decodeXMLResponse(res, result)
+		if err != nil {
+			return fmt.Errorf("cannot start multipart upload: %w", err)
+		}
+		writer.uploadID = result.UploadID
+	}
+
+	partNumber := len(writer.parts) + 1
+	res, err := store.do(http.MethodPut, key, url.Values{
+		"partNumber": {strconv.Itoa(partNumber)},
+		"uploadId":   {writer.uploadID},
+	}, data)
+	if err != nil {
+		return fmt.Errorf("cannot upload part %d: %w", partNumber, err)
+	}
+	res.Body.Close()
+
+	writer.parts = append(writer.parts, completedPart{
+		PartNumber: partNumber,
+		ETag:       res.Header.Get("ETag"),
+	})
+	return nil
+}
+
+func (writer *s3ImageWriter) Size() int64 {
+	return writer.size
+}
+
+func (writer *s3ImageWriter) Digest() string {
+	return hex.EncodeToString(writer.hash.Sum(nil))
+}
+
+func (writer *s3ImageWriter) Commit(info *ImageInfo) (string, error) {
+	if writer.done {
+		return "", errImageWriterDone
+	}
+
+	store := writer.store
+	image := info.Clone()
+	image.ID = writer.imageID
+	image.Path = store.contentKey(writer.imageID)
+	image.Size = writer.size
+	image.Digest = writer.Digest()
+	image.CreatedAt = time.Now().UTC()
+
+	err := writer.complete()
+	writer.done = true
+	if err != nil {
+		writer.abortUpload()
+		return "", fmt.Errorf("cannot write image content: %w", err)
+	}
+
+	// the metadata is written last, the content and laptop entry without it are orphans
+	laptopKey := store.laptopKey(image.LaptopID, image.ID)
+	err = store.putObject(laptopKey, nil)
+	if err == nil {
+		err = store.writeMetadata(image)
+	}
+	if err != nil {
+		store.deleteObject(laptopKey)
+		store.deleteObject(image.Path)
+		return "", fmt.Errorf("cannot write image metadata: %w", err)
+	}
+	return image.ID, nil
+}
+
+// complete uploads the rest of the content, completing the multipart upload if there is one.
+func (writer *s3ImageWriter) complete() error {
+	store := writer.store
+	key := store.contentKey(writer.imageID)
+
+	if writer.uploadID == "" {
+		return store.putObject(key, writer.buffer.Bytes())
+	}
+
+	if writer.buffer.Len() > 0 {
+		err := writer.uploadPart(writer.buffer.Bytes())
+		if err != nil {
+			return err
+		}
+		writer.buffer.Reset()
+	}
+
+	body, err := xml.Marshal(completeMultipartUpload{Parts: writer.parts})
+	if err != nil {
+		return err
+	}
+
+	res, err := store.do(http.MethodPost, key, url.Values{"uploadId": {writer.uploadID}}, body)
+	if err != nil {
+		return fmt.Errorf("cannot complete multipart upload: %w", err)
+	}
+	return decodeXMLResponse(res, &struct{}{})
+}
+
+func (writer *s3ImageWriter) Abort() error {
+	if writer.done {
+		return nil
+	}
+	writer.done = true
+
+	return writer.abortUpload()
+}
+
+func (writer *s3ImageWriter) abortUpload() error {
+	writer.buffer.Reset()
+	if writer.uploadID == "" {
+		return nil
+	}
+
+	store := writer.store
+	res, err := store.do(http.MethodDelete, store.contentKey(writer.imageID), url.Values{"uploadId": {writer.uploadID}}, nil)
+	if err != nil {
+		return fmt.Errorf("cannot abort multipart upload: %w", err)
+	}
+	return res.Body.Close()
+}
@@ -0,0 +1,56 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// DefaultScoreRange rates laptops from 1 to 10 in half points.
+var DefaultScoreRange = ScoreRange{Min: 1, Max: 10, Step: 0.5}
+
+// ErrInvalidScore is returned for a score out of the range or off its steps.
+var ErrInvalidScore = errors.New("invalid score")
+
+// ScoreRange are the scores users can give, from Min to Max in multiples of Step above Min.
+// A Step of 0 allows any score within the range.
+type ScoreRange struct {
+	Min  float64
+	Max  float64
+	Step float64
+}
+
+// NewScoreRange checks that the range isn't empty and the step is positive.
+func NewScoreRange(min float64, max float64, step float64) (ScoreRange, error) {
+	scoreRange := ScoreRange{Min: min, Max: max, Step: step}
+	for _, value := range []float64{min, max, step} {
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			return scoreRange, fmt.Errorf("score range bounds and step must be finite")
+		}
+	}
+	if min > max {
+		return scoreRange, fmt.Errorf("minimum score %g is above the maximum %g", min, max)
+	}
+	if step < 0 {
+		return scoreRange, fmt.Errorf("score step %g is negative", step)
+	}
+	return scoreRange, nil
+}
+
+// Check returns ErrInvalidScore when the score isn't one of the range.
+func (scoreRange ScoreRange) Check(score float64) error {
+	if math.IsNaN(score) || math.IsInf(score, 0) {
+		return fmt.Errorf("%w: %g is not a number", ErrInvalidScore, score)
+	}
+	if score < scoreRange.Min || score > scoreRange.Max {
+		return fmt.Errorf("%w: %g is not between %g and %g", ErrInvalidScore, score, scoreRange.Min, scoreRange.Max)
+	}
+	if scoreRange.Step > 0 {
+		steps := (score - scoreRange.Min) / scoreRange.Step
+		// tolerates the rounding of decimal steps such as 0.1
+		if math.Abs(steps-math.Round(steps)) > 1e-9 {
+			return fmt.Errorf("%w: %g is not a multiple of %g above %g", ErrInvalidScore, score, scoreRange.Step, scoreRange.Min)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,306 @@
+package service
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"sync"
+
+	"github.com/Dostonlv/pcbook/pb"
+)
+
+const DefaultShardCount = 16
+
+// ShardedLaptopStore partitions laptops across shards by a hash of their ID,
+// so that writes to different shards don't contend for the same lock.
+type ShardedLaptopStore struct {
+	shards []*laptopShard
+}
+
+type laptopShard struct {
+	mutex sync.RWMutex
+	data  map[string]*pb.Laptop
+}
+
+func NewShardedLaptopStore(shardCount int) *ShardedLaptopStore {
+	if shardCount <= 0 {
+		shardCount = DefaultShardCount
+	}
+
+	shards := make([]*laptopShard, shardCount)
+	for i := range shards {
+		shards[i] = &laptopShard{
+			data: make(map[string]*pb.Laptop),
+		}
+	}
+	return &ShardedLaptopStore{shards: shards}
+}
+
+func (store *ShardedLaptopStore) shardFor(id string) *laptopShard {
+	hash := fnv.New32a()
+	hash.Write([]byte(id))
+	return store.shards[hash.Sum32()%uint32(len(store.shards))]
+}
+
+func (store *ShardedLaptopStore) Save(laptop *pb.Laptop) error {
+	shard := store.shardFor(laptop.Id)
+
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+
+	if shard.data[laptop.Id] != nil {
+		return ErrAlreadyExists
+	}
+
+	other, err := deepCopy(laptop)
+	if err != nil {
+		return err
+	}
+	shard.data[laptop.Id] = other
+	return nil
+}
+
+func (store *ShardedLaptopStore) Find(id string) (*pb.Laptop, error) {
+	shard := store.shardFor(id)
+
+	shard.mutex.RLock()
+	defer shard.mutex.RUnlock()
+
+	laptop := shard.data[id]
+	if laptop == nil {
+		return nil, nil
+	}
+	return deepCopy(laptop)
+}
+
+func (store *ShardedLaptopStore) Delete(id string) error {
+	shard := store.shardFor(id)
+
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+
+	if shard.data[id] == nil {
+		return ErrNotFound
+	}
+	delete(shard.data, id)
+	return nil
+}
+
+// Search scans all shards in parallel and calls found from the calling goroutine only.
+// If the filter requests sorting, every shard sorts its own matches and the
+// results are merged, so laptops are delivered in the requested order.
+func (store *ShardedLaptopStore) Search(
+	ctx context.Context,
+	filter *pb.Filter,
+	found func(laptop *pb.Laptop) error,
+) error {
+	if ctx.Err() != nil {
+		return fmt.Errorf("search cancelled: %w", ctx.Err())
+	}
+
+	searchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	less := laptopLess(filter)
+	results := make([]chan *pb.Laptop, len(store.shards))
+	errs := make(chan error, len(store.shards))
+
+	wg := sync.WaitGroup{}
+	for i, shard := range store.shards {
+		results[i] = make(chan *pb.Laptop)
+		wg.Add(1)
+		go func(shard *laptopShard, out chan<- *pb.Laptop) {
+			defer wg.Done()
+			defer close(out)
+			errs <- shard.search(searchCtx, filter, less, out)
+		}(shard, results[i])
+	}
+
+	var err error
+	if less == nil {
+		err = receiveUnordered(searchCtx, results, found)
+	} else {
+		err = receiveOrdered(searchCtx, results, less, found)
+	}
+
+	cancel()
+	wg.Wait()
+	close(errs)
+
+	if err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("search cancelled: %w", ctx.Err())
+		}
+		return err
+	}
+	for shardErr := range errs {
+		if shardErr != nil {
+			return shardErr
+		}
+	}
+	return nil
+}
+
+func (shard *laptopShard) search(
+	ctx context.Context,
+	filter *pb.Filter,
+	less func(laptop1, laptop2 *pb.Laptop) bool,
+	out chan<- *pb.Laptop,
+) error {
+	matched, err := shard.match(filter)
+	if err != nil {
+		return err
+	}
+
+	if less != nil {
+		sort.SliceStable(matched, func(i, j int) bool {
+			return less(matched[i], matched[j])
+		})
+	}
+
+	for _, laptop := range matched {
+		select {
+		case out <- laptop:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+func (shard *laptopShard) match(filter *pb.Filter) ([]*pb.Laptop, error) {
+	shard.mutex.RLock()
+	defer shard.mutex.RUnlock()
+
+	var matched []*pb.Laptop
+	for _, laptop := range shard.data {
+		if !isQualified(filter, laptop) {
+			continue
+		}
+
+		other, err := deepCopy(laptop)
+		if err != nil {
+			return nil, err
+		}
+		matched = append(matched, other)
+	}
+	return matched, nil
+}
+
+func receiveUnordered(ctx context.Context, results []chan *pb.Laptop, found func(laptop *pb.Laptop) error) error {
+	merged := make(chan *pb.Laptop)
+
+	wg := sync.WaitGroup{}
+	for _, result := range results {
+		wg.Add(1)
+		go func(result <-chan *pb.Laptop) {
+			defer wg.Done()
+			for laptop := range result {
+				select {
+				case merged <- laptop:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}(result)
+	}
+	go func() {
+		wg.Wait()
+		close(merged)
+	}()
+
+	for {
+		select {
+		case laptop, ok := <-merged:
+			if !ok {
+				return nil
+			}
+			err := found(laptop)
+			if err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func receiveOrdered(
+	ctx context.Context,
+	results []chan *pb.Laptop,
+	less func(laptop1, laptop2 *pb.Laptop) bool,
+	found func(laptop *pb.Laptop) error,
+) error {
+	heads := &laptopHeap{less: less}
+
+	next := func(shard int) error {
+		select {
+		case laptop, ok := <-results[shard]:
+			if ok {
+				heap.Push(heads, laptopHead{laptop: laptop, shard: shard})
+			}
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	for shard := range results {
+		err := next(shard)
+		if err != nil {
+			return err
+		}
+	}
+
+	for heads.Len() > 0 {
+		head := heap.Pop(heads).(laptopHead)
+		err := found(head.laptop)
+		if err != nil {
+			return err
+		}
+
+		err = next(head.shard)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type laptopHead struct {
+	laptop *pb.Laptop
+	shard  int
+}
+
+// laptopHeap holds the next laptop of every shard, ordered by less.
+// Ties are broken by shard index to keep the merge deterministic.
+type laptopHeap struct {
+	heads []laptopHead
+	less  func(laptop1, laptop2 *pb.Laptop) bool
+}
+
+func (h *laptopHeap) Len() int { return len(h.heads) }
+
+func (h *laptopHeap) Less(i, j int) bool {
+	if h.less(h.heads[i].laptop, h.heads[j].laptop) {
+		return true
+	}
+	if h.less(h.heads[j].laptop, h.heads[i].laptop) {
+		return false
+	}
+	return h.heads[i].shard < h.heads[j].shard
+}
+
+func (h *laptopHeap) Swap(i, j int) { h.heads[i], h.heads[j] = h.heads[j], h.heads[i] }
+
+func (h *laptopHeap) Push(x any) { h.heads = append(h.heads, x.(laptopHead)) }
+
+func (h *laptopHeap) Pop() any {
+	old := h.heads
+	n := len(old)
+	head := old[n-1]
+	h.heads = old[:n-1]
+	return head
+}
@@ -0,0 +1,72 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Dostonlv/pcbook/pb"
+	"github.com/Dostonlv/pcbook/sample"
+	"github.com/Dostonlv/pcbook/service"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShardedLaptopStoreSearchSorted(t *testing.T) {
+	t.Parallel()
+
+	store := service.NewShardedLaptopStore(4)
+	for i := 0; i < 50; i++ {
+		err := store.Save(sample.NewLaptop())
+		require.NoError(t, err)
+	}
+
+	filter := &pb.Filter{
+		MaxPriceUsd: 5000,
+		SortBy:      pb.Filter_PRICE,
+		Descending:  true,
+	}
+
+	var prices []float64
+	err := store.Search(context.Background(), filter, func(laptop *pb.Laptop) error {
+		prices = append(prices, laptop.GetPriceUsd())
+		return nil
+	})
+	require.NoError(t, err)
+	require.Len(t, prices, 50)
+
+	for i := 1; i < len(prices); i++ {
+		require.GreaterOrEqual(t, prices[i-1], prices[i])
+	}
+}
+
+func TestShardedLaptopStoreSearchStops(t *testing.T) {
+	t.Parallel()
+
+	store := service.NewShardedLaptopStore(4)
+	for i := 0; i < 50; i++ {
+		err := store.Save(sample.NewLaptop())
+		require.NoError(t, err)
+	}
+
+	filter := &pb.Filter{MaxPriceUsd: 5000}
+	errStop := errors.New("stop")
+
+	count := 0
+	err := store.Search(context.Background(), filter, func(laptop *pb.Laptop) error {
+		count++
+		if count == 3 {
+			return errStop
+		}
+		return nil
+	})
+	require.ErrorIs(t, err, errStop)
+	require.Equal(t, 3, count)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err = store.Search(ctx, filter, func(laptop *pb.Laptop) error {
+		return nil
+	})
+	require.ErrorIs(t, err, context.Canceled)
+}
@@ -0,0 +1,177 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"sync"
+)
+
+const DefaultTenant = "default"
+
+var ErrInvalidTenant = errors.New("invalid tenant name")
+
+var tenantPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,62}$`)
+
+// Catalog groups the stores holding the data of a single tenant.
+type Catalog struct {
+	laptopStore LaptopStore
+	imageStore  ImageStore
+	ratingStore RatingStore
+	reviewStore ReviewStore
+	quarantine  *RatingQuarantine
+	// ratingPublisher gets the rating changes made through uow.
+	ratingPublisher *RatingPublisher
+	// imageMeter keeps the image usage up to date with the changes made through uow.
+	imageMeter *ImageMeter
+	uow        *UnitOfWork
+}
+
+// NewCatalog creates the catalog of a tenant, its reviews are kept in memory. The quarantined ratings
+// are logged by the rating store if it's a QuarantineLog, otherwise they are kept in memory too.
+func NewCatalog(laptopStore LaptopStore, imageStore ImageStore, ratingStore RatingStore) *Catalog {
+	quarantineLog, _ := ratingStore.(QuarantineLog)
+	ratingPublisher := NewRatingPublisher()
+	imageMeter := NewImageMeter(imageStore)
+	uow := NewUnitOfWork(laptopStore, imageStore, NewPublishingRatingStore(ratingStore, ratingPublisher))
+	uow.imageMeter = imageMeter
+	return &Catalog{
+		laptopStore:     laptopStore,
+		imageStore:      imageStore,
+		ratingStore:     ratingStore,
+		reviewStore:     NewInMemoryReviewStore(),
+		quarantine:      NewRatingQuarantine(quarantineLog),
+		ratingPublisher: ratingPublisher,
+		imageMeter:      imageMeter,
+		uow:             uow,
+	}
+}
+
+// RemovableStore is implemented by the stores keeping their data in files or objects.
+// RemoveAll deletes all of it when the tenant of the store is deleted, the store can't be used afterwards.
+type RemovableStore interface {
+	RemoveAll() error
+}
+
+// removeAll deletes the data of the stores, so that a tenant created later with the same name starts empty.
+func (catalog *Catalog) removeAll() error {
+	for _, store := range []any{catalog.laptopStore, catalog.imageStore, catalog.ratingStore} {
+		if store, ok := store.(RemovableStore); ok {
+			err := store.RemoveAll()
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// renditionStore returns the image store metering the renditions saved to it.
+func (catalog *Catalog) renditionStore() ImageStore {
+	return &meteredRenditionStore{ImageStore: catalog.imageStore, meter: catalog.imageMeter}
+}
+
+// TenantCatalogs keeps a separate catalog for every tenant,
+// so that a tenant never sees the data of another one.
+type TenantCatalogs struct {
+	mutex      sync.RWMutex
+	newCatalog func(tenant string) (*Catalog, error)
+	catalogs   map[string]*Catalog
+}
+
+// NewTenantCatalogs creates the registry with the default tenant already in it.
+// newCatalog is called to create the stores of every new tenant,
+// if it's nil, no other tenant can be created.
+func NewTenantCatalogs(defaultCatalog *Catalog, newCatalog func(tenant string) (*Catalog, error)) *TenantCatalogs {
+	return &TenantCatalogs{
+		newCatalog: newCatalog,
+		catalogs: map[string]*Catalog{
+			DefaultTenant: defaultCatalog,
+		},
+	}
+}
+
+func ValidateTenant(tenant string) error {
+	if !tenantPattern.MatchString(tenant) {
+		return fmt.Errorf("%w: %q", ErrInvalidTenant, tenant)
+	}
+	return nil
+}
+
+func (tenants *TenantCatalogs) Create(tenant string) error {
+	err := ValidateTenant(tenant)
+	if err != nil {
+		return err
+	}
+	if tenants.newCatalog == nil {
+		return errors.New("cannot create tenants on this server")
+	}
+
+	tenants.mutex.Lock()
+	defer tenants.mutex.Unlock()
+
+	if tenants.catalogs[tenant] != nil {
+		return ErrAlreadyExists
+	}
+
+	catalog, err := tenants.newCatalog(tenant)
+	if err != nil {
+		return fmt.Errorf("cannot create catalog for tenant %s: %w", tenant, err)
+	}
+	tenants.catalogs[tenant] = catalog
+	return nil
+}
+
+func (tenants *TenantCatalogs) Find(tenant string) *Catalog {
+	tenants.mutex.RLock()
+	defer tenants.mutex.RUnlock()
+
+	return tenants.catalogs[tenant]
+}
+
+// Delete removes the catalog of the tenant along with the data of its stores.
+func (tenants *TenantCatalogs) Delete(tenant string) error {
+	if tenant == DefaultTenant {
+		return errors.New("cannot delete the default tenant")
+	}
+
+	tenants.mutex.Lock()
+	defer tenants.mutex.Unlock()
+
+	catalog := tenants.catalogs[tenant]
+	if catalog == nil {
+		return ErrNotFound
+	}
+
+	// the catalog stays until its data is gone, so that the deletion can be retried
+	err := catalog.removeAll()
+	if err != nil {
+		return fmt.Errorf("cannot remove data of tenant %s: %w", tenant, err)
+	}
+	delete(tenants.catalogs, tenant)
+	return nil
+}
+
+func (tenants *TenantCatalogs) List() []string {
+	tenants.mutex.RLock()
+	defer tenants.mutex.RUnlock()
+
+	names := make([]string, 0, len(tenants.catalogs))
+	for tenant := range tenants.catalogs {
+		names = append(names, tenant)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// TenantFromContext returns the tenant of the authenticated user,
+// or the default tenant if the request is anonymous.
+func TenantFromContext(ctx context.Context) string {
+	claims := ClaimsFromContext(ctx)
+	if claims == nil || claims.Tenant == "" {
+		return DefaultTenant
+	}
+	return claims.Tenant
+}
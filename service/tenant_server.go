@@ -0,0 +1,129 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/Dostonlv/pcbook/pb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type TenantServer struct {
+	pb.UnimplementedTenantServiceServer
+	tenants   *TenantCatalogs
+	userStore UserStore
+}
+
+func NewTenantServer(tenants *TenantCatalogs, userStore UserStore) *TenantServer {
+	return &TenantServer{
+		tenants:   tenants,
+		userStore: userStore,
+	}
+}
+
+// RestoreTenants creates the catalog of every tenant having users. The catalogs are only kept in memory,
+// while the users may be persisted, so it's called when the server starts to bring the tenants back.
+// A tenant always has users: its admin is created along with it, and its users are deleted before it.
+func RestoreTenants(tenants *TenantCatalogs, userStore UserStore) error {
+	names, err := userStore.Tenants()
+	if err != nil {
+		return fmt.Errorf("cannot list tenants of users: %w", err)
+	}
+
+	for _, tenant := range names {
+		if tenants.Find(tenant) != nil {
+			continue
+		}
+		err := tenants.Create(tenant)
+		if err != nil {
+			return fmt.Errorf("cannot restore tenant %s: %w", tenant, err)
+		}
+	}
+	return nil
+}
+
+func (server *TenantServer) CreateTenant(ctx context.Context, req *pb.CreateTenantRequest) (*pb.CreateTenantResponse, error) {
+	tenant := req.GetName()
+	log.Printf("receive a create-tenant request with name: %s", tenant)
+
+	if err := ValidateTenant(tenant); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+	if req.GetAdminUsername() == "" || req.GetAdminPassword() == "" {
+		return nil, status.Error(codes.InvalidArgument, "admin username and password are required")
+	}
+
+	admin, err := NewUser(tenant, req.GetAdminUsername(), req.GetAdminPassword(), "admin")
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot create admin user: %v", err)
+	}
+
+	err = server.tenants.Create(tenant)
+	if err != nil {
+		code := codes.Internal
+		if errors.Is(err, ErrAlreadyExists) {
+			code = codes.AlreadyExists
+		}
+		return nil, errorLog(status.Errorf(code, "cannot create tenant: %v", err))
+	}
+
+	err = server.userStore.Save(admin)
+	if err != nil {
+		// a tenant without users would be lost on restart, see RestoreTenants
+		if deleteErr := server.tenants.Delete(tenant); deleteErr != nil {
+			log.Printf("cannot delete tenant %s without admin: %v", tenant, deleteErr)
+		}
+
+		code := codes.Internal
+		if errors.Is(err, ErrAlreadyExists) {
+			code = codes.AlreadyExists
+		}
+		return nil, errorLog(status.Errorf(code, "cannot save admin user: %v", err))
+	}
+
+	log.Printf("created tenant: %s", tenant)
+	return &pb.CreateTenantResponse{Name: tenant}, nil
+}
+
+func (server *TenantServer) ListTenants(ctx context.Context, req *pb.ListTenantsRequest) (*pb.ListTenantsResponse, error) {
+	return &pb.ListTenantsResponse{Names: server.tenants.List()}, nil
+}
+
+func (server *TenantServer) DeleteTenant(ctx context.Context, req *pb.DeleteTenantRequest) (*pb.DeleteTenantResponse, error) {
+	tenant := req.GetName()
+	log.Printf("receive a delete-tenant request with name: %s", tenant)
+
+	if tenant == DefaultTenant {
+		return nil, errorLog(status.Error(codes.InvalidArgument, "cannot delete the default tenant"))
+	}
+	if server.tenants.Find(tenant) == nil {
+		return nil, errorLog(status.Errorf(codes.NotFound, "tenant %s is not found", tenant))
+	}
+
+	// the users go first, as a tenant having users is restored on restart
+	users, err := server.userStore.List(tenant)
+	if err != nil {
+		return nil, errorLog(status.Errorf(codes.Internal, "cannot list tenant users: %v", err))
+	}
+	for _, user := range users {
+		err := server.userStore.Delete(tenant, user.Username)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return nil, errorLog(status.Errorf(codes.Internal, "cannot delete tenant user: %v", err))
+		}
+	}
+
+	err = server.tenants.Delete(tenant)
+	if err != nil {
+		code := codes.Internal
+		if errors.Is(err, ErrNotFound) {
+			code = codes.NotFound
+		}
+		return nil, errorLog(status.Errorf(code, "cannot delete tenant: %v", err))
+	}
+
+	log.Printf("deleted tenant: %s", tenant)
+	return &pb.DeleteTenantResponse{}, nil
+}
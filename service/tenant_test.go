@@ -0,0 +1,153 @@
+package service_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Dostonlv/pcbook/pb"
+	"github.com/Dostonlv/pcbook/sample"
+	"github.com/Dostonlv/pcbook/service"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func newTestCatalog(tenant string) (*service.Catalog, error) {
+	return service.NewCatalog(
+		service.NewInMemoryLaptopStore(),
+		nil,
+		service.NewInMemoryRatingStore(),
+	), nil
+}
+
+func TestTenantIsolation(t *testing.T) {
+	t.Parallel()
+
+	defaultCatalog, err := newTestCatalog(service.DefaultTenant)
+	require.NoError(t, err)
+
+	tenants := service.NewTenantCatalogs(defaultCatalog, newTestCatalog)
+	require.NoError(t, tenants.Create("acme"))
+	require.ErrorIs(t, tenants.Create("acme"), service.ErrAlreadyExists)
+	require.ErrorIs(t, tenants.Create("../etc"), service.ErrInvalidTenant)
+	require.Equal(t, []string{"acme", service.DefaultTenant}, tenants.List())
+
+	jwtManager := service.NewJWTManager("secret", time.Minute)
+	user, err := service.NewUser("acme", "admin1", "secret", "admin")
+	require.NoError(t, err)
+	token, err := jwtManager.Generate(user)
+	require.NoError(t, err)
+	claims, err := jwtManager.Verify(token)
+	require.NoError(t, err)
+	require.Equal(t, "acme", claims.Tenant)
+
+	server := service.NewMultiTenantLaptopServer(tenants)
+	acmeCtx := service.ContextWithClaims(context.Background(), claims)
+
+	laptop := sample.NewLaptop()
+	_, err = server.CreateLaptop(acmeCtx, &pb.CreateLaptopRequest{Laptop: laptop})
+	require.NoError(t, err)
+
+	_, err = server.DeleteLaptop(context.Background(), &pb.DeleteLaptopRequest{Id: laptop.Id})
+	require.Equal(t, codes.NotFound, status.Code(err))
+
+	ghostCtx := service.ContextWithClaims(context.Background(), &service.UserClaims{Tenant: "ghost"})
+	_, err = server.DeleteLaptop(ghostCtx, &pb.DeleteLaptopRequest{Id: laptop.Id})
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	_, err = server.DeleteLaptop(acmeCtx, &pb.DeleteLaptopRequest{Id: laptop.Id})
+	require.NoError(t, err)
+}
+
+func TestTenantServerKeepsTenantsWithUsers(t *testing.T) {
+	t.Parallel()
+
+	defaultCatalog, err := newTestCatalog(service.DefaultTenant)
+	require.NoError(t, err)
+	tenants := service.NewTenantCatalogs(defaultCatalog, newTestCatalog)
+	userStore := service.NewInMemoryUserStore()
+	server := service.NewTenantServer(tenants, userStore)
+
+	// a leftover user makes the creation fail, which must not leave a tenant without admin
+	leftover, err := service.NewUser("acme", "admin1", "secret", "user")
+	require.NoError(t, err)
+	require.NoError(t, userStore.Save(leftover))
+	_, err = server.CreateTenant(context.Background(), &pb.CreateTenantRequest{Name: "acme", AdminUsername: "admin1", AdminPassword: "secret"})
+	require.Equal(t, codes.AlreadyExists, status.Code(err))
+	require.Equal(t, []string{service.DefaultTenant}, tenants.List())
+	require.NoError(t, userStore.Delete("acme", "admin1"))
+
+	_, err = server.CreateTenant(context.Background(), &pb.CreateTenantRequest{Name: "acme", AdminUsername: "admin1", AdminPassword: "secret"})
+	require.NoError(t, err)
+
+	// the catalogs are lost on restart, the users aren't
+	restarted := service.NewTenantCatalogs(defaultCatalog, newTestCatalog)
+	require.NoError(t, service.RestoreTenants(restarted, userStore))
+	require.Equal(t, []string{"acme", service.DefaultTenant}, restarted.List())
+
+	_, err = service.NewTenantServer(restarted, userStore).DeleteTenant(context.Background(), &pb.DeleteTenantRequest{Name: "acme"})
+	require.NoError(t, err)
+	require.Equal(t, []string{service.DefaultTenant}, restarted.List())
+
+	restarted = service.NewTenantCatalogs(defaultCatalog, newTestCatalog)
+	require.NoError(t, service.RestoreTenants(restarted, userStore))
+	require.Equal(t, []string{service.DefaultTenant}, restarted.List())
+
+	_, err = server.DeleteTenant(context.Background(), &pb.DeleteTenantRequest{Name: service.DefaultTenant})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestTenantServerDeletesTenantData(t *testing.T) {
+	t.Parallel()
+
+	folder := t.TempDir()
+	var imageStore *service.DiskImageStore
+	var ratingStore *service.FileRatingStore
+	newCatalog := func(tenant string) (*service.Catalog, error) {
+		imageFolder := filepath.Join(folder, "img", tenant)
+		err := os.MkdirAll(imageFolder, 0755)
+		if err != nil {
+			return nil, err
+		}
+
+		imageStore, err = service.OpenDiskImageStore(imageFolder)
+		if err != nil {
+			return nil, err
+		}
+		ratingStore, err = service.NewFileRatingStore(filepath.Join(folder, tenant+".jsonl"))
+		if err != nil {
+			return nil, err
+		}
+		return service.NewCatalog(service.NewInMemoryLaptopStore(), imageStore, ratingStore), nil
+	}
+
+	defaultCatalog, err := newTestCatalog(service.DefaultTenant)
+	require.NoError(t, err)
+	server := service.NewTenantServer(service.NewTenantCatalogs(defaultCatalog, newCatalog), service.NewInMemoryUserStore())
+	createTenant := func() {
+		_, err := server.CreateTenant(context.Background(), &pb.CreateTenantRequest{Name: "acme", AdminUsername: "admin1", AdminPassword: "secret"})
+		require.NoError(t, err)
+	}
+
+	createTenant()
+	_, err = imageStore.Save(&service.ImageInfo{LaptopID: "laptop1", Type: ".png"}, *bytes.NewBuffer(newTestPNG(t, 10, 10)))
+	require.NoError(t, err)
+	_, _, err = ratingStore.Add("laptop1", "admin1", 8, time.Now())
+	require.NoError(t, err)
+
+	_, err = server.DeleteTenant(context.Background(), &pb.DeleteTenantRequest{Name: "acme"})
+	require.NoError(t, err)
+
+	// a tenant created with the same name doesn't get the data of the deleted one
+	createTenant()
+	images, err := imageStore.ListAll()
+	require.NoError(t, err)
+	require.Empty(t, images)
+	rating, err := ratingStore.Find("laptop1")
+	require.NoError(t, err)
+	require.Nil(t, rating)
+}
@@ -0,0 +1,169 @@
+package service
+
+import (
+	"log"
+	"math"
+	"sort"
+
+	"github.com/Dostonlv/pcbook/pb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	DefaultTopRatedLimit = 10
+	maxTopRatedLimit     = 100
+)
+
+type rankedLaptop struct {
+	laptop     *pb.Laptop
+	aggregates *RatingAggregates
+	score      float64
+}
+
+// TopRatedLaptops joins the laptops matching the filter with their ratings,
+// and streams the best ones from the highest score.
+func (server *LaptopServer) TopRatedLaptops(req *pb.TopRatedLaptopsRequest, stream pb.LaptopService_TopRatedLaptopsServer) error {
+	log.Printf("receive a top-rated-laptops request with filter: %v, limit: %d, rank by: %v", req.GetFilter(), req.GetLimit(), req.GetRankBy())
+
+	limit := int(req.GetLimit())
+	if limit == 0 {
+		limit = DefaultTopRatedLimit
+	}
+	if limit > maxTopRatedLimit {
+		return errorLog(status.Errorf(codes.InvalidArgument, "cannot rank more than %d laptops", maxTopRatedLimit))
+	}
+	minRatingCount := req.GetMinRatingCount()
+	if minRatingCount == 0 {
+		minRatingCount = 1
+	}
+
+	catalog, err := server.catalog(stream.Context())
+	if err != nil {
+		return err
+	}
+
+	// the laptops are ranked by rating, so sorting the matches would be wasted
+	filter := &pb.Filter{MaxPriceUsd: math.MaxFloat64}
+	if req.GetFilter() != nil {
+		filter = proto.Clone(req.GetFilter()).(*pb.Filter)
+	}
+	filter.SortBy = pb.Filter_UNSORTED
+
+	prior := server.ratingPrior()
+	var ranked []rankedLaptop
+	err = catalog.laptopStore.Search(stream.Context(), filter, func(laptop *pb.Laptop) error {
+		aggregates, err := catalog.ratingStore.FindAggregates(laptop.GetId())
+		if err != nil {
+			return err
+		}
+		if aggregates == nil || aggregates.Count < minRatingCount {
+			return nil
+		}
+
+		score := aggregates.BayesianAverage(prior)
+		switch req.GetRankBy() {
+		case pb.TopRatedLaptopsRequest_AVERAGE:
+			score = aggregates.Average()
+		case pb.TopRatedLaptopsRequest_DECAYED_AVERAGE:
+			score = aggregates.DecayedAverage()
+		}
+		ranked = append(ranked, rankedLaptop{laptop: laptop, aggregates: aggregates, score: score})
+		return nil
+	})
+	if err != nil {
+		return errorLog(status.Errorf(codes.Internal, "cannot search laptops: %v", err))
+	}
+
+	// ties go to the laptop with the most ratings
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].score != ranked[j].score {
+			return ranked[i].score > ranked[j].score
+		}
+		if ranked[i].aggregates.Count != ranked[j].aggregates.Count {
+			return ranked[i].aggregates.Count > ranked[j].aggregates.Count
+		}
+		return ranked[i].laptop.GetId() < ranked[j].laptop.GetId()
+	})
+	if len(ranked) > limit {
+		ranked = ranked[:limit]
+	}
+
+	for i, entry := range ranked {
+		if err := contextError(stream.Context()); err != nil {
+			return err
+		}
+
+		// only the ratings sent are read with their histogram
+		rating, err := catalog.ratingStore.Find(entry.laptop.GetId())
+		if err != nil {
+			return errorLog(status.Errorf(codes.Internal, "cannot find rating: %v", err))
+		}
+
+		err = stream.Send(&pb.TopRatedLaptopsResponse{
+			Laptop: entry.laptop,
+			Rating: ratingSummaryToPB(entry.laptop.GetId(), rating, prior),
+			Rank:   uint32(i + 1),
+		})
+		if err != nil {
+			return errorLog(status.Errorf(codes.Unknown, "cannot send stream response: %v", err))
+		}
+	}
+	return nil
+}
+
+// ratingKey returns the rating the filter sorts laptops by, or nil if it doesn't sort by rating.
+func ratingKey(filter *pb.Filter) func(aggregates *RatingAggregates) float64 {
+	switch filter.GetSortBy() {
+	case pb.Filter_RATING:
+		return (*RatingAggregates).Average
+	case pb.Filter_DECAYED_RATING:
+		return (*RatingAggregates).DecayedAverage
+	default:
+		return nil
+	}
+}
+
+// searchByRating streams the laptops matching the filter sorted by their rating,
+// the laptops nobody rated come last in both directions.
+func (server *LaptopServer) searchByRating(catalog *Catalog, filter *pb.Filter, stream pb.LaptopService_SearchLaptopServer) error {
+	key := ratingKey(filter)
+	unsorted := proto.Clone(filter).(*pb.Filter)
+	unsorted.SortBy = pb.Filter_UNSORTED
+
+	var rated, unrated []*pb.Laptop
+	scores := make(map[string]float64)
+	err := catalog.laptopStore.Search(stream.Context(), unsorted, func(laptop *pb.Laptop) error {
+		aggregates, err := catalog.ratingStore.FindAggregates(laptop.GetId())
+		if err != nil {
+			return err
+		}
+		if aggregates == nil || aggregates.Count == 0 {
+			unrated = append(unrated, laptop)
+			return nil
+		}
+
+		scores[laptop.GetId()] = key(aggregates)
+		rated = append(rated, laptop)
+		return nil
+	})
+	if err != nil {
+		return status.Errorf(codes.Internal, "unexpected error: %v", err)
+	}
+
+	sort.SliceStable(rated, func(i, j int) bool {
+		if filter.GetDescending() {
+			return scores[rated[i].GetId()] > scores[rated[j].GetId()]
+		}
+		return scores[rated[i].GetId()] < scores[rated[j].GetId()]
+	})
+
+	for _, laptop := range append(rated, unrated...) {
+		err := stream.Send(&pb.SearchLaptopResponse{Laptop: laptop})
+		if err != nil {
+			return status.Errorf(codes.Internal, "unexpected error: %v", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,252 @@
+package service
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/Dostonlv/pcbook/pb"
+)
+
+// laptopLockCount is how many locks the laptops of a unit of work share.
+const laptopLockCount = 64
+
+// UnitOfWork runs operations spanning the laptop, image and rating stores as a single transaction.
+// The transactions of a laptop are serialized, and if one of them fails, every change it made is undone.
+type UnitOfWork struct {
+	// catalogMutex is shared by the transactions of a laptop and held by the ones of every laptop
+	catalogMutex  sync.RWMutex
+	laptopMutexes [laptopLockCount]sync.Mutex
+	laptopStore   LaptopStore
+	imageStore    ImageStore
+	ratingStore   RatingStore
+	// imageMeter, if any, meters the images committed and deleted
+	imageMeter *ImageMeter
+}
+
+// Tx records the changes made in a transaction, so that they can be rolled back.
+type Tx struct {
+	uow  *UnitOfWork
+	undo []func() error
+}
+
+func NewUnitOfWork(laptopStore LaptopStore, imageStore ImageStore, ratingStore RatingStore) *UnitOfWork {
+	return &UnitOfWork{
+		laptopStore: laptopStore,
+		imageStore:  imageStore,
+		ratingStore: ratingStore,
+	}
+}
+
+// Do runs fn in a transaction changing the laptop and its images and rating, so that the transactions
+// of other laptops run concurrently. If fn returns an error, the changes made through tx
+// are undone in reverse order and the error of fn is returned.
+func (uow *UnitOfWork) Do(laptopID string, fn func(tx *Tx) error) error {
+	uow.catalogMutex.RLock()
+	defer uow.catalogMutex.RUnlock()
+
+	hash := fnv.New32a()
+	hash.Write([]byte(laptopID))
+	mutex := &uow.laptopMutexes[hash.Sum32()%laptopLockCount]
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	return uow.run(fn)
+}
+
+// DoAll runs fn in a transaction which may change every laptop, no other transaction runs meanwhile.
+func (uow *UnitOfWork) DoAll(fn func(tx *Tx) error) error {
+	uow.catalogMutex.Lock()
+	defer uow.catalogMutex.Unlock()
+
+	return uow.run(fn)
+}
+
+func (uow *UnitOfWork) run(fn func(tx *Tx) error) error {
+	tx := &Tx{uow: uow}
+	err := fn(tx)
+	if err != nil {
+		rollbackErr := tx.rollback()
+		if rollbackErr != nil {
+			return fmt.Errorf("%w (rollback failed: %v)", err, rollbackErr)
+		}
+		return err
+	}
+	return nil
+}
+
+func (tx *Tx) rollback() error {
+	var firstErr error
+	for i := len(tx.undo) - 1; i >= 0; i-- {
+		err := tx.undo[i]()
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	tx.undo = nil
+	return firstErr
+}
+
+func (tx *Tx) FindLaptop(id string) (*pb.Laptop, error) {
+	return tx.uow.laptopStore.Find(id)
+}
+
+func (tx *Tx) DeleteLaptop(id string) error {
+	laptop, err := tx.uow.laptopStore.Find(id)
+	if err != nil {
+		return err
+	}
+	if laptop == nil {
+		return ErrNotFound
+	}
+
+	err = tx.uow.laptopStore.Delete(id)
+	if err != nil {
+		return err
+	}
+
+	tx.undo = append(tx.undo, func() error {
+		return tx.uow.laptopStore.Save(laptop)
+	})
+	return nil
+}
+
+// CommitImage commits the content written to writer as a new image.
+func (tx *Tx) CommitImage(info *ImageInfo, writer ImageWriter) (string, error) {
+	imageID, err := writer.Commit(info)
+	if err != nil {
+		return "", err
+	}
+	return imageID, tx.addImage(imageID)
+}
+
+func (tx *Tx) addImage(imageID string) error {
+	tx.undo = append(tx.undo, func() error {
+		return tx.deleteImage(imageID)
+	})
+
+	image, err := tx.uow.imageStore.Find(imageID)
+	if err != nil {
+		return err
+	}
+	if image == nil {
+		return ErrNotFound
+	}
+	tx.uow.imageMeter.Add(image)
+	return nil
+}
+
+func (tx *Tx) deleteImage(imageID string) error {
+	err := tx.uow.imageStore.Delete(imageID)
+	if err != nil {
+		return err
+	}
+	tx.uow.imageMeter.Remove(imageID)
+	return nil
+}
+
+func (tx *Tx) FindImage(imageID string) (*ImageInfo, error) {
+	return tx.uow.imageStore.Find(imageID)
+}
+
+func (tx *Tx) ListImages(laptopID string) ([]*ImageInfo, error) {
+	return tx.uow.imageStore.List(laptopID)
+}
+
+// UpdateImage changes the gallery details of the image.
+func (tx *Tx) UpdateImage(image *ImageInfo) error {
+	previous, err := tx.uow.imageStore.Find(image.ID)
+	if err != nil {
+		return err
+	}
+	if previous == nil {
+		return ErrNotFound
+	}
+
+	err = tx.uow.imageStore.Update(image)
+	if err != nil {
+		return err
+	}
+
+	tx.undo = append(tx.undo, func() error {
+		return tx.uow.imageStore.Update(previous)
+	})
+	return nil
+}
+
+// DeleteImage deletes the image with its content, which can't be restored,
+// so it must be the last change of the transaction.
+func (tx *Tx) DeleteImage(imageID string) error {
+	return tx.deleteImage(imageID)
+}
+
+// LinkImage creates an image for content the image store already has.
+func (tx *Tx) LinkImage(info *ImageInfo, digest string) (string, error) {
+	imageStore, ok := tx.uow.imageStore.(DigestImageStore)
+	if !ok {
+		return "", ErrNotFound
+	}
+
+	imageID, err := imageStore.SaveDigest(info, digest)
+	if err != nil {
+		return "", err
+	}
+	return imageID, tx.addImage(imageID)
+}
+
+func (tx *Tx) FindRating(laptopID string) (*Rating, error) {
+	return tx.uow.ratingStore.Find(laptopID)
+}
+
+// AddRating records the score the user gave at the time, replacing their previous score of the laptop.
+// It returns the rating without the scores of the users.
+func (tx *Tx) AddRating(laptopID string, username string, score float64, ratedAt time.Time) (*Rating, bool, error) {
+	// only the score of the user is kept to undo the change, copying the rating would take every score
+	previous, err := tx.uow.ratingStore.FindScore(laptopID, username)
+	if err != nil {
+		return nil, false, err
+	}
+
+	rating, updated, err := tx.uow.ratingStore.Add(laptopID, username, score, ratedAt)
+	if err != nil {
+		return nil, false, err
+	}
+
+	tx.undo = append(tx.undo, func() error {
+		if previous == nil {
+			_, err := tx.uow.ratingStore.RemoveScore(laptopID, username)
+			return err
+		}
+		_, _, err := tx.uow.ratingStore.Add(laptopID, username, previous.Score, previous.RatedAt)
+		return err
+	})
+	return rating, updated, nil
+}
+
+func (tx *Tx) DeleteRating(laptopID string) error {
+	previous, err := tx.uow.ratingStore.Find(laptopID)
+	if err != nil {
+		return err
+	}
+	if previous == nil {
+		return nil
+	}
+
+	err = tx.uow.ratingStore.Delete(laptopID)
+	if err != nil {
+		return err
+	}
+
+	tx.undo = append(tx.undo, func() error {
+		return tx.restoreRating(laptopID, previous)
+	})
+	return nil
+}
+
+func (tx *Tx) restoreRating(laptopID string, previous *Rating) error {
+	if previous == nil {
+		return tx.uow.ratingStore.Delete(laptopID)
+	}
+	return tx.uow.ratingStore.Save(laptopID, previous)
+}
@@ -0,0 +1,282 @@
+package service_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Dostonlv/pcbook/pb"
+	"github.com/Dostonlv/pcbook/sample"
+	"github.com/Dostonlv/pcbook/service"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var errInjected = errors.New("injected failure")
+
+type failingDeleteLaptopStore struct {
+	*service.InMemoryLaptopStore
+}
+
+func (store failingDeleteLaptopStore) Delete(id string) error {
+	return errInjected
+}
+
+func TestUnitOfWorkRollbackDeleteLaptop(t *testing.T) {
+	t.Parallel()
+
+	laptopStore := failingDeleteLaptopStore{service.NewInMemoryLaptopStore()}
+	ratingStore := service.NewInMemoryRatingStore()
+
+	laptop := sample.NewLaptop()
+	err := laptopStore.Save(laptop)
+	require.NoError(t, err)
+
+	_, _, err = ratingStore.Add(laptop.Id, "alice", 8, time.Now())
+	require.NoError(t, err)
+
+	server := service.NewLaptopServer(laptopStore, nil, ratingStore)
+	_, err = server.DeleteLaptop(context.Background(), &pb.DeleteLaptopRequest{Id: laptop.Id})
+	require.Error(t, err)
+	require.Equal(t, codes.Internal, status.Code(err))
+
+	rating, err := ratingStore.Find(laptop.Id)
+	require.NoError(t, err)
+	requireRatingScores(t, rating, map[string]float64{"alice": 8})
+
+	found, err := laptopStore.Find(laptop.Id)
+	require.NoError(t, err)
+	require.NotNil(t, found)
+}
+
+// failingDeleteImageStore fails to delete a single image.
+type failingDeleteImageStore struct {
+	*service.DiskImageStore
+	failingID string
+}
+
+func (store *failingDeleteImageStore) Delete(imageID string) error {
+	if imageID == store.failingID {
+		return errInjected
+	}
+	return store.DiskImageStore.Delete(imageID)
+}
+
+func TestDeleteLaptopKeepsDeletingImagesAfterFailure(t *testing.T) {
+	t.Parallel()
+
+	laptopStore := service.NewInMemoryLaptopStore()
+	imageStore := &failingDeleteImageStore{DiskImageStore: service.NewDiskImageStore(t.TempDir())}
+	ratingStore := service.NewInMemoryRatingStore()
+
+	laptop := sample.NewLaptop()
+	require.NoError(t, laptopStore.Save(laptop))
+	_, _, err := ratingStore.Add(laptop.Id, "alice", 8, time.Now())
+	require.NoError(t, err)
+
+	var imageIDs []string
+	for i := 0; i < 3; i++ {
+		imageID, err := imageStore.Save(&service.ImageInfo{LaptopID: laptop.Id, Type: ".jpg"}, *bytes.NewBufferString("image"))
+		require.NoError(t, err)
+		imageIDs = append(imageIDs, imageID)
+	}
+	imageStore.failingID = imageIDs[1]
+
+	// the images are deleted after the laptop, a failure leaves only its image behind
+	server := service.NewLaptopServer(laptopStore, imageStore, ratingStore)
+	_, err = server.DeleteLaptop(context.Background(), &pb.DeleteLaptopRequest{Id: laptop.Id})
+	require.NoError(t, err)
+
+	found, err := laptopStore.Find(laptop.Id)
+	require.NoError(t, err)
+	require.Nil(t, found)
+	rating, err := ratingStore.Find(laptop.Id)
+	require.NoError(t, err)
+	require.Nil(t, rating)
+
+	images, err := imageStore.List(laptop.Id)
+	require.NoError(t, err)
+	require.Len(t, images, 1)
+	require.Equal(t, imageIDs[1], images[0].ID)
+}
+
+func TestUnitOfWorkRollbackImageAndRating(t *testing.T) {
+	t.Parallel()
+
+	imageFolder := t.TempDir()
+	laptopStore := service.NewInMemoryLaptopStore()
+	imageStore := service.NewDiskImageStore(imageFolder)
+	ratingStore := service.NewInMemoryRatingStore()
+	uow := service.NewUnitOfWork(laptopStore, imageStore, ratingStore)
+
+	laptop := sample.NewLaptop()
+	err := laptopStore.Save(laptop)
+	require.NoError(t, err)
+
+	_, _, err = ratingStore.Add(laptop.Id, "alice", 6, time.Now())
+	require.NoError(t, err)
+
+	writer, err := imageStore.Create()
+	require.NoError(t, err)
+	_, err = writer.Write([]byte("image"))
+	require.NoError(t, err)
+
+	err = uow.Do(laptop.Id, func(tx *service.Tx) error {
+		_, err := tx.CommitImage(&service.ImageInfo{LaptopID: laptop.Id, Type: ".jpg"}, writer)
+		require.NoError(t, err)
+
+		_, _, err = tx.AddRating(laptop.Id, "alice", 10, time.Now())
+		require.NoError(t, err)
+
+		err = tx.DeleteLaptop(laptop.Id)
+		require.NoError(t, err)
+
+		return errInjected
+	})
+	require.ErrorIs(t, err, errInjected)
+
+	files, err := os.ReadDir(imageFolder)
+	require.NoError(t, err)
+	require.Empty(t, files)
+
+	rating, err := ratingStore.Find(laptop.Id)
+	require.NoError(t, err)
+	requireRatingScores(t, rating, map[string]float64{"alice": 6})
+
+	found, err := laptopStore.Find(laptop.Id)
+	require.NoError(t, err)
+	require.NotNil(t, found)
+}
+
+func TestUnitOfWorkRollbackRatingOfUser(t *testing.T) {
+	t.Parallel()
+
+	fileStore, err := service.NewFileRatingStore(filepath.Join(t.TempDir(), "ratings.jsonl"))
+	require.NoError(t, err)
+	defer fileStore.Close()
+
+	for _, ratingStore := range []service.RatingStore{service.NewInMemoryRatingStore(), fileStore} {
+		ratedAt := time.Now().Add(-time.Hour).UTC()
+		_, _, err := ratingStore.Add("laptop1", "alice", 6, ratedAt)
+		require.NoError(t, err)
+
+		uow := service.NewUnitOfWork(service.NewInMemoryLaptopStore(), nil, ratingStore)
+		err = uow.Do("laptop1", func(tx *service.Tx) error {
+			_, _, err := tx.AddRating("laptop1", "alice", 10, time.Now())
+			require.NoError(t, err)
+			_, _, err = tx.AddRating("laptop1", "bob", 4, time.Now())
+			require.NoError(t, err)
+			_, _, err = tx.AddRating("laptop2", "bob", 4, time.Now())
+			require.NoError(t, err)
+			return errInjected
+		})
+		require.ErrorIs(t, err, errInjected)
+
+		// the users who rated for the first time are removed, the others get their previous score back
+		rating, err := ratingStore.Find("laptop1")
+		require.NoError(t, err)
+		requireRatingScores(t, rating, map[string]float64{"alice": 6})
+		require.True(t, ratedAt.Equal(rating.RatedAt["alice"]))
+		require.Equal(t, 6.0, rating.Sum)
+
+		rating, err = ratingStore.Find("laptop2")
+		require.NoError(t, err)
+		require.Nil(t, rating)
+	}
+}
+
+func TestUnitOfWorkLocksPerLaptop(t *testing.T) {
+	t.Parallel()
+
+	uow := service.NewUnitOfWork(service.NewInMemoryLaptopStore(), nil, service.NewInMemoryRatingStore())
+	started := make(chan struct{})
+	release := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- uow.Do("laptop1", func(tx *service.Tx) error {
+			close(started)
+			<-release
+			return nil
+		})
+	}()
+	<-started
+
+	// another laptop doesn't wait for the running transaction
+	require.NoError(t, uow.Do("laptop2", func(tx *service.Tx) error { return nil }))
+
+	allDone := make(chan error)
+	go func() {
+		allDone <- uow.DoAll(func(tx *service.Tx) error { return nil })
+	}()
+	select {
+	case <-allDone:
+		t.Fatal("a transaction of every laptop ran along with a transaction of a laptop")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	require.NoError(t, <-done)
+	require.NoError(t, <-allDone)
+}
+
+func TestDeleteLaptopDeletesImages(t *testing.T) {
+	t.Parallel()
+
+	imageStore := service.NewDiskImageStore(t.TempDir())
+	laptop := sample.NewLaptop()
+	otherLaptop := sample.NewLaptop()
+	saveImage := func(laptopID string) string {
+		imageID, err := imageStore.Save(&service.ImageInfo{LaptopID: laptopID, Type: ".jpg"}, *bytes.NewBufferString("image"))
+		require.NoError(t, err)
+		return imageID
+	}
+	imageID := saveImage(laptop.Id)
+	otherImageID := saveImage(otherLaptop.Id)
+
+	// the images are kept when the laptop can't be deleted
+	failingStore := failingDeleteLaptopStore{service.NewInMemoryLaptopStore()}
+	require.NoError(t, failingStore.Save(laptop))
+	_, err := service.NewLaptopServer(failingStore, imageStore, service.NewInMemoryRatingStore()).
+		DeleteLaptop(context.Background(), &pb.DeleteLaptopRequest{Id: laptop.Id})
+	require.Equal(t, codes.Internal, status.Code(err))
+	image, err := imageStore.Find(imageID)
+	require.NoError(t, err)
+	require.NotNil(t, image)
+
+	laptopStore := service.NewInMemoryLaptopStore()
+	require.NoError(t, laptopStore.Save(laptop))
+	_, err = service.NewLaptopServer(laptopStore, imageStore, service.NewInMemoryRatingStore()).
+		DeleteLaptop(context.Background(), &pb.DeleteLaptopRequest{Id: laptop.Id})
+	require.NoError(t, err)
+
+	images, err := imageStore.List(laptop.Id)
+	require.NoError(t, err)
+	require.Empty(t, images)
+	require.NoFileExists(t, image.Path)
+
+	image, err = imageStore.Find(otherImageID)
+	require.NoError(t, err)
+	require.NotNil(t, image)
+}
+
+// requireRatingScores checks that the rating aggregates exactly the scores.
+func requireRatingScores(t *testing.T, rating *service.Rating, scores map[string]float64) {
+	require.NotNil(t, rating)
+	require.Equal(t, scores, rating.Scores)
+	require.Equal(t, uint32(len(scores)), rating.Count)
+	require.Len(t, rating.RatedAt, len(scores))
+
+	sum := 0.0
+	histogram := make(map[float64]uint32)
+	for _, score := range scores {
+		sum += score
+		histogram[score]++
+	}
+	require.InDelta(t, sum, rating.Sum, 1e-9)
+	require.Equal(t, histogram, rating.Histogram)
+}
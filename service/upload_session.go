@@ -0,0 +1,140 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const DefaultUploadSessionTTL = 15 * time.Minute
+
+var ErrInvalidOffset = errors.New("invalid chunk offset")
+
+// UploadSession keeps the content received for an image upload,
+// so that a client whose stream breaks can resume where the server stopped.
+// Only one stream at a time writes to a session.
+type UploadSession struct {
+	ID     string
+	Tenant string
+	Info   *ImageInfo
+	Digest string
+	Size   int64
+
+	mutex     sync.Mutex
+	upload    *imageUpload
+	committed atomic.Int64
+	expiresAt time.Time
+}
+
+// Committed returns the number of bytes the server has received.
+func (session *UploadSession) Committed() int64 {
+	return session.committed.Load()
+}
+
+// Write appends the chunk at the offset. Bytes the session already has are skipped,
+// so a client may resend a chunk it isn't sure the server received.
+func (session *UploadSession) Write(offset int64, chunk []byte) error {
+	committed := session.Committed()
+	if offset < 0 || offset > committed {
+		return fmt.Errorf("%w: got %d, committed %d", ErrInvalidOffset, offset, committed)
+	}
+
+	skip := committed - offset
+	if skip >= int64(len(chunk)) {
+		return nil
+	}
+
+	_, err := session.upload.Write(chunk[skip:])
+	session.committed.Store(session.upload.Size())
+	return err
+}
+
+// UploadSessions keeps the unfinished uploads until they expire.
+// Every write extends the life of a session by the TTL,
+// the content of an expired session is discarded.
+type UploadSessions struct {
+	mutex    sync.Mutex
+	ttl      time.Duration
+	sessions map[string]*UploadSession
+}
+
+func NewUploadSessions(ttl time.Duration) *UploadSessions {
+	return &UploadSessions{
+		ttl:      ttl,
+		sessions: make(map[string]*UploadSession),
+	}
+}
+
+func (sessions *UploadSessions) Start(tenant string, info *ImageInfo, digest string, size int64, upload *imageUpload) (*UploadSession, error) {
+	sessionID, err := uuid.NewRandom()
+	if err != nil {
+		return nil, fmt.Errorf("cannot generate upload session id: %w", err)
+	}
+
+	session := &UploadSession{
+		ID:     sessionID.String(),
+		Tenant: tenant,
+		Info:   info.Clone(),
+		Digest: digest,
+		Size:   size,
+		upload: upload,
+	}
+
+	sessions.mutex.Lock()
+	defer sessions.mutex.Unlock()
+
+	sessions.expire(time.Now())
+	session.expiresAt = time.Now().Add(sessions.ttl)
+	sessions.sessions[session.ID] = session
+	return session, nil
+}
+
+// Find returns the session of the tenant, or nil if it doesn't exist or has expired.
+func (sessions *UploadSessions) Find(tenant string, sessionID string) *UploadSession {
+	sessions.mutex.Lock()
+	defer sessions.mutex.Unlock()
+
+	sessions.expire(time.Now())
+	session := sessions.sessions[sessionID]
+	if session == nil || session.Tenant != tenant {
+		return nil
+	}
+	return session
+}
+
+// ExpiresAt returns when the session expires unless it's written to.
+func (sessions *UploadSessions) ExpiresAt(session *UploadSession) time.Time {
+	sessions.mutex.Lock()
+	defer sessions.mutex.Unlock()
+
+	return session.expiresAt
+}
+
+func (sessions *UploadSessions) Touch(session *UploadSession) {
+	sessions.mutex.Lock()
+	defer sessions.mutex.Unlock()
+
+	session.expiresAt = time.Now().Add(sessions.ttl)
+}
+
+func (sessions *UploadSessions) Remove(sessionID string) {
+	sessions.mutex.Lock()
+	defer sessions.mutex.Unlock()
+
+	delete(sessions.sessions, sessionID)
+}
+
+// expire removes the expired sessions, except the ones a stream is writing to.
+func (sessions *UploadSessions) expire(now time.Time) {
+	for sessionID, session := range sessions.sessions {
+		if now.After(session.expiresAt) && session.mutex.TryLock() {
+			session.upload.writer.Abort()
+			session.mutex.Unlock()
+			delete(sessions.sessions, sessionID)
+		}
+	}
+}
@@ -0,0 +1,252 @@
+package service_test
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Dostonlv/pcbook/client"
+	"github.com/Dostonlv/pcbook/pb"
+	"github.com/Dostonlv/pcbook/sample"
+	"github.com/Dostonlv/pcbook/service"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+func sendTestChunk(stream pb.LaptopService_UploadImageClient, offset int, data []byte) error {
+	return stream.Send(&pb.UploadImageRequest{
+		Data: &pb.UploadImageRequest_Chunk{
+			Chunk: &pb.ImageChunk{Offset: uint64(offset), Data: data},
+		},
+	})
+}
+
+func openTestUploadSession(t *testing.T, laptopClient pb.LaptopServiceClient, ctx context.Context, sessionID string) pb.LaptopService_UploadImageClient {
+	stream, err := laptopClient.UploadImage(ctx)
+	require.NoError(t, err)
+
+	err = stream.Send(&pb.UploadImageRequest{
+		Data: &pb.UploadImageRequest_SessionId{SessionId: sessionID},
+	})
+	require.NoError(t, err)
+	return stream
+}
+
+func TestClientUploadImageSession(t *testing.T) {
+	t.Parallel()
+
+	laptopStore := service.NewInMemoryLaptopStore()
+	imageStore := service.NewDiskImageStore(t.TempDir())
+
+	laptop := sample.NewLaptop()
+	require.NoError(t, laptopStore.Save(laptop))
+
+	serverAddress := startTestLaptopServer(t, laptopStore, imageStore, nil)
+	laptopClient := newTestLaptopClient(t, serverAddress)
+
+	content := newTestPNG(t, 64, 48)
+	half := len(content) / 2
+
+	session, err := laptopClient.StartImageUpload(context.Background(), &pb.StartImageUploadRequest{
+		Info: &pb.ImageInfo{LaptopId: laptop.GetId(), ImageType: ".png"},
+		Size: uint64(len(content)),
+	})
+	require.NoError(t, err)
+	require.NotEmpty(t, session.GetSessionId())
+
+	// the first stream breaks after sending half of the image
+	ctx, cancel := context.WithCancel(context.Background())
+	stream := openTestUploadSession(t, laptopClient, ctx, session.GetSessionId())
+	require.NoError(t, sendTestChunk(stream, 0, content[:half]))
+
+	queryStatus := func() (*pb.QueryUploadStatusResponse, error) {
+		return laptopClient.QueryUploadStatus(context.Background(), &pb.QueryUploadStatusRequest{
+			SessionId: session.GetSessionId(),
+		})
+	}
+	require.Eventually(t, func() bool {
+		res, err := queryStatus()
+		return err == nil && res.GetCommittedSize() == uint64(half)
+	}, 5*time.Second, 10*time.Millisecond)
+	cancel()
+
+	res, err := queryStatus()
+	require.NoError(t, err)
+	require.EqualValues(t, len(content), res.GetSize())
+
+	// a chunk past the committed offset is rejected, the session is kept
+	stream = openTestUploadSession(t, laptopClient, context.Background(), session.GetSessionId())
+	require.NoError(t, sendTestChunk(stream, half+1, content[half+1:]))
+	_, err = stream.CloseAndRecv()
+	require.Equal(t, codes.OutOfRange, status.Code(err))
+
+	// closing the stream before the end doesn't complete the upload
+	stream = openTestUploadSession(t, laptopClient, context.Background(), session.GetSessionId())
+	_, err = stream.CloseAndRecv()
+	require.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	// resending bytes the server already has is harmless
+	stream = openTestUploadSession(t, laptopClient, context.Background(), session.GetSessionId())
+	require.NoError(t, sendTestChunk(stream, half-10, content[half-10:]))
+	uploaded, err := stream.CloseAndRecv()
+	require.NoError(t, err)
+	require.EqualValues(t, len(content), uploaded.GetSize())
+	require.Equal(t, service.ImageDigest(content), uploaded.GetDigest())
+
+	image, err := imageStore.Find(uploaded.GetId())
+	require.NoError(t, err)
+	require.Equal(t, laptop.GetId(), image.LaptopID)
+
+	_, err = queryStatus()
+	require.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestClientUploadImageSessionSurvivesQuotaFailure(t *testing.T) {
+	t.Parallel()
+
+	laptopStore := service.NewInMemoryLaptopStore()
+	imageStore := service.NewDiskImageStore(t.TempDir())
+	laptop := sample.NewLaptop()
+	require.NoError(t, laptopStore.Save(laptop))
+
+	laptopServer := service.NewLaptopServer(laptopStore, imageStore, nil, service.WithImageQuotas(service.ImageQuotas{
+		MaxImagesPerLaptop: 1,
+	}))
+	laptopClient := newTestLaptopClient(t, startTestLaptopServerWith(t, laptopServer))
+
+	content := newTestPNG(t, 64, 48)
+	session, err := laptopClient.StartImageUpload(context.Background(), &pb.StartImageUploadRequest{
+		Info: &pb.ImageInfo{LaptopId: laptop.GetId(), ImageType: ".png"},
+		Size: uint64(len(content)),
+	})
+	require.NoError(t, err)
+
+	// another image takes the room of the upload before it completes
+	otherID := uploadTestImage(t, laptopClient, laptop.GetId(), ".png", newTestPNG(t, 10, 10))
+	stream := openTestUploadSession(t, laptopClient, context.Background(), session.GetSessionId())
+	require.NoError(t, sendTestChunk(stream, 0, content))
+	_, err = stream.CloseAndRecv()
+	requireQuotaFailure(t, err, "laptop:"+laptop.GetId())
+
+	// the received bytes are kept, so the upload completes without sending them again
+	res, err := laptopClient.QueryUploadStatus(context.Background(), &pb.QueryUploadStatusRequest{SessionId: session.GetSessionId()})
+	require.NoError(t, err)
+	require.EqualValues(t, len(content), res.GetCommittedSize())
+
+	_, err = laptopClient.DeleteImage(context.Background(), &pb.DeleteImageRequest{ImageId: otherID})
+	require.NoError(t, err)
+	stream = openTestUploadSession(t, laptopClient, context.Background(), session.GetSessionId())
+	uploaded, err := stream.CloseAndRecv()
+	require.NoError(t, err)
+	require.Equal(t, service.ImageDigest(content), uploaded.GetDigest())
+}
+
+func TestUploadSessionExpires(t *testing.T) {
+	t.Parallel()
+
+	laptopStore := service.NewInMemoryLaptopStore()
+	imageStore := service.NewDiskImageStore(t.TempDir())
+
+	laptop := sample.NewLaptop()
+	require.NoError(t, laptopStore.Save(laptop))
+
+	laptopServer := service.NewLaptopServer(laptopStore, imageStore, nil,
+		service.WithUploadSessions(service.NewUploadSessions(50*time.Millisecond)),
+	)
+
+	session, err := laptopServer.StartImageUpload(context.Background(), &pb.StartImageUploadRequest{
+		Info: &pb.ImageInfo{LaptopId: laptop.GetId(), ImageType: ".png"},
+	})
+	require.NoError(t, err)
+
+	_, err = laptopServer.QueryUploadStatus(context.Background(), &pb.QueryUploadStatusRequest{
+		SessionId: session.GetSessionId(),
+	})
+	require.NoError(t, err)
+
+	time.Sleep(100 * time.Millisecond)
+	_, err = laptopServer.QueryUploadStatus(context.Background(), &pb.QueryUploadStatusRequest{
+		SessionId: session.GetSessionId(),
+	})
+	require.Equal(t, codes.NotFound, status.Code(err))
+
+	_, err = laptopServer.StartImageUpload(context.Background(), &pb.StartImageUploadRequest{
+		Info: &pb.ImageInfo{LaptopId: "unknown", ImageType: ".png"},
+	})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+// droppingStream drops the first stream resuming an upload session
+// after it received three chunks, like a broken connection.
+type droppingStream struct {
+	grpc.ServerStream
+	sessions *atomic.Int32
+	chunks   int
+}
+
+func (stream *droppingStream) RecvMsg(m any) error {
+	if stream.chunks == 0 {
+		return status.Error(codes.Unavailable, "connection dropped")
+	}
+
+	err := stream.ServerStream.RecvMsg(m)
+	if err != nil {
+		return err
+	}
+
+	req := m.(*pb.UploadImageRequest)
+	if req.GetSessionId() != "" && stream.sessions.Add(1) == 1 {
+		stream.chunks = 3
+	} else if req.GetChunk() != nil && stream.chunks > 0 {
+		stream.chunks--
+	}
+	return nil
+}
+
+func TestLaptopClientUploadImageResumes(t *testing.T) {
+	t.Parallel()
+
+	laptopStore := service.NewInMemoryLaptopStore()
+	imageStore := service.NewDiskImageStore(t.TempDir())
+
+	laptop := sample.NewLaptop()
+	require.NoError(t, laptopStore.Save(laptop))
+
+	var sessionStreams atomic.Int32
+	dropFirstSession := func(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return handler(srv, &droppingStream{ServerStream: stream, sessions: &sessionStreams, chunks: -1})
+	}
+
+	grpcServer := grpc.NewServer(grpc.StreamInterceptor(dropFirstSession))
+	pb.RegisterLaptopServiceServer(grpcServer, service.NewLaptopServer(laptopStore, imageStore, nil))
+	listener, err := net.Listen("tcp", ":0")
+	require.NoError(t, err)
+	go grpcServer.Serve(listener)
+	defer grpcServer.Stop()
+
+	conn, err := grpc.Dial(listener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+
+	content := newTestJPEG(t, 640, 400)
+	require.Greater(t, len(content), 4*1024)
+	imagePath := filepath.Join(t.TempDir(), "laptop.jpg")
+	require.NoError(t, os.WriteFile(imagePath, content, 0644))
+
+	res, err := client.NewLaptopClient(conn).UploadImage(laptop.GetId(), imagePath)
+	require.NoError(t, err)
+	require.EqualValues(t, len(content), res.GetSize())
+	require.Equal(t, service.ImageDigest(content), res.GetDigest())
+	require.EqualValues(t, 2, sessionStreams.Load())
+
+	image, err := imageStore.Find(res.GetId())
+	require.NoError(t, err)
+	require.EqualValues(t, len(content), image.Size)
+}
@@ -1,32 +1,73 @@
 package service
 
 import (
+	"errors"
 	"fmt"
+	"time"
 
 	"golang.org/x/crypto/bcrypt"
 )
 
+var ErrInvalidRole = errors.New("invalid role")
+
+var roles = map[string]bool{
+	"superadmin": true,
+	"admin":      true,
+	"user":       true,
+}
+
 type User struct {
-	Username       string
-	HashedPassword string
-	Role           string
+	Tenant         string `json:"tenant"`
+	Username       string `json:"username"`
+	HashedPassword string `json:"hashed_password"`
+	Role           string `json:"role"`
+	// CreatedAt is zero for the users created before it was recorded.
+	CreatedAt time.Time `json:"created_at,omitempty"`
 }
 
-func NewUser(username string, password string, role string) (*User, error) {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+func NewUser(tenant string, username string, password string, role string) (*User, error) {
+	err := ValidateTenant(tenant)
+	if err != nil {
+		return nil, err
+	}
+
+	err = ValidateRole(role)
 	if err != nil {
-		return nil, fmt.Errorf("cannot hash password: %w", err)
+		return nil, err
 	}
 
 	user := &User{
-		Username:       username,
-		HashedPassword: string(hashedPassword),
-		Role:           role,
+		Tenant:    tenant,
+		Username:  username,
+		Role:      role,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	err = user.SetPassword(password)
+	if err != nil {
+		return nil, err
 	}
 
 	return user, nil
 }
 
+func ValidateRole(role string) error {
+	if !roles[role] {
+		return fmt.Errorf("%w: %q", ErrInvalidRole, role)
+	}
+	return nil
+}
+
+func (user *User) SetPassword(password string) error {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("cannot hash password: %w", err)
+	}
+
+	user.HashedPassword = string(hashedPassword)
+	return nil
+}
+
 func (user *User) IsCorrectPassword(password string) bool {
 	err := bcrypt.CompareHashAndPassword([]byte(user.HashedPassword), []byte(password))
 	return err == nil
@@ -35,8 +76,10 @@ func (user *User) IsCorrectPassword(password string) bool {
 
 func (user *User) Clone() *User {
 	return &User{
+		Tenant:         user.Tenant,
 		Username:       user.Username,
 		HashedPassword: user.HashedPassword,
 		Role:           user.Role,
+		CreatedAt:      user.CreatedAt,
 	}
 }
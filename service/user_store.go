@@ -1,10 +1,18 @@
 package service
 
-import "sync"
+import (
+	"sort"
+	"sync"
+)
 
 type UserStore interface {
 	Save(user *User) error
-	Find(username string) (*User, error)
+	Find(tenant string, username string) (*User, error)
+	Update(user *User) error
+	Delete(tenant string, username string) error
+	List(tenant string) ([]*User, error)
+	// Tenants returns the names of the tenants having users.
+	Tenants() ([]string, error)
 }
 
 type InMemoryUserStore struct {
@@ -22,19 +30,90 @@ func (store *InMemoryUserStore) Save(user *User) error {
 	store.mutex.Lock()
 	defer store.mutex.Unlock()
 
-	if store.users[user.Username] != nil {
+	key := userKey(user.Tenant, user.Username)
+	if store.users[key] != nil {
 		return ErrAlreadyExists
 	}
-	store.users[user.Username] = user.Clone()
+	store.users[key] = user.Clone()
 	return nil
 }
-func (store *InMemoryUserStore) Find(username string) (*User, error) {
+
+func (store *InMemoryUserStore) Find(tenant string, username string) (*User, error) {
 	store.mutex.RLock()
 	defer store.mutex.RUnlock()
 
-	user := store.users[username]
+	user := store.users[userKey(tenant, username)]
 	if user == nil {
 		return nil, nil
 	}
 	return user.Clone(), nil
 }
+
+func (store *InMemoryUserStore) Update(user *User) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	key := userKey(user.Tenant, user.Username)
+	if store.users[key] == nil {
+		return ErrNotFound
+	}
+	store.users[key] = user.Clone()
+	return nil
+}
+
+func (store *InMemoryUserStore) Delete(tenant string, username string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	key := userKey(tenant, username)
+	if store.users[key] == nil {
+		return ErrNotFound
+	}
+	delete(store.users, key)
+	return nil
+}
+
+func (store *InMemoryUserStore) List(tenant string) ([]*User, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	return listUsers(store.users, tenant), nil
+}
+
+func (store *InMemoryUserStore) Tenants() ([]string, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	return listTenants(store.users), nil
+}
+
+func userKey(tenant string, username string) string {
+	return tenant + "/" + username
+}
+
+// listUsers returns copies of the users of the tenant sorted by username.
+func listUsers(users map[string]*User, tenant string) []*User {
+	list := []*User{}
+	for _, user := range users {
+		if user.Tenant == tenant {
+			list = append(list, user.Clone())
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Username < list[j].Username
+	})
+	return list
+}
+
+func listTenants(users map[string]*User) []string {
+	seen := make(map[string]bool)
+	tenants := []string{}
+	for _, user := range users {
+		if !seen[user.Tenant] {
+			seen[user.Tenant] = true
+			tenants = append(tenants, user.Tenant)
+		}
+	}
+	sort.Strings(tenants)
+	return tenants
+}